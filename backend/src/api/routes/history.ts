@@ -7,6 +7,7 @@
 import { Router, Request, Response, NextFunction } from 'express';
 import * as historyService from '../../services/history';
 import * as couchdb from '../../services/couchdb';
+import { missionService, vehicleService, segmentService } from '../../services/fabric';
 
 const router = Router();
 
@@ -272,5 +273,53 @@ router.get('/recent', asyncHandler(async (req: Request, res: Response) => {
   });
 }));
 
+// Parse the optional from/to query params (Unix seconds) of the ledger history routes
+const timeRange = (req: Request): [number, number] => [
+  parseInt(req.query.from as string, 10) || 0,
+  parseInt(req.query.to as string, 10) || 0,
+];
+
+/**
+ * GET /api/history/ledger/missions/:missionId
+ * Get every committed version of a mission from the ledger key history
+ */
+router.get('/ledger/missions/:missionId', asyncHandler(async (req: Request, res: Response) => {
+  const [from, to] = timeRange(req);
+  const versions = await missionService.getMissionHistory(req.params.missionId, from, to);
+
+  res.json({
+    success: true,
+    data: versions,
+  });
+}));
+
+/**
+ * GET /api/history/ledger/vehicles/:vehicleId
+ * Get every committed version of a vehicle from the ledger key history
+ */
+router.get('/ledger/vehicles/:vehicleId', asyncHandler(async (req: Request, res: Response) => {
+  const [from, to] = timeRange(req);
+  const versions = await vehicleService.getVehicleHistory(req.params.vehicleId, from, to);
+
+  res.json({
+    success: true,
+    data: versions,
+  });
+}));
+
+/**
+ * GET /api/history/ledger/segments/:segmentId
+ * Get every committed version of a segment from the ledger key history
+ */
+router.get('/ledger/segments/:segmentId', asyncHandler(async (req: Request, res: Response) => {
+  const [from, to] = timeRange(req);
+  const versions = await segmentService.getSegmentHistory(req.params.segmentId, from, to);
+
+  res.json({
+    success: true,
+    data: versions,
+  });
+}));
+
 export default router;
 
@@ -215,12 +215,14 @@ router.get('/statistics', async (req: Request, res: Response) => {
       free: 0,
       reserved: 0,
       occupied: 0,
+      blocked: 0,
     };
     
     for (const segment of segments) {
       if (segment.status === 'free') statusCounts.free++;
       else if (segment.status === 'reserved') statusCounts.reserved++;
       else if (segment.status === 'occupied') statusCounts.occupied++;
+      else if (segment.status === 'blocked') statusCounts.blocked++;
     }
     
     const statistics = {
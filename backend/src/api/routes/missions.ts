@@ -10,18 +10,23 @@ import * as couchdb from '../../services/couchdb';
 import routingService from '../../services/routing';
 import conflictService from '../../services/conflict';
 import { broadcastMessage } from '../../services/realtime/websocket';
-import { addVehicleToSimulation, getSimulationStatus, handleMissionRerouted } from '../../services/simulation';
+import { addVehicleToSimulation, getSimulationStatus, handleMissionRerouted, removeVehicleFromSimulation } from '../../services/simulation';
 import * as historyService from '../../services/history';
 import { getManhattanNodes } from '../../services/map/manhattan';
 import {
   CreateMissionRequest,
   RouteRequest,
   Mission,
-  Segment
+  PathStep,
+  Segment,
+  Severity,
+  Waypoint
 } from '../../models/types';
 
 const router = Router();
 
+const SEVERITIES: Severity[] = ['critical', 'high', 'medium', 'low'];
+
 // Error wrapper for async handlers
 const asyncHandler = (fn: (req: Request, res: Response, next: NextFunction) => Promise<void>) =>
   (req: Request, res: Response, next: NextFunction) => {
@@ -56,6 +61,37 @@ async function withRetry<T>(
   throw lastError;
 }
 
+/**
+ * Pair each segment of a path with the intersections it is driven between
+ * Returns an error message when the path does not drive to endNode
+ */
+function routeSteps(path: string[], endNode: string): PathStep[] | string {
+  const nodePath = routingService.nodePathEndingAt(path, endNode);
+  if (!nodePath) {
+    return `Path does not connect to ${endNode}`;
+  }
+  return missionService.toPathSteps(path, nodePath);
+}
+
+/**
+ * routeSteps for one path per leg, every leg driving to its stop
+ */
+function legSteps(legs: string[][], waypoints: Waypoint[]): PathStep[][] | string {
+  if (legs.length !== waypoints.length) {
+    return `Expected ${waypoints.length} leg paths, got ${legs.length}`;
+  }
+
+  const steps: PathStep[][] = [];
+  for (let i = 0; i < legs.length; i++) {
+    const leg = routeSteps(legs[i], waypoints[i].nodeId);
+    if (typeof leg === 'string') {
+      return `Leg path ${i}: ${leg}`;
+    }
+    steps.push(leg);
+  }
+  return steps;
+}
+
 /**
  * GET /api/missions
  * Get all missions (with optional filters)
@@ -125,10 +161,18 @@ router.get('/:missionId', asyncHandler(async (req: Request, res: Response) => {
 router.post('/', asyncHandler(async (req: Request, res: Response) => {
   const request: CreateMissionRequest = req.body;
 
-  if (!request.vehicleId || !request.originNode || !request.destNode) {
+  const hasStops = Array.isArray(request.stops) && request.stops.length > 0;
+  if (!request.vehicleId || !request.originNode || (!request.destNode && !hasStops)) {
     res.status(400).json({
       success: false,
-      error: 'Missing required fields: vehicleId, originNode, destNode',
+      error: 'Missing required fields: vehicleId, originNode, destNode (or stops)',
+    });
+    return;
+  }
+  if (!SEVERITIES.includes(request.severity)) {
+    res.status(400).json({
+      success: false,
+      error: `severity is required and must be one of: ${SEVERITIES.join(', ')}`,
     });
     return;
   }
@@ -158,7 +202,7 @@ router.post('/', asyncHandler(async (req: Request, res: Response) => {
  */
 router.post('/:missionId/activate', asyncHandler(async (req: Request, res: Response) => {
   const { missionId } = req.params;
-  let { path } = req.body;
+  let { path, nodePath } = req.body;
 
   if (!path || !Array.isArray(path) || path.length === 0) {
     res.status(400).json({
@@ -178,6 +222,18 @@ router.post('/:missionId/activate', asyncHandler(async (req: Request, res: Respo
     return;
   }
 
+  // The chaincode needs both endpoints of every step - derive them when not given
+  if (!Array.isArray(nodePath) || nodePath.length !== path.length + 1) {
+    nodePath = routingService.nodePathEndingAt(path, pendingMission.destNode);
+    if (!nodePath) {
+      res.status(400).json({
+        success: false,
+        error: `Path does not connect to the mission destination ${pendingMission.destNode}`,
+      });
+      return;
+    }
+  }
+
   // Check for conflicts before activating - get current segment states
   const segments = await couchdb.getAllSegments();
   const segmentMap = new Map<string, Segment>();
@@ -239,6 +295,7 @@ router.post('/:missionId/activate', asyncHandler(async (req: Request, res: Respo
     // Use the alternative route
     console.log(`[ConflictCheck] Found alternative route for ${missionId}: ${alternativeRoute.path.join(' -> ')}`);
     path = alternativeRoute.path;
+    nodePath = alternativeRoute.nodePath;
 
     // Notify about the reroute
     broadcastMessage({
@@ -268,7 +325,7 @@ router.post('/:missionId/activate', asyncHandler(async (req: Request, res: Respo
 
   // Now activate the mission with the (possibly updated) path
   const mission = await withRetry(
-    () => missionService.activateMission(missionId, path),
+    () => missionService.activateMission(missionId, path, nodePath),
     3,
     `Activate mission ${missionId}`
   );
@@ -308,6 +365,270 @@ router.post('/:missionId/activate', asyncHandler(async (req: Request, res: Respo
   });
 }));
 
+/**
+ * POST /api/missions/:missionId/activate-legs
+ * Activate a pending multi-stop mission with one path per leg
+ * The chaincode reserves every leg at once and reports conflicts itself
+ */
+router.post('/:missionId/activate-legs', asyncHandler(async (req: Request, res: Response) => {
+  const { missionId } = req.params;
+  const { legs } = req.body;
+
+  if (!Array.isArray(legs) || legs.length === 0 || !legs.every(leg => Array.isArray(leg) && leg.length > 0)) {
+    res.status(400).json({
+      success: false,
+      error: 'legs must be a non-empty array of non-empty segment ID arrays',
+    });
+    return;
+  }
+
+  const pendingMission = await couchdb.getMission(missionId);
+  if (!pendingMission) {
+    res.status(404).json({
+      success: false,
+      error: `Mission ${missionId} not found`,
+    });
+    return;
+  }
+
+  const steps = legSteps(legs, pendingMission.waypoints || []);
+  if (typeof steps === 'string') {
+    res.status(400).json({ success: false, error: steps });
+    return;
+  }
+
+  const mission = await withRetry(
+    () => missionService.activateMissionLegs(missionId, steps),
+    3,
+    `Activate mission ${missionId}`
+  );
+
+  // Track in history
+  historyService.trackMissionActivated(mission);
+
+  // Broadcast to WebSocket clients
+  broadcastMessage({
+    type: 'MISSION_ACTIVATED',
+    payload: { mission },
+    timestamp: Date.now(),
+  });
+
+  res.json({
+    success: true,
+    data: mission,
+    message: `Mission activated with ${legs.length} legs`,
+  });
+}));
+
+/**
+ * POST /api/missions/:missionId/reach-waypoint
+ * Close the current leg of a multi-stop mission at its stop
+ */
+router.post('/:missionId/reach-waypoint', asyncHandler(async (req: Request, res: Response) => {
+  const { missionId } = req.params;
+  const { nodeId } = req.body;
+
+  if (!nodeId) {
+    res.status(400).json({
+      success: false,
+      error: 'nodeId is required',
+    });
+    return;
+  }
+
+  const mission = await withRetry(
+    () => missionService.reachWaypoint(missionId, nodeId),
+    3,
+    `Reach waypoint ${nodeId} of mission ${missionId}`
+  );
+
+  // Broadcast to WebSocket clients
+  broadcastMessage({
+    type: 'WAYPOINT_REACHED',
+    payload: { mission, nodeId },
+    timestamp: Date.now(),
+  });
+
+  res.json({
+    success: true,
+    data: mission,
+    message: mission.status === 'completed'
+      ? `Mission ${missionId} reached its last stop and is completed`
+      : `Mission ${missionId} reached ${nodeId}`,
+  });
+}));
+
+/**
+ * POST /api/missions/:missionId/handoff
+ * Move an underway mission to another vehicle of the same org
+ * Segments on both the old and the new path are never freed
+ */
+router.post('/:missionId/handoff', asyncHandler(async (req: Request, res: Response) => {
+  const { missionId } = req.params;
+  const { newVehicleId, path } = req.body;
+
+  if (!newVehicleId || !Array.isArray(path) || path.length === 0) {
+    res.status(400).json({
+      success: false,
+      error: 'newVehicleId and a path array are required',
+    });
+    return;
+  }
+
+  const current = await couchdb.getMission(missionId);
+  if (!current) {
+    res.status(404).json({
+      success: false,
+      error: `Mission ${missionId} not found`,
+    });
+    return;
+  }
+
+  // A multi-stop mission gives one path per leg not yet driven
+  const steps = current.waypoints && current.waypoints.length > 0
+    ? legSteps(path, current.waypoints.slice(current.currentLeg || 0))
+    : routeSteps(path, current.destNode);
+  if (typeof steps === 'string') {
+    res.status(400).json({ success: false, error: steps });
+    return;
+  }
+
+  const mission = await withRetry(
+    () => missionService.handoffMission(missionId, newVehicleId, steps),
+    3,
+    `Hand off mission ${missionId}`
+  );
+
+  const handoff = mission.handoffs?.[mission.handoffs.length - 1];
+
+  // Keep the simulation on the vehicle now driving the mission
+  const simStatus = getSimulationStatus();
+  if (simStatus.isRunning) {
+    if (handoff) {
+      removeVehicleFromSimulation(handoff.fromVehicleId);
+    }
+    addVehicleToSimulation(mission);
+  }
+
+  // Broadcast to WebSocket clients
+  broadcastMessage({
+    type: 'MISSION_HANDED_OFF',
+    payload: { mission, handoff },
+    timestamp: Date.now(),
+  });
+
+  res.json({
+    success: true,
+    data: mission,
+    message: `Mission ${missionId} handed off to ${newVehicleId}`,
+  });
+}));
+
+/**
+ * GET /api/missions/:missionId/convoy
+ * Get the missions escorting a lead mission
+ */
+router.get('/:missionId/convoy', asyncHandler(async (req: Request, res: Response) => {
+  const { missionId } = req.params;
+
+  const members = await missionService.getConvoyMembers(missionId);
+
+  res.json({
+    success: true,
+    data: members,
+    count: members.length,
+  });
+}));
+
+/**
+ * POST /api/missions/:missionId/convoy
+ * Propose that this mission escorts the lead mission in the body
+ */
+router.post('/:missionId/convoy', asyncHandler(async (req: Request, res: Response) => {
+  const { missionId } = req.params;
+  const { leadMissionId } = req.body;
+
+  if (!leadMissionId) {
+    res.status(400).json({
+      success: false,
+      error: 'leadMissionId is required',
+    });
+    return;
+  }
+
+  const mission = await withRetry(
+    () => missionService.proposeConvoy(missionId, leadMissionId),
+    3,
+    `Propose convoy ${missionId} -> ${leadMissionId}`
+  );
+
+  broadcastMessage({
+    type: mission.convoy?.status === 'accepted' ? 'CONVOY_LINKED' : 'CONVOY_PROPOSED',
+    payload: { mission, leadMissionId },
+    timestamp: Date.now(),
+  });
+
+  res.json({
+    success: true,
+    data: mission,
+    message: mission.convoy?.status === 'accepted'
+      ? `Mission ${missionId} now escorts ${leadMissionId}`
+      : `Convoy proposed, waiting for the other organization to accept`,
+  });
+}));
+
+/**
+ * POST /api/missions/:missionId/convoy/accept
+ * Accept the convoy proposal of this (escort) mission
+ */
+router.post('/:missionId/convoy/accept', asyncHandler(async (req: Request, res: Response) => {
+  const { missionId } = req.params;
+
+  const mission = await withRetry(
+    () => missionService.acceptConvoy(missionId),
+    3,
+    `Accept convoy ${missionId}`
+  );
+
+  broadcastMessage({
+    type: 'CONVOY_LINKED',
+    payload: { mission, leadMissionId: mission.convoy?.leadMissionId },
+    timestamp: Date.now(),
+  });
+
+  res.json({
+    success: true,
+    data: mission,
+    message: `Mission ${missionId} now escorts ${mission.convoy?.leadMissionId}`,
+  });
+}));
+
+/**
+ * DELETE /api/missions/:missionId/convoy
+ * Leave a convoy, or withdraw or decline a proposal
+ */
+router.delete('/:missionId/convoy', asyncHandler(async (req: Request, res: Response) => {
+  const { missionId } = req.params;
+
+  const mission = await withRetry(
+    () => missionService.leaveConvoy(missionId),
+    3,
+    `Leave convoy ${missionId}`
+  );
+
+  broadcastMessage({
+    type: 'CONVOY_UNLINKED',
+    payload: { mission },
+    timestamp: Date.now(),
+  });
+
+  res.json({
+    success: true,
+    data: mission,
+    message: `Mission ${missionId} left its convoy`,
+  });
+}));
+
 /**
  * POST /api/missions/:missionId/complete
  * Complete an active mission
@@ -393,6 +714,7 @@ router.post('/:missionId/abort', asyncHandler(async (req: Request, res: Response
 router.post('/:missionId/reroute', asyncHandler(async (req: Request, res: Response) => {
   const { missionId } = req.params;
   const { newPath } = req.body;
+  let { nodePath } = req.body;
 
   if (!newPath || !Array.isArray(newPath)) {
     res.status(400).json({
@@ -402,7 +724,27 @@ router.post('/:missionId/reroute', asyncHandler(async (req: Request, res: Respon
     return;
   }
 
-  const mission = await missionService.updateMissionPath(missionId, newPath);
+  // The chaincode needs both endpoints of every step - derive them when not given
+  if (!Array.isArray(nodePath) || nodePath.length !== newPath.length + 1) {
+    const current = await couchdb.getMission(missionId);
+    if (!current) {
+      res.status(404).json({
+        success: false,
+        error: `Mission ${missionId} not found`,
+      });
+      return;
+    }
+    nodePath = routingService.nodePathEndingAt(newPath, current.destNode);
+    if (!nodePath) {
+      res.status(400).json({
+        success: false,
+        error: `Path does not connect to the mission destination ${current.destNode}`,
+      });
+      return;
+    }
+  }
+
+  const mission = await missionService.updateMissionPath(missionId, newPath, nodePath);
 
   // Broadcast to WebSocket clients
   broadcastMessage({
@@ -418,6 +760,49 @@ router.post('/:missionId/reroute', asyncHandler(async (req: Request, res: Respon
   });
 }));
 
+/**
+ * POST /api/missions/:missionId/priority
+ * Escalate or de-escalate a mission to a new incident severity
+ */
+router.post('/:missionId/priority', asyncHandler(async (req: Request, res: Response) => {
+  const { missionId } = req.params;
+  const { severity, reason } = req.body;
+
+  if (!SEVERITIES.includes(severity)) {
+    res.status(400).json({
+      success: false,
+      error: `severity must be one of: ${SEVERITIES.join(', ')}`,
+    });
+    return;
+  }
+  if (!reason) {
+    res.status(400).json({
+      success: false,
+      error: 'A reason is required to change mission priority',
+    });
+    return;
+  }
+
+  const mission = await withRetry(
+    () => missionService.updateMissionPriority(missionId, severity, reason),
+    3,
+    `Update priority of mission ${missionId}`
+  );
+
+  // Broadcast to WebSocket clients
+  broadcastMessage({
+    type: 'MISSION_PRIORITY_CHANGED',
+    payload: { mission, severity, reason },
+    timestamp: Date.now(),
+  });
+
+  res.json({
+    success: true,
+    data: mission,
+    message: `Mission ${missionId} priority is now ${mission.priorityLevel}`,
+  });
+}));
+
 /**
  * GET /api/missions/vehicle/:vehicleId
  * Get active mission for a specific vehicle
@@ -691,7 +1076,8 @@ router.post('/routes/alternatives', asyncHandler(async (req: Request, res: Respo
  * Includes conflict detection and automatic rerouting
  */
 router.post('/create-and-activate', asyncHandler(async (req: Request, res: Response) => {
-  const { vehicleId, originNode, destNode } = req.body;
+  const { vehicleId, originNode, destNode, category } = req.body;
+  const severity: Severity = req.body.severity;
 
   if (!vehicleId || !originNode || !destNode) {
     res.status(400).json({
@@ -700,8 +1086,15 @@ router.post('/create-and-activate', asyncHandler(async (req: Request, res: Respo
     });
     return;
   }
+  if (!SEVERITIES.includes(severity)) {
+    res.status(400).json({
+      success: false,
+      error: `severity is required and must be one of: ${SEVERITIES.join(', ')}`,
+    });
+    return;
+  }
 
-  // 1. Get vehicle priority
+  // 1. Get the mission priority the chaincode will assign for this severity
   const vehicle = await couchdb.getVehicle(vehicleId);
   if (!vehicle) {
     res.status(404).json({
@@ -710,7 +1103,7 @@ router.post('/create-and-activate', asyncHandler(async (req: Request, res: Respo
     });
     return;
   }
-  const vehiclePriority = vehicle.priorityLevel;
+  const vehiclePriority = await missionService.getEffectivePriority(vehicleId, severity);
 
   // 2. Get current segment statuses from CouchDB (bypasses chaincode schema validation)
   const segments = await couchdb.getAllSegments();
@@ -802,6 +1195,8 @@ router.post('/create-and-activate', asyncHandler(async (req: Request, res: Respo
     vehicleId,
     originNode,
     destNode,
+    severity,
+    category,
   });
 
   // 6. Handle preemptions if any
@@ -816,7 +1211,7 @@ router.post('/create-and-activate', asyncHandler(async (req: Request, res: Respo
   }
 
   // 7. Activate mission with calculated path
-  const activatedMission = await missionService.activateMission(mission.missionId, routeResult.path);
+  const activatedMission = await missionService.activateMission(mission.missionId, routeResult.path, routeResult.nodePath);
 
   // 8. Fetch OSRM geometry for accurate visualization and simulation
   try {
@@ -2,7 +2,7 @@ import { Router, Request, Response } from 'express';
 import * as segmentService from '../../services/fabric/segment.service';
 import * as couchdb from '../../services/couchdb';
 import conflictService from '../../services/conflict';
-import { ReserveSegmentRequest, ApiResponse, Segment, Conflict } from '../../models/types';
+import { ReserveSegmentRequest, ApiResponse, Segment, Node, Conflict } from '../../models/types';
 import { broadcastMessage } from '../../services/realtime/websocket';
 
 const router = Router();
@@ -18,7 +18,7 @@ router.get('/', async (req: Request, res: Response) => {
 
     let segments: Segment[];
 
-    if (status === 'free' || status === 'reserved' || status === 'occupied') {
+    if (status === 'free' || status === 'reserved' || status === 'occupied' || status === 'blocked') {
       segments = await couchdb.getSegmentsByStatus(status as string);
     } else {
       segments = await couchdb.getAllSegments();
@@ -40,6 +40,32 @@ router.get('/', async (req: Request, res: Response) => {
   }
 });
 
+/**
+ * GET /api/segments/nodes/:nodeId
+ * Get the reservations on an intersection
+ */
+router.get('/nodes/:nodeId', async (req: Request, res: Response) => {
+  try {
+    const { nodeId } = req.params;
+
+    const node = await segmentService.getNode(nodeId);
+
+    const response: ApiResponse<Node | null> = {
+      success: true,
+      data: node,
+    };
+
+    res.json(response);
+  } catch (error) {
+    console.error('Error getting node:', error);
+    const response: ApiResponse<null> = {
+      success: false,
+      error: error instanceof Error ? error.message : 'Failed to get node',
+    };
+    res.status(500).json(response);
+  }
+});
+
 /**
  * GET /api/segments/:id
  * Get a specific segment by ID
@@ -82,6 +108,8 @@ router.get('/:id', async (req: Request, res: Response) => {
 /**
  * POST /api/segments/reserve
  * Reserve a segment for a vehicle/mission
+ * With queue: true, a lower priority request waits on the segment's waitlist;
+ * it gives fromNode and toNode, and must close a gap in the mission's path
  */
 router.post('/reserve', async (req: Request, res: Response) => {
   try {
@@ -102,6 +130,13 @@ router.post('/reserve', async (req: Request, res: Response) => {
       });
     }
 
+    if (request.queue && (!request.fromNode || !request.toNode)) {
+      return res.status(400).json({
+        success: false,
+        error: 'A queued request needs both fromNode and toNode',
+      });
+    }
+
     const conflict = await segmentService.reserveSegment(request);
 
     // Get updated segment via CouchDB (avoids chaincode schema validation issues)
@@ -131,6 +166,16 @@ router.post('/reserve', async (req: Request, res: Response) => {
       return res.status(409).json(response);
     }
 
+    // Queued requests are granted automatically when the window frees up
+    if (request.queue && segment?.waitlist?.some(r => r.missionId === request.missionId)) {
+      const response: ApiResponse<Segment | null> = {
+        success: true,
+        data: segment,
+        message: `Mission ${request.missionId} queued for segment ${request.segmentId}`,
+      };
+      return res.status(202).json(response);
+    }
+
     const response: ApiResponse<Segment | null> = {
       success: true,
       data: segment,
@@ -241,6 +286,137 @@ router.post('/:id/occupy', async (req: Request, res: Response) => {
   }
 });
 
+/**
+ * POST /api/segments/:id/block
+ * Close a segment to traffic (traffic authority only)
+ * Active missions reserved across the closure are flagged for reroute
+ */
+router.post('/:id/block', async (req: Request, res: Response) => {
+  try {
+    const { id } = req.params;
+    const { reason, startAt, endAt } = req.body;
+
+    if (!reason) {
+      return res.status(400).json({
+        success: false,
+        error: 'reason is required',
+      });
+    }
+
+    await segmentService.blockSegment(id, reason, startAt ?? 0, endAt ?? 0);
+
+    // Get updated segment via CouchDB (avoids chaincode schema validation issues)
+    await new Promise(resolve => setTimeout(resolve, 100));
+    const segment = await couchdb.getSegment(id);
+
+    // Broadcast update via WebSocket
+    broadcastMessage({
+      type: 'SEGMENT_UPDATED',
+      payload: { action: 'blocked', segment },
+      timestamp: Date.now(),
+    });
+
+    const response: ApiResponse<Segment | null> = {
+      success: true,
+      data: segment,
+      message: `Segment ${id} blocked: ${reason}`,
+    };
+
+    res.json(response);
+  } catch (error) {
+    console.error('Error blocking segment:', error);
+    const response: ApiResponse<null> = {
+      success: false,
+      error: error instanceof Error ? error.message : 'Failed to block segment',
+    };
+    res.status(500).json(response);
+  }
+});
+
+/**
+ * DELETE /api/segments/:id/block
+ * Reopen a segment closed by this organization
+ */
+router.delete('/:id/block', async (req: Request, res: Response) => {
+  try {
+    const { id } = req.params;
+
+    await segmentService.unblockSegment(id);
+
+    // Get updated segment via CouchDB (avoids chaincode schema validation issues)
+    await new Promise(resolve => setTimeout(resolve, 100));
+    const segment = await couchdb.getSegment(id);
+
+    // Broadcast update via WebSocket
+    broadcastMessage({
+      type: 'SEGMENT_UPDATED',
+      payload: { action: 'unblocked', segment },
+      timestamp: Date.now(),
+    });
+
+    const response: ApiResponse<Segment | null> = {
+      success: true,
+      data: segment,
+      message: `Segment ${id} reopened`,
+    };
+
+    res.json(response);
+  } catch (error) {
+    console.error('Error unblocking segment:', error);
+    const response: ApiResponse<null> = {
+      success: false,
+      error: error instanceof Error ? error.message : 'Failed to unblock segment',
+    };
+    res.status(500).json(response);
+  }
+});
+
+/**
+ * POST /api/segments/:id/capacity
+ * Set how many vehicles may hold a segment at once per direction (traffic authority only)
+ */
+router.post('/:id/capacity', async (req: Request, res: Response) => {
+  try {
+    const { id } = req.params;
+    const { capacity } = req.body;
+
+    if (!Number.isInteger(capacity) || capacity < 1) {
+      return res.status(400).json({
+        success: false,
+        error: 'capacity must be a positive integer',
+      });
+    }
+
+    await segmentService.setSegmentCapacity(id, capacity);
+
+    // Get updated segment via CouchDB (avoids chaincode schema validation issues)
+    await new Promise(resolve => setTimeout(resolve, 100));
+    const segment = await couchdb.getSegment(id);
+
+    // Broadcast update via WebSocket
+    broadcastMessage({
+      type: 'SEGMENT_UPDATED',
+      payload: { action: 'capacity_changed', segment },
+      timestamp: Date.now(),
+    });
+
+    const response: ApiResponse<Segment | null> = {
+      success: true,
+      data: segment,
+      message: `Segment ${id} capacity set to ${capacity}`,
+    };
+
+    res.json(response);
+  } catch (error) {
+    console.error('Error setting segment capacity:', error);
+    const response: ApiResponse<null> = {
+      success: false,
+      error: error instanceof Error ? error.message : 'Failed to set segment capacity',
+    };
+    res.status(500).json(response);
+  }
+});
+
 /**
  * GET /api/segments/conflicts/pending
  * Get all pending conflicts
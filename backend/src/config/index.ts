@@ -35,6 +35,10 @@ export const config = {
   peerEndpoint: orgType === 'police' ? 'localhost:9051' : 'localhost:7051',
   peerHostAlias: orgType === 'police' ? 'peer0.police.emergency.net' : 'peer0.medical.emergency.net',
 
+  // User that signs road closures; its certificate carries role=authority
+  // (issued by blockchain/network/scripts/enroll-authority.sh)
+  authorityUser: process.env.AUTHORITY_USER || 'Authority',
+
   // Paths
   paths: {
     networkPath,
@@ -42,8 +46,8 @@ export const config = {
   },
 };
 
-// Get crypto paths based on organization
-export function getCryptoPaths(orgType: 'medical' | 'police' = 'medical') {
+// Get crypto paths based on organization and user (Admin signs everything but road closures)
+export function getCryptoPaths(orgType: 'medical' | 'police' = 'medical', user = 'Admin') {
   const orgDomain = orgType === 'medical'
     ? 'medical.emergency.net'
     : 'police.emergency.net';
@@ -60,8 +64,8 @@ export function getCryptoPaths(orgType: 'medical' | 'police' = 'medical') {
 
   return {
     tlsCertPath: path.join(orgPath, 'peers', peerName, 'tls', 'ca.crt'),
-    certPath: path.join(orgPath, 'users', `Admin@${orgDomain}`, 'msp', 'signcerts'),
-    keyPath: path.join(orgPath, 'users', `Admin@${orgDomain}`, 'msp', 'keystore'),
+    certPath: path.join(orgPath, 'users', `${user}@${orgDomain}`, 'msp', 'signcerts'),
+    keyPath: path.join(orgPath, 'users', `${user}@${orgDomain}`, 'msp', 'keystore'),
     mspId: orgType === 'medical' ? 'MedicalMSP' : 'PoliceMSP',
     peerEndpoint: orgType === 'medical' ? 'localhost:7051' : 'localhost:9051',
     peerHostAlias: peerName,
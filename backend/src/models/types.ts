@@ -28,23 +28,80 @@ export interface Mission {
   destNode: string;
   path: string[];
   geometry?: Array<[number, number]>; // OSRM geometry for route visualization
-  status: 'pending' | 'active' | 'completed' | 'aborted';
+  status: 'pending' | 'active' | 'needs_reroute' | 'stale' | 'completed' | 'aborted';
   createdAt: number;
   activatedAt?: number;
   completedAt?: number;
   createdBy: string;
+  leaseExpiresAt?: number; // Reservations expire unless renewed before this
+  currentIndex?: number; // Index in path of the segment the vehicle is on (-1 before entering)
+  staleReason?: string;
+  severity?: Severity; // Incident severity that set priorityLevel
+  category?: string; // Incident category (e.g., "cardiac_arrest")
+  waypoints?: Waypoint[]; // Ordered stops of a multi-stop mission (the last one is destNode)
+  currentLeg?: number; // Index in waypoints of the leg being driven
+  handoffs?: Handoff[]; // Vehicles the mission was handed over from, oldest first
+  convoy?: ConvoyLink; // Link to the lead mission this mission escorts
+  convoyMembers?: string[]; // Missions escorting this one
+  nodes?: string[]; // Intersections reserved along the path, in travel order
+  steps?: PathStep[]; // path with each segment's endpoints and ETA window
 }
 
+// One step of a mission path: a segment and the intersections it is driven between
+// The chaincode rejects mission paths whose steps lack either endpoint
+export interface PathStep {
+  segmentId: string;
+  fromNode: string;
+  toNode: string;
+  enterAt?: number;
+  exitAt?: number;
+}
+
+// Link from an escort mission to the lead mission it travels with
+export interface ConvoyLink {
+  leadMissionId: string;
+  status: 'proposed' | 'accepted';
+  leadAccepted: boolean;
+  memberAccepted: boolean;
+  proposedBy: string;
+  proposedAt: number;
+  acceptedAt: number;
+}
+
+// A mission moved from one vehicle to another of the same org
+export interface Handoff {
+  fromVehicleId: string;
+  toVehicleId: string;
+  keptSegments: string[]; // Reservations carried over without being released
+  handedOffAt: number;
+  handedOffBy: string;
+}
+
+// A stop of a multi-stop mission and the leg that leads to it
+export interface Waypoint {
+  nodeId: string;
+  label?: string; // e.g., "scene", "hospital"
+  path: string[]; // Segment IDs of the leg ending at this stop
+  status: 'pending' | 'active' | 'reached';
+  reachedAt: number;
+}
+
+export type Severity = 'critical' | 'high' | 'medium' | 'low';
+
 export interface CreateMissionRequest {
   missionId?: string;  // Auto-generated if not provided
   vehicleId: string;
   originNode: string;
   destNode: string;
+  severity: Severity;
+  category?: string;
+  stops?: Array<{ nodeId: string; label?: string }>; // Multi-stop mission: ordered stops, the last one replaces destNode
 }
 
 export interface ActivateMissionRequest {
   missionId: string;
   path: string[];
+  nodePath?: string[]; // Derived from the map when omitted
 }
 
 export interface RouteRequest {
@@ -89,12 +146,51 @@ export interface Segment {
   segmentId: string;
   fromNode: string;
   toNode: string;
-  status: 'free' | 'reserved' | 'occupied';
+  status: 'free' | 'reserved' | 'occupied' | 'blocked';
   reservedBy?: string;
   missionId?: string;
   orgType?: string;
   priorityLevel?: number;
   reservedAt?: number;
+  reservations?: SegmentReservation[];
+  blockage?: SegmentBlockage; // Road closure, absent while the segment is open
+  capacity?: number;  // Concurrent reservations per direction, absent = 1
+  holders?: string[]; // Vehicles sharing the segment with the current reservation
+  waitlist?: SegmentReservation[]; // Queued requests, highest priority first
+}
+
+// Reservation state of an intersection
+export interface Node {
+  docType: string;
+  nodeId: string;
+  status: 'free' | 'reserved';
+  reservations: SegmentReservation[];
+  queued?: string[]; // Segments whose queued requests wait for this intersection
+}
+
+// Road closure issued by a traffic authority
+export interface SegmentBlockage {
+  reason: string;
+  startAt: number; // Closure start (Unix seconds)
+  endAt: number;   // Closure end, 0 = until unblocked
+  blockedBy: string; // MSP ID of the issuing org
+  orgType: string;
+  blockedAt: number;
+}
+
+export interface SegmentReservation {
+  missionId: string;
+  vehicleId: string;
+  orgType: string;
+  priorityLevel: number;
+  status: 'reserved' | 'occupied' | 'queued';
+  enterAt: number;
+  exitAt: number;
+  reservedAt: number;
+  leaseExpiresAt: number;
+  direction?: string; // Node the vehicle enters from, absent = either direction
+  toNode?: string;    // Node the vehicle leaves by, when the path gave it
+  via?: string;       // On a node, the segment the vehicle arrives by (leaves by at the start of its path)
 }
 
 export interface ReserveSegmentRequest {
@@ -102,6 +198,11 @@ export interface ReserveSegmentRequest {
   vehicleId: string;
   missionId: string;
   priorityLevel: number;
+  enterAt?: number; // Expected entry time (Unix seconds), defaults to now
+  exitAt?: number;  // Expected exit time (Unix seconds), 0 = open-ended
+  fromNode?: string; // Node the vehicle enters from, omitted = either direction
+  toNode?: string;   // Node the vehicle leaves by, required with queue
+  queue?: boolean;   // Wait on the segment's waitlist instead of being denied
 }
 
 // Conflict types
@@ -118,6 +219,80 @@ export interface Conflict {
   resolvedBy?: string;
   resolvedAt?: number;
   createdAt: number;
+  nodeId?: string; // Contested intersection (segmentId is empty)
+  vehicle1Id?: string;
+  vehicle2Id?: string;
+  orgType1?: string;
+  orgType2?: string;
+}
+
+// Audit types
+export interface AuditEvent {
+  docType: string;
+  eventId: string;
+  eventType: string;
+  timestamp: number;
+  orgType: string;
+  actorId: string;
+  missionId?: string;
+  vehicleId?: string;
+  segmentId?: string;
+  details?: Record<string, unknown>;
+  txId: string;
+  entityType: AuditEntityType; // Type of the entity whose chain this copy belongs to
+  entityId: string; // Chain the entry belongs to (one copy per mission, vehicle and segment involved)
+  sequence: number;
+  prevHash?: string;
+  hash: string;
+}
+
+export type AuditEntityType = 'mission' | 'vehicle' | 'segment' | 'org';
+
+export interface AuditChainReport {
+  entityType: AuditEntityType;
+  entityId: string;
+  valid: boolean;
+  entries: number;
+  firstBadEntry: number; // 0 if valid
+  problem?: string;
+}
+
+export interface AuditTrailFilter {
+  missionId?: string;
+  vehicleId?: string;
+  segmentId?: string;
+  actorId?: string;
+  fromTime?: number; // Unix seconds, inclusive
+  toTime?: number;   // Unix seconds, inclusive
+}
+
+// Paginated query result; pass bookmark back to fetch the next page
+export interface Page<T> {
+  records: T[];
+  bookmark: string;
+  fetchedCount: number;
+}
+
+// Key history types (one committed version per entry, oldest first)
+export interface MissionVersion {
+  txId: string;
+  timestamp: number; // Unix seconds
+  isDelete: boolean;
+  mission?: Mission; // Absent on delete
+}
+
+export interface VehicleVersion {
+  txId: string;
+  timestamp: number;
+  isDelete: boolean;
+  vehicle?: Vehicle;
+}
+
+export interface SegmentVersion {
+  txId: string;
+  timestamp: number;
+  isDelete: boolean;
+  segment?: Segment;
 }
 
 // Map types
@@ -184,19 +184,12 @@ export async function rerouteMission(
         const segmentMap = new Map<string, Segment>();
         segments.forEach(seg => segmentMap.set(seg.segmentId, seg));
 
-        // Find the vehicle's current position (first segment in path that's still reserved/occupied)
-        // For now, assume vehicle is at the start of its path
-        // In a real implementation, we'd check simulation state for current position
-
-        // Get origin node from the current path
+        // Start where the chaincode accepts a new path: the entry of the segment
+        // the vehicle is on, or the mission origin before it entered one
         let startNode = mission.originNode;
-
-        // If mission is active and has a path, try to find current position
-        if (mission.path && mission.path.length > 0) {
-            const firstSegment = segmentMap.get(mission.path[0]);
-            if (firstSegment) {
-                startNode = firstSegment.fromNode;
-            }
+        const currentIndex = mission.currentIndex ?? -1;
+        if (mission.steps && mission.steps.length === mission.path.length && currentIndex >= 0) {
+            startNode = mission.steps[currentIndex].fromNode;
         }
 
         // Calculate new route excluding the contested segments
@@ -220,7 +213,7 @@ export async function rerouteMission(
         console.log(`[ConflictService] Found alternative route for ${missionId}: ${newRoute.path.join(' -> ')}`);
 
         // Update the mission with the new path
-        await missionService.updateMissionPath(missionId, newRoute.path);
+        await missionService.updateMissionPath(missionId, newRoute.path, newRoute.nodePath);
 
         // Broadcast reroute event
         broadcastMessage({
@@ -310,11 +303,16 @@ export async function checkSegmentAvailability(
             return { available: true };
         }
 
-        // If segment is occupied, it's never available
-        if (segment.status === 'occupied') {
+        // If segment is occupied or closed, it's never available
+        if (segment.status === 'occupied' || segment.status === 'blocked') {
             return { available: false };
         }
 
+        // A multi-lane segment with a lane still free takes one more vehicle
+        if ((segment.holders?.length ?? 1) < (segment.capacity || 1)) {
+            return { available: true };
+        }
+
         // Segment is reserved - check priority and organization
         if (segment.status === 'reserved' && segment.missionId) {
             const existingMissionId = segment.missionId;
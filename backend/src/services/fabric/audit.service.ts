@@ -0,0 +1,52 @@
+/**
+ * Audit Service - Fabric chaincode queries over the audit trail
+ */
+
+import { getContract } from './gateway';
+import { AuditEvent, AuditTrailFilter, AuditChainReport, AuditEntityType } from '../../models/types';
+
+const CONTRACT_NAME = 'AuditContract';
+
+/**
+ * Get audit entries matching every filter that is set, oldest first
+ */
+export async function getAuditTrail(filter: AuditTrailFilter = {}): Promise<AuditEvent[]> {
+  const contract = await getContract();
+
+  const resultBytes = await contract.evaluateTransaction(
+    `${CONTRACT_NAME}:GetAuditTrail`,
+    filter.missionId || '',
+    filter.vehicleId || '',
+    filter.segmentId || '',
+    filter.actorId || '',
+    String(filter.fromTime || 0),
+    String(filter.toTime || 0)
+  );
+
+  const resultString = Buffer.from(resultBytes).toString('utf8');
+  const entries = JSON.parse(resultString) as AuditEvent[];
+
+  return entries || [];
+}
+
+/**
+ * Recompute the audit hash chain of a mission, vehicle, segment or org
+ * IDs are only unique within a type, so the chain is named by both
+ */
+export async function verifyAuditChain(entityType: AuditEntityType, entityId: string): Promise<AuditChainReport> {
+  const contract = await getContract();
+
+  const resultBytes = await contract.evaluateTransaction(
+    `${CONTRACT_NAME}:VerifyAuditChain`,
+    entityType,
+    entityId
+  );
+
+  const resultString = Buffer.from(resultBytes).toString('utf8');
+  return JSON.parse(resultString) as AuditChainReport;
+}
+
+export default {
+  getAuditTrail,
+  verifyAuditChain,
+};
@@ -9,6 +9,8 @@ import { config, getCryptoPaths } from '../../config';
 let gatewayInstance: Gateway | null = null;
 let clientInstance: grpc.Client | null = null;
 let networkInstance: Network | null = null;
+let authorityGatewayInstance: Gateway | null = null;
+let connectedOrg: 'medical' | 'police' = 'medical';
 
 /**
  * Create a new gRPC connection to the peer
@@ -31,8 +33,8 @@ async function newGrpcConnection(orgType: 'medical' | 'police' = 'medical'): Pro
 /**
  * Create identity from X.509 certificate
  */
-async function newIdentity(orgType: 'medical' | 'police' = 'medical'): Promise<Identity> {
-  const cryptoPaths = getCryptoPaths(orgType);
+async function newIdentity(orgType: 'medical' | 'police' = 'medical', user = 'Admin'): Promise<Identity> {
+  const cryptoPaths = getCryptoPaths(orgType, user);
 
   // Find the certificate file
   const certDir = cryptoPaths.certPath;
@@ -51,8 +53,8 @@ async function newIdentity(orgType: 'medical' | 'police' = 'medical'): Promise<I
 /**
  * Create signer from private key
  */
-async function newSigner(orgType: 'medical' | 'police' = 'medical'): Promise<Signer> {
-  const cryptoPaths = getCryptoPaths(orgType);
+async function newSigner(orgType: 'medical' | 'police' = 'medical', user = 'Admin'): Promise<Signer> {
+  const cryptoPaths = getCryptoPaths(orgType, user);
 
   // Find the private key file
   const keyDir = cryptoPaths.keyPath;
@@ -83,6 +85,7 @@ export async function connectGateway(orgType: 'medical' | 'police' = 'medical'):
 
   const client = await newGrpcConnection(orgType);
   clientInstance = client;
+  connectedOrg = orgType;
 
   const gateway = connect({
     client,
@@ -122,6 +125,36 @@ export async function getContract(contractName?: string): Promise<Contract> {
   return networkInstance.getContract(config.chaincodeName, contractName);
 }
 
+/**
+ * Get the routing chaincode contract signed by the org's traffic authority user
+ * Road closures (BlockSegment, UnblockSegment, SetSegmentCapacity) require the
+ * "authority" role, which the Admin certificate does not carry
+ */
+export async function getAuthorityContract(contractName?: string): Promise<Contract> {
+  if (!clientInstance) {
+    await connectGateway();
+  }
+
+  if (!clientInstance) {
+    throw new Error('Failed to connect to network');
+  }
+
+  if (!authorityGatewayInstance) {
+    authorityGatewayInstance = connect({
+      client: clientInstance,
+      identity: await newIdentity(connectedOrg, config.authorityUser),
+      signer: await newSigner(connectedOrg, config.authorityUser),
+      evaluateOptions: () => ({ deadline: Date.now() + 5000 }), // 5 seconds
+      submitOptions: () => ({ deadline: Date.now() + 5000 }), // 5 seconds
+      commitStatusOptions: () => ({ deadline: Date.now() + 60000 }), // 60 seconds
+    });
+  }
+
+  return authorityGatewayInstance
+    .getNetwork(config.channelName)
+    .getContract(config.chaincodeName, contractName);
+}
+
 /**
  * Helper to decode Uint8Array result to string and parse as JSON
  */
@@ -152,6 +185,11 @@ export function decodeResultOrDefault<T>(result: Uint8Array, defaultValue: T): T
  * Disconnect from the Fabric Gateway
  */
 export async function disconnectGateway(): Promise<void> {
+  if (authorityGatewayInstance) {
+    authorityGatewayInstance.close();
+    authorityGatewayInstance = null;
+  }
+
   if (gatewayInstance) {
     gatewayInstance.close();
     gatewayInstance = null;
@@ -3,4 +3,5 @@ export * from './gateway';
 export * as vehicleService from './vehicle.service';
 export * as segmentService from './segment.service';
 export * as missionService from './mission.service';
+export * as auditService from './audit.service';
 
@@ -3,12 +3,13 @@
  */
 
 import { getContract } from './gateway';
-import { Mission, CreateMissionRequest, ActivateMissionRequest } from '../../models/types';
+import { Mission, MissionVersion, Page, PathStep, Severity, CreateMissionRequest, ActivateMissionRequest } from '../../models/types';
 
 const CONTRACT_NAME = 'MissionContract';
 
 /**
  * Create a new mission (pending state)
+ * The chaincode derives the mission priority from the vehicle type and incident severity
  */
 export async function createMission(request: CreateMissionRequest): Promise<Mission> {
   const contract = await getContract();
@@ -18,28 +19,55 @@ export async function createMission(request: CreateMissionRequest): Promise<Miss
   
   console.log(`Creating mission ${missionId} for vehicle ${request.vehicleId}`);
   
+  if (request.stops && request.stops.length > 0) {
+    await contract.submitTransaction(
+      `${CONTRACT_NAME}:CreateMultiStopMission`,
+      missionId,
+      request.vehicleId,
+      request.originNode,
+      JSON.stringify(request.stops),
+      request.severity,
+      request.category || ''
+    );
+    return getMission(missionId);
+  }
+
   const result = await contract.submitTransaction(
     `${CONTRACT_NAME}:CreateMission`,
     missionId,
     request.vehicleId,
     request.originNode,
-    request.destNode
+    request.destNode,
+    request.severity,
+    request.category || ''
   );
 
   // Fetch the created mission
   return getMission(missionId);
 }
 
+/**
+ * Pair each segment of a path with the intersections it is driven between
+ * nodePath is the route's node path, one more node than segments
+ */
+export function toPathSteps(path: string[], nodePath: string[]): PathStep[] {
+  if (nodePath.length !== path.length + 1) {
+    throw new Error(`A path of ${path.length} segments needs ${path.length + 1} nodes, got ${nodePath.length}`);
+  }
+  return path.map((segmentId, i) => ({ segmentId, fromNode: nodePath[i], toNode: nodePath[i + 1] }));
+}
+
 /**
  * Activate a pending mission with a calculated path
+ * The chaincode reserves the segments and the intersections of the route's node path
  */
-export async function activateMission(missionId: string, path: string[]): Promise<Mission> {
+export async function activateMission(missionId: string, path: string[], nodePath: string[]): Promise<Mission> {
   const contract = await getContract();
   
   console.log(`Activating mission ${missionId} with path: ${path.join(' -> ')}`);
   
   // Convert path array to JSON string for chaincode
-  const pathJSON = JSON.stringify(path);
+  const pathJSON = JSON.stringify(toPathSteps(path, nodePath));
   
   await contract.submitTransaction(
     `${CONTRACT_NAME}:ActivateMission`,
@@ -51,6 +79,122 @@ export async function activateMission(missionId: string, path: string[]): Promis
   return getMission(missionId);
 }
 
+/**
+ * Activate a pending multi-stop mission with one path per leg
+ */
+export async function activateMissionLegs(missionId: string, legs: PathStep[][]): Promise<Mission> {
+  const contract = await getContract();
+
+  console.log(`Activating mission ${missionId} with ${legs.length} legs`);
+
+  await contract.submitTransaction(
+    `${CONTRACT_NAME}:ActivateMission`,
+    missionId,
+    JSON.stringify(legs)
+  );
+
+  // Fetch the updated mission
+  return getMission(missionId);
+}
+
+/**
+ * Record that a multi-stop mission reached the stop ending its current leg
+ * The leg's segments are released; reaching the last stop completes the mission
+ */
+export async function reachWaypoint(missionId: string, nodeId: string): Promise<Mission> {
+  const contract = await getContract();
+
+  console.log(`Mission ${missionId} reached waypoint ${nodeId}`);
+
+  await contract.submitTransaction(
+    `${CONTRACT_NAME}:ReachWaypoint`,
+    missionId,
+    nodeId
+  );
+
+  // Fetch the updated mission
+  return getMission(missionId);
+}
+
+/**
+ * Move an underway mission and its reservations to another vehicle of the same org
+ * path is one list of steps, or one per leg not yet driven for a multi-stop mission
+ */
+export async function handoffMission(missionId: string, newVehicleId: string, path: PathStep[] | PathStep[][]): Promise<Mission> {
+  const contract = await getContract();
+
+  console.log(`Handing off mission ${missionId} to vehicle ${newVehicleId}`);
+
+  await contract.submitTransaction(
+    `${CONTRACT_NAME}:HandoffMission`,
+    missionId,
+    newVehicleId,
+    JSON.stringify(path)
+  );
+
+  // Fetch the updated mission
+  return getMission(missionId);
+}
+
+/**
+ * Propose that a mission escorts a lead mission
+ * A link between two orgs takes effect once the other org accepts it
+ */
+export async function proposeConvoy(memberMissionId: string, leadMissionId: string): Promise<Mission> {
+  const contract = await getContract();
+
+  await contract.submitTransaction(
+    `${CONTRACT_NAME}:ProposeConvoy`,
+    memberMissionId,
+    leadMissionId
+  );
+
+  return getMission(memberMissionId);
+}
+
+/**
+ * Accept a convoy proposal on behalf of this org
+ */
+export async function acceptConvoy(memberMissionId: string): Promise<Mission> {
+  const contract = await getContract();
+
+  await contract.submitTransaction(
+    `${CONTRACT_NAME}:AcceptConvoy`,
+    memberMissionId
+  );
+
+  return getMission(memberMissionId);
+}
+
+/**
+ * Leave a convoy, or withdraw or decline a proposal
+ */
+export async function leaveConvoy(memberMissionId: string): Promise<Mission> {
+  const contract = await getContract();
+
+  await contract.submitTransaction(
+    `${CONTRACT_NAME}:LeaveConvoy`,
+    memberMissionId
+  );
+
+  return getMission(memberMissionId);
+}
+
+/**
+ * Get the missions escorting a lead mission
+ */
+export async function getConvoyMembers(leadMissionId: string): Promise<Mission[]> {
+  const contract = await getContract();
+
+  const resultBytes = await contract.evaluateTransaction(
+    `${CONTRACT_NAME}:GetConvoyMembers`,
+    leadMissionId
+  );
+
+  const resultString = Buffer.from(resultBytes).toString('utf8');
+  return (JSON.parse(resultString) as Mission[]) || [];
+}
+
 /**
  * Complete an active mission
  */
@@ -117,6 +261,22 @@ export async function getAllMissions(): Promise<Mission[]> {
   return missions || [];
 }
 
+/**
+ * Get one page of missions in ID order (empty bookmark for the first page)
+ */
+export async function getAllMissionsPage(pageSize: number, bookmark = ''): Promise<Page<Mission>> {
+  const contract = await getContract();
+
+  const resultBytes = await contract.evaluateTransaction(
+    `${CONTRACT_NAME}:GetAllMissionsWithPagination`,
+    String(pageSize),
+    bookmark
+  );
+
+  const resultString = Buffer.from(resultBytes).toString('utf8');
+  return JSON.parse(resultString) as Page<Mission>;
+}
+
 /**
  * Get all active missions
  */
@@ -150,6 +310,23 @@ export async function getMissionsByStatus(status: string): Promise<Mission[]> {
   return missions || [];
 }
 
+/**
+ * Get one page of missions by status
+ */
+export async function getMissionsByStatusPage(status: string, pageSize: number, bookmark = ''): Promise<Page<Mission>> {
+  const contract = await getContract();
+
+  const resultBytes = await contract.evaluateTransaction(
+    `${CONTRACT_NAME}:GetMissionsByStatusWithPagination`,
+    status,
+    String(pageSize),
+    bookmark
+  );
+
+  const resultString = Buffer.from(resultBytes).toString('utf8');
+  return JSON.parse(resultString) as Page<Mission>;
+}
+
 /**
  * Get missions by organization
  */
@@ -167,6 +344,23 @@ export async function getMissionsByOrg(orgType: string): Promise<Mission[]> {
   return missions || [];
 }
 
+/**
+ * Get one page of missions by organization
+ */
+export async function getMissionsByOrgPage(orgType: string, pageSize: number, bookmark = ''): Promise<Page<Mission>> {
+  const contract = await getContract();
+
+  const resultBytes = await contract.evaluateTransaction(
+    `${CONTRACT_NAME}:GetMissionsByOrgWithPagination`,
+    orgType,
+    String(pageSize),
+    bookmark
+  );
+
+  const resultString = Buffer.from(resultBytes).toString('utf8');
+  return JSON.parse(resultString) as Page<Mission>;
+}
+
 /**
  * Get active mission for a specific vehicle
  */
@@ -189,13 +383,14 @@ export async function getVehicleActiveMission(vehicleId: string): Promise<Missio
 
 /**
  * Update mission path (re-routing)
+ * The new path must start where the vehicle is: its leg's start or the segment it is on
  */
-export async function updateMissionPath(missionId: string, newPath: string[]): Promise<Mission> {
+export async function updateMissionPath(missionId: string, newPath: string[], nodePath: string[]): Promise<Mission> {
   const contract = await getContract();
   
   console.log(`Updating path for mission ${missionId}`);
   
-  const pathJSON = JSON.stringify(newPath);
+  const pathJSON = JSON.stringify(toPathSteps(newPath, nodePath));
   
   await contract.submitTransaction(
     `${CONTRACT_NAME}:UpdateMissionPath`,
@@ -207,17 +402,108 @@ export async function updateMissionPath(missionId: string, newPath: string[]): P
   return getMission(missionId);
 }
 
+/**
+ * Renew the reservation lease of an active mission (heartbeat)
+ * Reservations that are not renewed expire on the ledger
+ */
+export async function renewLease(missionId: string): Promise<void> {
+  const contract = await getContract();
+
+  await contract.submitTransaction(
+    `${CONTRACT_NAME}:RenewLease`,
+    missionId
+  );
+}
+
+export async function advanceMission(missionId: string, segmentId: string): Promise<void> {
+  const contract = await getContract();
+
+  await contract.submitTransaction(
+    `${CONTRACT_NAME}:AdvanceMission`,
+    missionId,
+    segmentId
+  );
+}
+
+/**
+ * Escalate or de-escalate a mission to a new incident severity
+ * The new priority also applies to every segment the mission still holds
+ */
+export async function updateMissionPriority(missionId: string, severity: Severity, reason: string): Promise<Mission> {
+  const contract = await getContract();
+
+  console.log(`Changing severity of mission ${missionId} to ${severity}: ${reason}`);
+
+  await contract.submitTransaction(
+    `${CONTRACT_NAME}:UpdateMissionPriority`,
+    missionId,
+    severity,
+    reason
+  );
+
+  // Fetch the updated mission
+  return getMission(missionId);
+}
+
+/**
+ * Get the priority a mission for this vehicle would get at a severity
+ */
+export async function getEffectivePriority(vehicleId: string, severity: Severity): Promise<number> {
+  const contract = await getContract();
+
+  const resultBytes = await contract.evaluateTransaction(
+    `${CONTRACT_NAME}:GetEffectivePriority`,
+    vehicleId,
+    severity
+  );
+
+  return Number(Buffer.from(resultBytes).toString('utf8'));
+}
+
+/**
+ * Get every committed version of a mission, oldest first
+ * fromTime and toTime (Unix seconds, inclusive) bound the range; 0 leaves a side open
+ */
+export async function getMissionHistory(missionId: string, fromTime = 0, toTime = 0): Promise<MissionVersion[]> {
+  const contract = await getContract();
+
+  const resultBytes = await contract.evaluateTransaction(
+    `${CONTRACT_NAME}:GetMissionHistory`,
+    missionId,
+    String(fromTime),
+    String(toTime)
+  );
+
+  const resultString = Buffer.from(resultBytes).toString('utf8');
+  return (JSON.parse(resultString) as MissionVersion[]) || [];
+}
+
 export default {
   createMission,
   activateMission,
+  activateMissionLegs,
+  reachWaypoint,
+  handoffMission,
+  proposeConvoy,
+  acceptConvoy,
+  leaveConvoy,
+  getConvoyMembers,
   completeMission,
   abortMission,
   getMission,
   getAllMissions,
+  getAllMissionsPage,
   getActiveMissions,
   getMissionsByStatus,
+  getMissionsByStatusPage,
   getMissionsByOrg,
+  getMissionsByOrgPage,
   getVehicleActiveMission,
   updateMissionPath,
+  renewLease,
+  advanceMission,
+  updateMissionPriority,
+  getEffectivePriority,
+  getMissionHistory,
 };
 
@@ -1,5 +1,5 @@
-import { getContract, decodeResult, decodeResultOrDefault } from './gateway';
-import { Segment, Conflict, ReserveSegmentRequest } from '../../models/types';
+import { getContract, getAuthorityContract, decodeResult, decodeResultOrDefault } from './gateway';
+import { Segment, Node, SegmentVersion, Page, Conflict, ReserveSegmentRequest } from '../../models/types';
 
 const CONTRACT_NAME = 'SegmentContract';
 
@@ -13,6 +13,16 @@ export async function getSegment(segmentId: string): Promise<Segment> {
   return decodeResult<Segment>(result);
 }
 
+/**
+ * Get an intersection's reservations (null if no path has crossed it yet)
+ */
+export async function getNode(nodeId: string): Promise<Node | null> {
+  const contract = await getContract(CONTRACT_NAME);
+
+  const result = await contract.evaluateTransaction('GetNode', nodeId);
+  return decodeResultOrDefault<Node | null>(result, null);
+}
+
 /**
  * Get all segments
  */
@@ -23,11 +33,21 @@ export async function getAllSegments(): Promise<Segment[]> {
   return decodeResultOrDefault<Segment[]>(result, []);
 }
 
+/**
+ * Get one page of segments in ID order (empty bookmark for the first page)
+ */
+export async function getAllSegmentsPage(pageSize: number, bookmark = ''): Promise<Page<Segment>> {
+  const contract = await getContract(CONTRACT_NAME);
+
+  const result = await contract.evaluateTransaction('GetAllSegmentsWithPagination', String(pageSize), bookmark);
+  return decodeResult<Page<Segment>>(result);
+}
+
 /**
  * Get segments by status
  */
 export async function getSegmentsByStatus(
-  status: 'free' | 'reserved' | 'occupied'
+  status: 'free' | 'reserved' | 'occupied' | 'blocked'
 ): Promise<Segment[]> {
   const contract = await getContract(CONTRACT_NAME);
   
@@ -35,22 +55,43 @@ export async function getSegmentsByStatus(
   return decodeResultOrDefault<Segment[]>(result, []);
 }
 
+/**
+ * Get one page of segments by status
+ */
+export async function getSegmentsByStatusPage(
+  status: 'free' | 'reserved' | 'occupied' | 'blocked',
+  pageSize: number,
+  bookmark = ''
+): Promise<Page<Segment>> {
+  const contract = await getContract(CONTRACT_NAME);
+
+  const result = await contract.evaluateTransaction('GetSegmentsByStatusWithPagination', status, String(pageSize), bookmark);
+  return decodeResult<Page<Segment>>(result);
+}
+
 /**
  * Reserve a segment for a vehicle/mission
  * Returns a conflict if one occurs
+ * With request.queue, a denied request joins the segment's waitlist instead
+ * (a queued request also gives toNode)
  */
 export async function reserveSegment(
   request: ReserveSegmentRequest
 ): Promise<Conflict | null> {
   const contract = await getContract(CONTRACT_NAME);
   
-  const result = await contract.submitTransaction(
-    'ReserveSegment',
+  const args = [
     request.segmentId,
     request.vehicleId,
     request.missionId,
-    request.priorityLevel.toString()
-  );
+    request.priorityLevel.toString(),
+    (request.enterAt ?? 0).toString(),
+    (request.exitAt ?? 0).toString(),
+    request.fromNode ?? '',
+  ];
+  const result = request.queue
+    ? await contract.submitTransaction('QueueSegment', ...args, request.toNode ?? '')
+    : await contract.submitTransaction('ReserveSegment', ...args);
   
   if (result && result.length > 0) {
     const decoded = Buffer.from(result).toString('utf-8');
@@ -93,6 +134,39 @@ export async function occupySegment(
   await contract.submitTransaction('OccupySegment', segmentId, vehicleId);
 }
 
+/**
+ * Close a segment to traffic (traffic authority only)
+ * startAt 0 means now, endAt 0 keeps it closed until unblocked
+ */
+export async function blockSegment(
+  segmentId: string,
+  reason: string,
+  startAt = 0,
+  endAt = 0
+): Promise<void> {
+  const contract = await getAuthorityContract(CONTRACT_NAME);
+
+  await contract.submitTransaction('BlockSegment', segmentId, reason, String(startAt), String(endAt));
+}
+
+/**
+ * Reopen a segment closed by this organization
+ */
+export async function unblockSegment(segmentId: string): Promise<void> {
+  const contract = await getAuthorityContract(CONTRACT_NAME);
+
+  await contract.submitTransaction('UnblockSegment', segmentId);
+}
+
+/**
+ * Set how many vehicles may hold a segment at once per direction (traffic authority only)
+ */
+export async function setSegmentCapacity(segmentId: string, capacity: number): Promise<void> {
+  const contract = await getAuthorityContract(CONTRACT_NAME);
+
+  await contract.submitTransaction('SetSegmentCapacity', segmentId, String(capacity));
+}
+
 /**
  * Resolve a conflict
  */
@@ -124,3 +198,13 @@ export async function initSegments(): Promise<void> {
   await contract.submitTransaction('InitSegments');
 }
 
+/**
+ * Get every committed version of a segment, oldest first
+ * fromTime and toTime (Unix seconds, inclusive) bound the range; 0 leaves a side open
+ */
+export async function getSegmentHistory(segmentId: string, fromTime = 0, toTime = 0): Promise<SegmentVersion[]> {
+  const contract = await getContract(CONTRACT_NAME);
+
+  const result = await contract.evaluateTransaction('GetSegmentHistory', segmentId, String(fromTime), String(toTime));
+  return decodeResultOrDefault<SegmentVersion[]>(result, []);
+}
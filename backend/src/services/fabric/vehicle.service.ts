@@ -1,5 +1,5 @@
 import { getContract, decodeResult, decodeResultOrDefault } from './gateway';
-import { Vehicle, CreateVehicleRequest } from '../../models/types';
+import { Vehicle, VehicleVersion, Page, CreateVehicleRequest } from '../../models/types';
 
 const CONTRACT_NAME = 'VehicleContract';
 
@@ -38,6 +38,16 @@ export async function getAllVehicles(): Promise<Vehicle[]> {
   return decodeResultOrDefault<Vehicle[]>(result, []);
 }
 
+/**
+ * Get one page of vehicles in ID order (empty bookmark for the first page)
+ */
+export async function getAllVehiclesPage(pageSize: number, bookmark = ''): Promise<Page<Vehicle>> {
+  const contract = await getContract(CONTRACT_NAME);
+
+  const result = await contract.evaluateTransaction('GetAllVehiclesWithPagination', String(pageSize), bookmark);
+  return decodeResult<Page<Vehicle>>(result);
+}
+
 /**
  * Get vehicles by organization type
  */
@@ -48,6 +58,20 @@ export async function getVehiclesByOrg(orgType: 'medical' | 'police'): Promise<V
   return decodeResultOrDefault<Vehicle[]>(result, []);
 }
 
+/**
+ * Get one page of vehicles of an organization type
+ */
+export async function getVehiclesByOrgPage(
+  orgType: 'medical' | 'police',
+  pageSize: number,
+  bookmark = ''
+): Promise<Page<Vehicle>> {
+  const contract = await getContract(CONTRACT_NAME);
+
+  const result = await contract.evaluateTransaction('GetVehiclesByOrgWithPagination', orgType, String(pageSize), bookmark);
+  return decodeResult<Page<Vehicle>>(result);
+}
+
 /**
  * Update vehicle status
  */
@@ -80,3 +104,13 @@ export async function updateVehiclePriority(vehicleId: string, priorityLevel: nu
   await contract.submitTransaction('UpdateVehiclePriority', vehicleId, priorityLevel.toString());
 }
 
+/**
+ * Get every committed version of a vehicle, oldest first
+ * fromTime and toTime (Unix seconds, inclusive) bound the range; 0 leaves a side open
+ */
+export async function getVehicleHistory(vehicleId: string, fromTime = 0, toTime = 0): Promise<VehicleVersion[]> {
+  const contract = await getContract(CONTRACT_NAME);
+
+  const result = await contract.evaluateTransaction('GetVehicleHistory', vehicleId, String(fromTime), String(toTime));
+  return decodeResultOrDefault<VehicleVersion[]>(result, []);
+}
@@ -166,6 +166,11 @@ function calculateEdgeWeight(
     return baseWeight;
   }
 
+  // Blocked segment - road is closed, never route through it
+  if (status === 'blocked') {
+    return Infinity;
+  }
+
   // Occupied segment - very high penalty (almost blocked)
   if (status === 'occupied') {
     return baseWeight * 100;
@@ -173,6 +178,11 @@ function calculateEdgeWeight(
 
   // Reserved segment - penalty based on priority and organization
   if (status === 'reserved' && segmentStatus.priorityLevel !== undefined) {
+    // Multi-lane segment with a lane still free - light penalty for sharing the road
+    if ((segmentStatus.holders?.length ?? 1) < (segmentStatus.capacity || 1)) {
+      return baseWeight * 1.2;
+    }
+
     const reservedPriority = segmentStatus.priorityLevel;
     const reservedOrg = segmentStatus.orgType;
 
@@ -206,6 +216,31 @@ function getSegmentBetweenNodes(fromNode: string, toNode: string): string | unde
   return undefined;
 }
 
+/**
+ * Get the nodes a segment path drives through, working back from the node it ends at
+ * Returns undefined when the segments do not connect into a drivable path ending there
+ */
+export function nodePathEndingAt(path: string[], endNode: string): string[] | undefined {
+  const edges = new Map(getMapEdges().map(edge => [edge.id, edge]));
+  const nodePath = [endNode];
+
+  for (let i = path.length - 1; i >= 0; i--) {
+    const edge = edges.get(path[i]);
+    if (!edge) {
+      return undefined;
+    }
+    if (edge.to === nodePath[0]) {
+      nodePath.unshift(edge.from);
+    } else if (edge.bidirectional && edge.from === nodePath[0]) {
+      nodePath.unshift(edge.to);
+    } else {
+      return undefined;
+    }
+  }
+
+  return nodePath;
+}
+
 /**
  * Find the optimal route using Dijkstra's algorithm
  * 
@@ -509,5 +544,6 @@ export default {
   calculateRoute,
   findAlternativeRoutes,
   analyzeRoute,
+  nodePathEndingAt,
 };
 
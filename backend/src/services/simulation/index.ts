@@ -3,8 +3,7 @@
 
 import { broadcastMessage } from '../realtime/websocket';
 import { emitVehiclePosition } from '../realtime/socketio';
-import { completeMission as completeMissionChaincode } from '../fabric/mission.service';
-import { occupySegment, releaseSegment } from '../fabric/segment.service';
+import { completeMission as completeMissionChaincode, renewLease, advanceMission } from '../fabric/mission.service';
 import * as couchdb from '../couchdb';
 import { getManhattanNodes, getManhattanSegments } from '../map/manhattan';
 import type { Mission, WsMessage } from '../../models/types';
@@ -12,6 +11,7 @@ import type { Mission, WsMessage } from '../../models/types';
 // Simulation configuration
 const DEFAULT_SEGMENT_TRAVEL_TIME_MS = 3000; // 3 seconds per segment
 const POSITION_UPDATE_INTERVAL_MS = 500; // Update position every 500ms
+const LEASE_RENEWAL_INTERVAL_MS = 60000; // Chaincode leases last 300s, renew well before
 
 // Vehicle simulation state
 interface VehicleSimState {
@@ -26,6 +26,7 @@ interface VehicleSimState {
   priorityLevel: number;
   startedAt: number;
   pausedAt?: number;
+  leaseRenewedAt?: number;
 }
 
 // Global simulation state
@@ -315,6 +316,9 @@ async function updateSimulation(): Promise<void> {
       continue;
     }
 
+    // Keep the mission's reservations alive on the ledger
+    renewLeaseIfDue(vehicle);
+
     // Update progress
     vehicle.progress += progressIncrement;
 
@@ -345,6 +349,22 @@ async function updateSimulation(): Promise<void> {
   }
 }
 
+/**
+ * Send a RenewLease heartbeat for the vehicle's mission when one is due
+ */
+function renewLeaseIfDue(vehicle: VehicleSimState): void {
+  const now = Date.now();
+  const lastRenewal = vehicle.leaseRenewedAt ?? vehicle.startedAt;
+  if (now - lastRenewal < LEASE_RENEWAL_INTERVAL_MS) {
+    return;
+  }
+
+  vehicle.leaseRenewedAt = now;
+  renewLease(vehicle.missionId).catch(err => {
+    console.error(`Failed to renew lease for mission ${vehicle.missionId}:`, err.message);
+  });
+}
+
 /**
  * Handle segment transition (update blockchain status)
  */
@@ -360,16 +380,10 @@ async function handleSegmentTransition(vehicle: VehicleSimState, previousSegment
 
   console.log(`Vehicle ${vehicle.vehicleId} transitioning: ${previousSegment} -> ${currentSegment}`);
 
-  // Release previous segment (fire and forget with retry)
-  if (previousSegment) {
-    releaseSegmentWithRetry(previousSegment, vehicle.vehicleId).catch(err => {
-      console.error(`Failed to release segment ${previousSegment}:`, err.message);
-    });
-  }
-
-  // Occupy current segment (fire and forget with retry)
-  occupySegmentWithRetry(currentSegment, vehicle.vehicleId, vehicle.missionId).catch(err => {
-    console.error(`Failed to occupy segment ${currentSegment}:`, err.message);
+  // Advance the mission: occupies the current segment and releases the ones behind it
+  // in a single transaction (fire and forget with retry)
+  advanceMissionWithRetry(vehicle.missionId, vehicle.vehicleId, currentSegment, previousSegment).catch(err => {
+    console.error(`Failed to advance mission ${vehicle.missionId} to ${currentSegment}:`, err.message);
   });
 
   // Broadcast segment transition event
@@ -384,33 +398,46 @@ async function handleSegmentTransition(vehicle: VehicleSimState, previousSegment
 }
 
 /**
- * Occupy segment with retry logic for MVCC conflicts
- * Gracefully handles cases where segment is already occupied or reserved by different vehicle
+ * Advance mission with retry logic for MVCC conflicts
+ * Gracefully handles out-of-order advances and segments the vehicle no longer holds
  */
-async function occupySegmentWithRetry(segmentId: string, vehicleId: string, missionId: string, maxRetries = 3): Promise<void> {
+async function advanceMissionWithRetry(
+  missionId: string,
+  vehicleId: string,
+  segmentId: string,
+  previousSegmentId: string | undefined,
+  maxRetries = 3
+): Promise<void> {
+  const broadcastAdvance = () => {
+    if (previousSegmentId) {
+      broadcastSegmentUpdate(previousSegmentId, 'free', vehicleId, null);
+    }
+    broadcastSegmentUpdate(segmentId, 'occupied', vehicleId, missionId);
+  };
+
   for (let attempt = 1; attempt <= maxRetries; attempt++) {
     try {
-      await occupySegment(segmentId, vehicleId);
-      broadcastSegmentUpdate(segmentId, 'occupied', vehicleId, missionId);
+      await advanceMission(missionId, segmentId);
+      broadcastAdvance();
       return;
     } catch (error: any) {
       const errorMsg = error.message || error.details?.[0]?.message || '';
 
-      // Check if segment is already occupied or has issues
-      if (errorMsg.includes('already occupied') || errorMsg.includes('not reserved')) {
-        console.log(`Segment ${segmentId} occupy issue: ${errorMsg}, continuing`);
-        broadcastSegmentUpdate(segmentId, 'occupied', vehicleId, missionId); // Broadcast anyway for UI
+      // Check if the advance was already applied or the segment is no longer held
+      if (errorMsg.includes('out-of-order') || errorMsg.includes('already occupied') || errorMsg.includes('not reserved')) {
+        console.log(`Mission ${missionId} advance issue at ${segmentId}: ${errorMsg}, continuing`);
+        broadcastAdvance(); // Broadcast anyway for UI
         return;
       }
 
       // MVCC_READ_CONFLICT (code 11) or ABORTED (code 10) - retry
       if ((error.code === 11 || error.code === 10) && attempt < maxRetries) {
-        console.log(`Blockchain conflict occupying segment ${segmentId}, retry ${attempt}/${maxRetries}`);
+        console.log(`Blockchain conflict advancing mission ${missionId}, retry ${attempt}/${maxRetries}`);
         await sleep(500 * attempt); // Exponential backoff
       } else if (attempt >= maxRetries) {
         // Max retries reached - log and continue (non-critical)
-        console.warn(`Could not occupy segment ${segmentId} after ${maxRetries} attempts, continuing simulation`);
-        broadcastSegmentUpdate(segmentId, 'occupied', vehicleId, missionId); // Broadcast anyway for UI
+        console.warn(`Could not advance mission ${missionId} after ${maxRetries} attempts, continuing simulation`);
+        broadcastAdvance(); // Broadcast anyway for UI
         return;
       } else {
         throw error;
@@ -437,15 +464,12 @@ async function handleArrival(vehicle: VehicleSimState): Promise<void> {
   // Remove from simulation immediately
   simulationState.vehicles.delete(vehicle.vehicleId);
 
-  // Release the last segment (non-blocking, with retry)
+  // Complete the mission on blockchain (non-blocking, with retry)
+  // CompleteMission releases the last segment along with anything still held
   const lastSegment = vehicle.path[vehicle.path.length - 1];
   if (lastSegment) {
-    releaseSegmentWithRetry(lastSegment, vehicle.vehicleId).catch(err => {
-      console.error('Failed to release final segment after retries:', err);
-    });
+    broadcastSegmentUpdate(lastSegment, 'free', vehicle.vehicleId, null);
   }
-
-  // Complete the mission on blockchain (non-blocking, with retry)
   completeMissionWithRetry(vehicle.missionId).catch(err => {
     console.error('Failed to complete mission after retries:', err);
   });
@@ -466,42 +490,6 @@ async function handleArrival(vehicle: VehicleSimState): Promise<void> {
   });
 }
 
-/**
- * Release segment with retry logic for MVCC conflicts
- * Gracefully handles cases where segment is already free or not reserved by this vehicle
- */
-async function releaseSegmentWithRetry(segmentId: string, vehicleId: string, maxRetries = 3): Promise<void> {
-  for (let attempt = 1; attempt <= maxRetries; attempt++) {
-    try {
-      await releaseSegment(segmentId, vehicleId);
-      broadcastSegmentUpdate(segmentId, 'free', vehicleId, null);
-      return;
-    } catch (error: any) {
-      const errorMsg = error.message || error.details?.[0]?.message || '';
-
-      // Check if this is a "not reserved by vehicle" error - segment is already free
-      if (errorMsg.includes('not reserved by vehicle') || errorMsg.includes('is not reserved')) {
-        console.log(`Segment ${segmentId} already free or not reserved by ${vehicleId}, skipping release`);
-        broadcastSegmentUpdate(segmentId, 'free', vehicleId, null);
-        return;
-      }
-
-      // MVCC_READ_CONFLICT (code 11) or ABORTED (code 10) - retry
-      if ((error.code === 11 || error.code === 10) && attempt < maxRetries) {
-        console.log(`Blockchain conflict releasing segment ${segmentId}, retry ${attempt}/${maxRetries}`);
-        await sleep(500 * attempt); // Exponential backoff
-      } else if (attempt >= maxRetries) {
-        // Max retries reached - log and continue (non-critical)
-        console.warn(`Could not release segment ${segmentId} after ${maxRetries} attempts, continuing simulation`);
-        broadcastSegmentUpdate(segmentId, 'free', vehicleId, null); // Broadcast anyway for UI
-        return;
-      } else {
-        throw error;
-      }
-    }
-  }
-}
-
 /**
  * Complete mission with retry logic for MVCC conflicts
  * Gracefully handles cases where mission is already completed
@@ -0,0 +1,197 @@
+package contracts
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/emergency-routing/chaincode/routing/models"
+)
+
+// Certificate attributes read by the access checks
+const (
+	roleAttribute      = "role"
+	vehicleIDAttribute = "vehicleId"
+	adminNodeOU        = "admin" // Fabric NodeOU of org admin certificates
+)
+
+var (
+	dispatchRoles  = []string{models.RoleAdmin, models.RoleDispatcher}
+	vehicleRoles   = []string{models.RoleAdmin, models.RoleDispatcher, models.RoleDriver}
+	adminRoles     = []string{models.RoleAdmin}
+	authorityRoles = []string{models.RoleAuthority}
+)
+
+// permissions lists the roles allowed to invoke each mutating transaction
+// Drivers are further limited to their own vehicle by requireVehicleAccess
+// A transaction listed neither here nor in queries is denied
+var permissions = map[string][]string{
+	"VehicleContract:RegisterVehicle":       dispatchRoles,
+	"VehicleContract:UpdateVehicleStatus":   vehicleRoles,
+	"VehicleContract:UpdateVehiclePriority": dispatchRoles,
+
+	"SegmentContract:InitSegments":             adminRoles,
+	"SegmentContract:ReserveSegment":           dispatchRoles,
+	"SegmentContract:QueueSegment":             dispatchRoles,
+	"SegmentContract:ReleaseSegment":           vehicleRoles,
+	"SegmentContract:OccupySegment":            vehicleRoles,
+	"SegmentContract:ResolveConflict":          dispatchRoles,
+	"SegmentContract:SweepExpiredReservations": dispatchRoles,
+	"SegmentContract:BlockSegment":             authorityRoles,
+	"SegmentContract:UnblockSegment":           authorityRoles,
+	"SegmentContract:SetSegmentCapacity":       authorityRoles,
+
+	"MissionContract:CreateMission":          dispatchRoles,
+	"MissionContract:CreateMultiStopMission": dispatchRoles,
+	"MissionContract:ActivateMission":        dispatchRoles,
+	"MissionContract:CompleteMission":        vehicleRoles,
+	"MissionContract:AbortMission":           dispatchRoles,
+	"MissionContract:UpdateMissionPath":      dispatchRoles,
+	"MissionContract:UpdateMissionPriority":  dispatchRoles,
+	"MissionContract:HandoffMission":         dispatchRoles,
+	"MissionContract:ProposeConvoy":          dispatchRoles,
+	"MissionContract:AcceptConvoy":           dispatchRoles,
+	"MissionContract:LeaveConvoy":            dispatchRoles,
+	"MissionContract:AdvanceMission":         vehicleRoles,
+	"MissionContract:ReachWaypoint":          vehicleRoles,
+	"MissionContract:RenewLease":             vehicleRoles,
+
+	"OrgContract:InitOrgRegistry":        adminRoles,
+	"OrgContract:RegisterOrganization":   adminRoles,
+	"OrgContract:UpdateOrganization":     adminRoles,
+	"OrgContract:SetOrganizationEnabled": adminRoles,
+
+	"MigrationContract:MigrateToCompositeKeys": adminRoles,
+	"MigrationContract:BuildSecondaryIndexes":  adminRoles,
+}
+
+// queries lists the read-only transactions, open to any member of a registered,
+// enabled org whatever its role
+var queries = map[string]bool{
+	"VehicleContract:GetVehicle":                     true,
+	"VehicleContract:GetAllVehicles":                 true,
+	"VehicleContract:GetAllVehiclesWithPagination":   true,
+	"VehicleContract:GetVehiclesByOrg":               true,
+	"VehicleContract:GetVehiclesByOrgWithPagination": true,
+	"VehicleContract:GetVehicleHistory":              true,
+	"VehicleContract:VehicleExists":                  true,
+
+	"SegmentContract:GetSegment":                        true,
+	"SegmentContract:GetAllSegments":                    true,
+	"SegmentContract:GetAllSegmentsWithPagination":      true,
+	"SegmentContract:GetSegmentsByStatus":               true,
+	"SegmentContract:GetSegmentsByStatusWithPagination": true,
+	"SegmentContract:GetSegmentHistory":                 true,
+	"SegmentContract:GetPendingConflicts":               true,
+	"SegmentContract:GetNode":                           true,
+
+	"MissionContract:GetMission":                        true,
+	"MissionContract:GetAllMissions":                    true,
+	"MissionContract:GetAllMissionsWithPagination":      true,
+	"MissionContract:GetActiveMissions":                 true,
+	"MissionContract:GetMissionsByStatus":               true,
+	"MissionContract:GetMissionsByStatusWithPagination": true,
+	"MissionContract:GetMissionsByOrg":                  true,
+	"MissionContract:GetMissionsByOrgWithPagination":    true,
+	"MissionContract:GetVehicleActiveMission":           true,
+	"MissionContract:GetEffectivePriority":              true,
+	"MissionContract:GetMissionHistory":                 true,
+	"MissionContract:GetPreemptedSegments":              true,
+	"MissionContract:GetConvoyMembers":                  true,
+
+	"OrgContract:GetOrganization":     true,
+	"OrgContract:GetAllOrganizations": true,
+
+	"AuditContract:GetAuditTrail":    true,
+	"AuditContract:VerifyAuditChain": true,
+}
+
+// callerRole returns the caller's role from the "role" certificate attribute
+// Certificates without the attribute fall back to their NodeOU, so the org admin
+// certificates issued by cryptogen act as admins. Returns "" for any other caller
+func callerRole(ctx RoutingContextInterface) (string, error) {
+	clientIdentity := ctx.GetClientIdentity()
+	role, found, err := clientIdentity.GetAttributeValue(roleAttribute)
+	if err != nil {
+		return "", fmt.Errorf("failed to read role attribute: %v", err)
+	}
+	if found {
+		switch role {
+		case models.RoleAdmin, models.RoleDispatcher, models.RoleDriver, models.RoleAuthority:
+			return role, nil
+		}
+		return "", fmt.Errorf("unknown role: %s", role)
+	}
+
+	cert, err := clientIdentity.GetX509Certificate()
+	if err != nil {
+		return "", fmt.Errorf("failed to read certificate: %v", err)
+	}
+	if cert != nil {
+		for _, ou := range cert.Subject.OrganizationalUnit {
+			if ou == adminNodeOU {
+				return models.RoleAdmin, nil
+			}
+		}
+	}
+	return "", nil
+}
+
+// authorizeTransaction checks the caller's role against the permission table, or
+// its org against the registry for a query. Anything else is denied
+// fn is the invoked function, with or without the "Contract:" prefix
+func authorizeTransaction(ctx RoutingContextInterface, contractName string, fn string) error {
+	if i := strings.LastIndex(fn, ":"); i >= 0 {
+		fn = fn[i+1:]
+	}
+	allowed, ok := permissions[contractName+":"+fn]
+	if !ok {
+		if !queries[contractName+":"+fn] {
+			return fmt.Errorf("access denied: %s is not a known transaction", fn)
+		}
+		_, err := resolveCallerOrg(ctx)
+		return err
+	}
+
+	role, err := callerRole(ctx)
+	if err != nil {
+		return err
+	}
+	for _, r := range allowed {
+		if r == role {
+			return nil
+		}
+	}
+	if role == "" {
+		return fmt.Errorf("access denied: %s requires one of the roles %v", fn, allowed)
+	}
+	return fmt.Errorf("access denied: role %s cannot invoke %s", role, fn)
+}
+
+// newAuthorizer returns the BeforeTransaction handler for a contract
+func newAuthorizer(contractName string) func(ctx RoutingContextInterface) error {
+	return func(ctx RoutingContextInterface) error {
+		fn, _ := ctx.GetStub().GetFunctionAndParameters()
+		return authorizeTransaction(ctx, contractName, fn)
+	}
+}
+
+// requireVehicleAccess limits drivers to the vehicle named in their certificate
+// Other roles are not bound to a vehicle
+func requireVehicleAccess(ctx RoutingContextInterface, vehicleID string) error {
+	role, err := callerRole(ctx)
+	if err != nil {
+		return err
+	}
+	if role != models.RoleDriver {
+		return nil
+	}
+
+	boundVehicle, found, err := ctx.GetClientIdentity().GetAttributeValue(vehicleIDAttribute)
+	if err != nil {
+		return fmt.Errorf("failed to read vehicleId attribute: %v", err)
+	}
+	if !found || boundVehicle != vehicleID {
+		return fmt.Errorf("access denied: driver is not assigned to vehicle %s", vehicleID)
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+package contracts
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/emergency-routing/chaincode/routing/models"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+func TestPermissionsNameExistingTransactions(t *testing.T) {
+	contracts := map[string]interface{}{
+		"VehicleContract":   NewVehicleContract(),
+		"SegmentContract":   NewSegmentContract(),
+		"MissionContract":   NewMissionContract(),
+		"OrgContract":       NewOrgContract(),
+		"AuditContract":     NewAuditContract(),
+		"MigrationContract": NewMigrationContract(),
+	}
+
+	for key, roles := range permissions {
+		parts := strings.SplitN(key, ":", 2)
+		contract, ok := contracts[parts[0]]
+		if !ok {
+			t.Errorf("%s: unknown contract", key)
+			continue
+		}
+		if _, ok := reflect.TypeOf(contract).MethodByName(parts[1]); !ok {
+			t.Errorf("%s: no such transaction", key)
+		}
+		if len(roles) == 0 {
+			t.Errorf("%s: no role may invoke it", key)
+		}
+		if queries[key] {
+			t.Errorf("%s: listed both as a query and in permissions", key)
+		}
+	}
+	for key := range queries {
+		parts := strings.SplitN(key, ":", 2)
+		contract, ok := contracts[parts[0]]
+		if !ok {
+			t.Errorf("%s: unknown contract", key)
+			continue
+		}
+		if _, ok := reflect.TypeOf(contract).MethodByName(parts[1]); !ok {
+			t.Errorf("%s: no such transaction", key)
+		}
+	}
+
+	// Every transaction is listed, or the deny-by-default check would lock it out
+	embedded := reflect.TypeOf(&contractapi.Contract{})
+	for name, contract := range contracts {
+		contractType := reflect.TypeOf(contract)
+		for i := 0; i < contractType.NumMethod(); i++ {
+			method := contractType.Method(i).Name
+			if _, ok := embedded.MethodByName(method); ok {
+				continue
+			}
+			key := name + ":" + method
+			if _, ok := permissions[key]; !ok && !queries[key] {
+				t.Errorf("%s: listed neither in permissions nor in queries", key)
+			}
+		}
+	}
+}
+
+func TestRoleChecks(t *testing.T) {
+	l := newLedger(t)
+	l.registerVehicle(medicalDispatcher, "AMB-1", "medical", "ambulance", 2)
+
+	noRole := identity{mspID: "MedicalMSP", name: "client@medical"}
+	unknownRole := identity{mspID: "MedicalMSP", name: "intern@medical", attrs: map[string]string{"role": "superuser"}}
+
+	l.mustFail(noRole, "RegisterVehicle requires one of the roles", "VehicleContract:RegisterVehicle", "AMB-2", "medical", "ambulance", "2")
+	l.mustFail(unknownRole, "unknown role: superuser", "VehicleContract:RegisterVehicle", "AMB-2", "medical", "ambulance", "2")
+	l.mustFail(driver("MedicalMSP", "AMB-1"), "role driver cannot invoke RegisterVehicle", "VehicleContract:RegisterVehicle", "AMB-2", "medical", "ambulance", "2")
+	l.mustFail(medicalDispatcher, "role dispatcher cannot invoke InitSegments", "SegmentContract:InitSegments")
+	l.mustFail(medicalDispatcher, "role dispatcher cannot invoke BlockSegment", "SegmentContract:BlockSegment", "S1", "accident", "0", "0")
+	l.mustFail(trafficAuthority, "role authority cannot invoke CreateMission", "MissionContract:CreateMission", "P1", "POL-1", "A", "B", "high", "")
+
+	// Admin certificates issued without a role attribute act as admins through their NodeOU
+	l.mustInvoke(medicalAdmin, "SegmentContract:InitSegments")
+	l.mustInvoke(medicalAdmin, "VehicleContract:RegisterVehicle", "AMB-2", "medical", "ambulance", "2")
+
+	// Queries are open to any member of a registered org
+	l.mustInvoke(noRole, "VehicleContract:GetVehicle", "AMB-1")
+}
+
+func TestQueriesRequireARegisteredOrg(t *testing.T) {
+	l := newLedger(t)
+	l.registerVehicle(medicalDispatcher, "AMB-1", "medical", "ambulance", 2)
+
+	outsider := identity{mspID: "UnknownMSP", name: "client@unknown"}
+	l.mustFail(outsider, "unknown organization: UnknownMSP", "VehicleContract:GetVehicle", "AMB-1")
+	l.mustFail(outsider, "unknown organization: UnknownMSP", "AuditContract:VerifyAuditChain", models.DocTypeVehicle, "AMB-1")
+
+	l.mustInvoke(policeDispatcher, "VehicleContract:GetVehicle", "AMB-1")
+	l.mustInvoke(medicalAdmin, "OrgContract:SetOrganizationEnabled", "PoliceMSP", "false")
+	l.mustFail(policeDispatcher, "organization PoliceMSP is disabled", "VehicleContract:GetVehicle", "AMB-1")
+}
+
+func TestDriverIsBoundToItsVehicle(t *testing.T) {
+	l := newLedger(t)
+	l.registerVehicle(medicalDispatcher, "AMB-1", "medical", "ambulance", 2)
+	l.registerVehicle(medicalDispatcher, "AMB-2", "medical", "ambulance", 2)
+	l.startMission(medicalDispatcher, "M2", "AMB-2", "A", "B", "high", `[{"segmentId":"S1","fromNode":"A","toNode":"B"}]`)
+
+	amb1 := driver("MedicalMSP", "AMB-1")
+	unbound := identity{mspID: "MedicalMSP", name: "driver@medical", attrs: map[string]string{"role": models.RoleDriver}}
+
+	l.mustInvoke(amb1, "VehicleContract:UpdateVehicleStatus", "AMB-1", models.StatusInactive)
+	l.mustFail(amb1, "not assigned to vehicle AMB-2", "VehicleContract:UpdateVehicleStatus", "AMB-2", models.StatusInactive)
+	l.mustFail(unbound, "not assigned to vehicle AMB-1", "VehicleContract:UpdateVehicleStatus", "AMB-1", models.StatusInactive)
+
+	l.mustFail(amb1, "not assigned to vehicle AMB-2", "SegmentContract:OccupySegment", "S1", "AMB-2")
+	l.mustFail(amb1, "not assigned to vehicle AMB-2", "SegmentContract:ReleaseSegment", "S1", "AMB-2")
+	l.mustFail(amb1, "not assigned to vehicle AMB-2", "MissionContract:AdvanceMission", "M2", "S1")
+	l.mustFail(amb1, "not assigned to vehicle AMB-2", "MissionContract:RenewLease", "M2")
+	l.mustFail(amb1, "not assigned to vehicle AMB-2", "MissionContract:CompleteMission", "M2")
+	l.mustFail(amb1, "role driver cannot invoke AbortMission", "MissionContract:AbortMission", "M2", "test")
+
+	amb2 := driver("MedicalMSP", "AMB-2")
+	l.mustInvoke(amb2, "MissionContract:RenewLease", "M2")
+	l.mustInvoke(amb2, "MissionContract:CompleteMission", "M2")
+}
@@ -0,0 +1,438 @@
+package contracts
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/emergency-routing/chaincode/routing/models"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// AuditContract answers queries over the persisted audit trail
+type AuditContract struct {
+	contractapi.Contract
+}
+
+// GetAuditTrail retrieves audit entries matching every non-empty filter
+// fromTime and toTime bound the timestamp (inclusive); 0 leaves that side open
+// Entries are read from the audit chain of the mission, vehicle or segment filtered
+// on, else from the actor index, so no rich query is needed
+// Entries are returned oldest first
+func (c *AuditContract) GetAuditTrail(
+	ctx RoutingContextInterface,
+	missionID string,
+	vehicleID string,
+	segmentID string,
+	actorID string,
+	fromTime int64,
+	toTime int64,
+) ([]*models.AuditEvent, error) {
+	if fromTime > 0 && toTime > 0 && toTime < fromTime {
+		return nil, fmt.Errorf("invalid time range: %d is before %d", toTime, fromTime)
+	}
+
+	var entries []*models.AuditEvent
+	var err error
+	switch {
+	case missionID != "":
+		entries, err = auditChainEntries(ctx, models.DocTypeMission, missionID)
+	case vehicleID != "":
+		entries, err = auditChainEntries(ctx, models.DocTypeVehicle, vehicleID)
+	case segmentID != "":
+		entries, err = auditChainEntries(ctx, models.DocTypeSegment, segmentID)
+	default:
+		entries, err = auditEntriesByActor(ctx, actorID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read audit trail: %v", err)
+	}
+
+	// An entry is stored once per chain it belongs to; return it once
+	seen := map[string]bool{}
+	matching := []*models.AuditEvent{}
+	for _, entry := range entries {
+		if seen[entry.EventID] {
+			continue
+		}
+		seen[entry.EventID] = true
+
+		if (missionID != "" && entry.MissionID != missionID) ||
+			(vehicleID != "" && entry.VehicleID != vehicleID) ||
+			(segmentID != "" && entry.SegmentID != segmentID) ||
+			(actorID != "" && entry.ActorID != actorID) ||
+			(fromTime > 0 && entry.Timestamp < fromTime) ||
+			(toTime > 0 && entry.Timestamp > toTime) {
+			continue
+		}
+		matching = append(matching, entry)
+	}
+
+	sort.SliceStable(matching, func(i, j int) bool {
+		if matching[i].Timestamp != matching[j].Timestamp {
+			return matching[i].Timestamp < matching[j].Timestamp
+		}
+		return matching[i].EventID < matching[j].EventID
+	})
+
+	return matching, nil
+}
+
+// auditChainEntries reads every entry in an entity's audit chain, in sequence order
+func auditChainEntries(ctx RoutingContextInterface, entityType string, entityID string) ([]*models.AuditEvent, error) {
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(auditObjectType, []string{entityType, entityID})
+	if err != nil {
+		return nil, err
+	}
+	return decodeResults[models.AuditEvent](resultsIterator)
+}
+
+// auditEntriesByActor reads the entries listed under the actor index, once per event
+// An empty actorID lists every entry
+func auditEntriesByActor(ctx RoutingContextInterface, actorID string) ([]*models.AuditEvent, error) {
+	attributes := []string{}
+	if actorID != "" {
+		attributes = append(attributes, actorID)
+	}
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(auditActorIndex, attributes)
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	entries := []*models.AuditEvent{}
+	for resultsIterator.HasNext() {
+		queryResult, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		_, attributes, err := ctx.GetStub().SplitCompositeKey(queryResult.Key)
+		if err != nil {
+			return nil, err
+		}
+		entryKey, err := ctx.GetStub().CreateCompositeKey(auditObjectType, attributes[1:])
+		if err != nil {
+			return nil, err
+		}
+		entryJSON, err := ctx.ReadState(entryKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read state: %v", err)
+		}
+		if entryJSON == nil {
+			continue
+		}
+
+		var entry models.AuditEvent
+		if err := json.Unmarshal(entryJSON, &entry); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal audit entry: %v", err)
+		}
+		entries = append(entries, &entry)
+	}
+
+	return entries, nil
+}
+
+// indexAuditEntry lists an entry under its actor, pointing at one copy of it
+func indexAuditEntry(ctx RoutingContextInterface, entry *models.AuditEvent) error {
+	key, err := ctx.GetStub().CreateCompositeKey(auditActorIndex, []string{entry.ActorID, entry.EntityType, entry.EntityID, fmt.Sprintf("%019d", entry.Sequence)})
+	if err != nil {
+		return err
+	}
+	if err := ctx.WriteState(key, indexMarker); err != nil {
+		return fmt.Errorf("failed to write index: %v", err)
+	}
+	return nil
+}
+
+// VerifyAuditChain recomputes the audit chain of a mission, vehicle, segment or org
+// (entityType is its docType, since IDs are only unique within a type) and reports
+// the first entry that is missing, out of sequence or does not hash correctly
+func (c *AuditContract) VerifyAuditChain(
+	ctx RoutingContextInterface,
+	entityType string,
+	entityID string,
+) (*models.AuditChainReport, error) {
+	if !auditEntityTypes[entityType] {
+		return nil, fmt.Errorf("invalid entity type %q: must be mission, vehicle, segment or org", entityType)
+	}
+	if entityID == "" {
+		return nil, fmt.Errorf("entity ID cannot be empty")
+	}
+
+	head, err := getAuditChainHead(ctx, entityType, entityID)
+	if err != nil {
+		return nil, err
+	}
+
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(auditObjectType, []string{entityType, entityID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read audit chain: %v", err)
+	}
+	defer resultsIterator.Close()
+
+	report := &models.AuditChainReport{EntityType: entityType, EntityID: entityID, Valid: true}
+	fail := func(sequence int64, problem string) (*models.AuditChainReport, error) {
+		report.Valid = false
+		report.FirstBadEntry = sequence
+		report.Problem = problem
+		return report, nil
+	}
+
+	prevHash := ""
+	for resultsIterator.HasNext() {
+		queryResult, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		expected := report.Entries + 1
+
+		// Numbers in details must re-encode exactly as they were hashed
+		var entry models.AuditEvent
+		decoder := json.NewDecoder(bytes.NewReader(queryResult.Value))
+		decoder.UseNumber()
+		if err := decoder.Decode(&entry); err != nil {
+			return fail(expected, fmt.Sprintf("entry cannot be decoded: %v", err))
+		}
+
+		if entry.Sequence != expected {
+			return fail(expected, fmt.Sprintf("entry %d is missing (found %d)", expected, entry.Sequence))
+		}
+		if entry.EntityType != entityType || entry.EntityID != entityID {
+			return fail(expected, fmt.Sprintf("entry belongs to %s %s", entry.EntityType, entry.EntityID))
+		}
+		if entry.PrevHash != prevHash {
+			return fail(expected, "previous hash does not match the preceding entry")
+		}
+		hash, err := hashAuditEntry(entry)
+		if err != nil {
+			return nil, err
+		}
+		if hash != entry.Hash {
+			return fail(expected, "entry hash does not match its contents")
+		}
+
+		prevHash = entry.Hash
+		report.Entries = expected
+	}
+
+	// The head catches entries dropped from the end of the chain
+	if report.Entries != head.Sequence {
+		return fail(report.Entries+1, fmt.Sprintf("chain ends at %d but its head is at %d", report.Entries, head.Sequence))
+	}
+	if prevHash != head.Hash {
+		return fail(report.Entries, "last entry does not match the chain head")
+	}
+
+	return report, nil
+}
+
+// writeAuditTrail stores the audit entries recorded during the transaction
+// Each entry is stamped with the actor, org, transaction ID and timestamp, then
+// appended to the hash chain of every entity it involves (see auditChains).
+// The copies share the entry's EventID and differ only in their chain fields;
+// the first copy is listed in the actor index
+func writeAuditTrail(ctx RoutingContextInterface) error {
+	entries := ctx.GetAuditEntries()
+	if len(entries) == 0 {
+		return nil
+	}
+
+	actorID, orgType, err := auditActor(ctx)
+	if err != nil {
+		return err
+	}
+	now, err := txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+	txID := ctx.GetStub().GetTxID()
+
+	for i, entry := range entries {
+		entry.DocType = models.DocTypeAudit
+		entry.EventID = fmt.Sprintf("AUDIT-%s-%03d", txID, i)
+		entry.Timestamp = now
+		entry.OrgType = orgType
+		entry.ActorID = actorID
+		entry.TxID = txID
+
+		for j, chain := range auditChains(&entry) {
+			linked := entry
+			linked.EntityType = chain.entityType
+			linked.EntityID = chain.entityID
+			if err := appendToChain(ctx, &linked); err != nil {
+				return err
+			}
+			if j == 0 {
+				if err := indexAuditEntry(ctx, &linked); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// auditEntityTypes are the docTypes of the entities that have audit chains
+var auditEntityTypes = map[string]bool{
+	models.DocTypeMission: true,
+	models.DocTypeVehicle: true,
+	models.DocTypeSegment: true,
+	models.DocTypeOrg:     true,
+}
+
+// auditChain names an entity's audit chain; IDs are only unique within a type
+type auditChain struct {
+	entityType string
+	entityID   string
+}
+
+// auditChains lists the chains an entry belongs to: its mission, vehicle and
+// segment, or only the entity the caller named in EntityType and EntityID (e.g. an organization)
+func auditChains(entry *models.AuditEvent) []auditChain {
+	if entry.EntityID != "" {
+		return []auditChain{{entry.EntityType, entry.EntityID}}
+	}
+
+	chains := []auditChain{}
+	for _, chain := range []auditChain{
+		{models.DocTypeMission, entry.MissionID},
+		{models.DocTypeVehicle, entry.VehicleID},
+		{models.DocTypeSegment, entry.SegmentID},
+	} {
+		if chain.entityID != "" {
+			chains = append(chains, chain)
+		}
+	}
+	return chains
+}
+
+// appendToChain links an entry to the head of its entity's chain, stores it and moves the head
+func appendToChain(ctx RoutingContextInterface, entry *models.AuditEvent) error {
+	head, err := getAuditChainHead(ctx, entry.EntityType, entry.EntityID)
+	if err != nil {
+		return err
+	}
+
+	entry.Sequence = head.Sequence + 1
+	entry.PrevHash = head.Hash
+	entry.Hash, err = hashAuditEntry(*entry)
+	if err != nil {
+		return err
+	}
+
+	entryJSON, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to marshal audit entry: %v", err)
+	}
+	entryKey, err := auditEntryKey(ctx, entry.EntityType, entry.EntityID, entry.Sequence)
+	if err != nil {
+		return err
+	}
+	if err := ctx.WriteState(entryKey, entryJSON); err != nil {
+		return fmt.Errorf("failed to write state: %v", err)
+	}
+
+	head.Sequence = entry.Sequence
+	head.Hash = entry.Hash
+	headJSON, err := json.Marshal(head)
+	if err != nil {
+		return fmt.Errorf("failed to marshal audit chain head: %v", err)
+	}
+	headKey, err := auditHeadKey(ctx, entry.EntityType, entry.EntityID)
+	if err != nil {
+		return err
+	}
+	if err := ctx.WriteState(headKey, headJSON); err != nil {
+		return fmt.Errorf("failed to write state: %v", err)
+	}
+
+	return nil
+}
+
+// hashAuditEntry returns the hex SHA-256 of an entry's JSON with the Hash field empty
+func hashAuditEntry(entry models.AuditEvent) (string, error) {
+	entry.Hash = ""
+	entryJSON, err := json.Marshal(entry)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal audit entry: %v", err)
+	}
+	sum := sha256.Sum256(entryJSON)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// auditEntryKey is the key of an entry; zero-padding keeps a chain in sequence order
+func auditEntryKey(ctx RoutingContextInterface, entityType string, entityID string, sequence int64) (string, error) {
+	return ctx.GetStub().CreateCompositeKey(auditObjectType, []string{entityType, entityID, fmt.Sprintf("%019d", sequence)})
+}
+
+// auditHeadKey is the key of the head of an entity's chain
+func auditHeadKey(ctx RoutingContextInterface, entityType string, entityID string) (string, error) {
+	return ctx.GetStub().CreateCompositeKey(auditHeadObjectType, []string{entityType, entityID})
+}
+
+// getAuditChainHead reads the head of an entity's chain (an empty head if it has none)
+func getAuditChainHead(ctx RoutingContextInterface, entityType string, entityID string) (*models.AuditChainHead, error) {
+	headKey, err := auditHeadKey(ctx, entityType, entityID)
+	if err != nil {
+		return nil, err
+	}
+	headJSON, err := ctx.ReadState(headKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read state: %v", err)
+	}
+	head := &models.AuditChainHead{EntityType: entityType, EntityID: entityID}
+	if headJSON == nil {
+		return head, nil
+	}
+	if err := json.Unmarshal(headJSON, head); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal audit chain head: %v", err)
+	}
+	return head, nil
+}
+
+// auditMission records a mission state change on the audit trail
+func auditMission(ctx RoutingContextInterface, eventType string, mission *models.Mission, details map[string]interface{}) {
+	if details == nil {
+		details = map[string]interface{}{}
+	}
+	details["status"] = mission.Status
+	ctx.Audit(models.AuditEvent{
+		EventType: eventType,
+		MissionID: mission.MissionID,
+		VehicleID: mission.VehicleID,
+		Details:   details,
+	})
+}
+
+// auditActor identifies the caller for the audit trail
+// The client ID is decoded from base64 to its "x509::<subject>::<issuer>" form; the
+// org type falls back to the MSP ID for callers missing from the registry
+func auditActor(ctx RoutingContextInterface) (string, string, error) {
+	clientIdentity := ctx.GetClientIdentity()
+	actorID, err := clientIdentity.GetID()
+	if err != nil {
+		return "", "", fmt.Errorf("failed to get client ID: %v", err)
+	}
+	if decoded, err := base64.StdEncoding.DecodeString(actorID); err == nil {
+		actorID = string(decoded)
+	}
+
+	mspID, err := clientIdentity.GetMSPID()
+	if err != nil {
+		return "", "", fmt.Errorf("failed to get MSP ID: %v", err)
+	}
+	org, err := getOrganization(ctx, mspID)
+	if err != nil {
+		return "", "", err
+	}
+	if org == nil {
+		return actorID, mspID, nil
+	}
+	return actorID, org.OrgType, nil
+}
@@ -0,0 +1,240 @@
+package contracts
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/emergency-routing/chaincode/routing/models"
+)
+
+// auditChain reads the entries stored in an entity's audit chain, in sequence order
+func (l *ledger) auditChain(entityType string, entityID string) []models.AuditEvent {
+	l.t.Helper()
+
+	iterator, err := l.stub.GetStateByPartialCompositeKey(auditObjectType, []string{entityType, entityID})
+	if err != nil {
+		l.t.Fatal(err)
+	}
+	defer iterator.Close()
+
+	entries := []models.AuditEvent{}
+	for iterator.HasNext() {
+		result, err := iterator.Next()
+		if err != nil {
+			l.t.Fatal(err)
+		}
+		var entry models.AuditEvent
+		if err := json.Unmarshal(result.Value, &entry); err != nil {
+			l.t.Fatal(err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+// verifyChain runs VerifyAuditChain and returns its report
+func (l *ledger) verifyChain(entityType string, entityID string) models.AuditChainReport {
+	l.t.Helper()
+
+	var report models.AuditChainReport
+	payload := l.mustInvoke(medicalDispatcher, "AuditContract:VerifyAuditChain", entityType, entityID)
+	if err := json.Unmarshal([]byte(payload), &report); err != nil {
+		l.t.Fatal(err)
+	}
+	return report
+}
+
+func TestAuditEntryJoinsEveryInvolvedChain(t *testing.T) {
+	l := newLedger(t)
+	l.registerVehicle(medicalDispatcher, "AMB-1", "medical", "ambulance", 2)
+	l.startMission(medicalDispatcher, "M1", "AMB-1", "A", "B", "high", `[{"segmentId":"S1","fromNode":"A","toNode":"B"}]`)
+
+	eventIDs := func(entityType string, entityID string) map[string]bool {
+		ids := map[string]bool{}
+		for _, entry := range l.auditChain(entityType, entityID) {
+			if entry.EventType == models.EventSegmentReserved {
+				ids[entry.EventID] = true
+			}
+		}
+		return ids
+	}
+	missionEvents := eventIDs(models.DocTypeMission, "M1")
+	vehicleEvents := eventIDs(models.DocTypeVehicle, "AMB-1")
+	segmentEvents := eventIDs(models.DocTypeSegment, "S1")
+	if len(missionEvents) != 1 {
+		t.Fatalf("mission chain has %d reservation entries, want 1", len(missionEvents))
+	}
+	for eventID := range missionEvents {
+		if !vehicleEvents[eventID] || !segmentEvents[eventID] {
+			t.Fatalf("reservation %s is missing from the vehicle or segment chain", eventID)
+		}
+	}
+
+	for _, chain := range []auditChain{
+		{models.DocTypeMission, "M1"},
+		{models.DocTypeVehicle, "AMB-1"},
+		{models.DocTypeSegment, "S1"},
+	} {
+		if report := l.verifyChain(chain.entityType, chain.entityID); !report.Valid || report.Entries == 0 {
+			t.Fatalf("chain %+v: %+v", chain, report)
+		}
+	}
+}
+
+func TestAuditChainsAreKeptApartByEntityType(t *testing.T) {
+	// A mission named after its vehicle must not share the vehicle's chain
+	l := newLedger(t)
+	l.registerVehicle(medicalDispatcher, "AMB-1", "medical", "ambulance", 2)
+	l.startMission(medicalDispatcher, "AMB-1", "AMB-1", "A", "B", "high", `[{"segmentId":"S1","fromNode":"A","toNode":"B"}]`)
+
+	missionChain := l.auditChain(models.DocTypeMission, "AMB-1")
+	vehicleChain := l.auditChain(models.DocTypeVehicle, "AMB-1")
+	if len(vehicleChain) <= len(missionChain) {
+		t.Fatalf("vehicle chain (%d entries) should also hold its registration, mission chain has %d", len(vehicleChain), len(missionChain))
+	}
+	for _, entry := range missionChain {
+		if entry.EventType == models.EventVehicleRegistered {
+			t.Fatalf("vehicle registration %s leaked into the mission chain", entry.EventID)
+		}
+	}
+	for _, entityType := range []string{models.DocTypeMission, models.DocTypeVehicle} {
+		if report := l.verifyChain(entityType, "AMB-1"); !report.Valid {
+			t.Fatalf("%s chain AMB-1: %+v", entityType, report)
+		}
+	}
+	l.mustFail(medicalDispatcher, "invalid entity type", "AuditContract:VerifyAuditChain", "node", "AMB-1")
+}
+
+func TestVerifyAuditChainDetectsTampering(t *testing.T) {
+	l := newLedger(t)
+	l.registerVehicle(medicalDispatcher, "AMB-1", "medical", "ambulance", 2)
+	l.startMission(medicalDispatcher, "M1", "AMB-1", "A", "B", "high", `[{"segmentId":"S1","fromNode":"A","toNode":"B"}]`)
+
+	entry := l.auditChain(models.DocTypeSegment, "S1")[0]
+	entry.ActorID = "x509::CN=someone-else"
+	entryJSON, err := json.Marshal(entry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := l.stub.CreateCompositeKey(auditObjectType, []string{models.DocTypeSegment, "S1", "0000000000000000001"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.stub.State[key] = entryJSON
+
+	if report := l.verifyChain(models.DocTypeSegment, "S1"); report.Valid || report.FirstBadEntry != 1 {
+		t.Fatalf("tampered entry not reported: %+v", report)
+	}
+	if report := l.verifyChain(models.DocTypeMission, "M1"); !report.Valid {
+		t.Fatalf("untouched chain reported invalid: %+v", report)
+	}
+}
+
+// auditTrail runs GetAuditTrail with the given filters
+func (l *ledger) auditTrail(missionID, vehicleID, segmentID, actorID string, fromTime, toTime int64) []models.AuditEvent {
+	l.t.Helper()
+
+	var entries []models.AuditEvent
+	payload := l.mustInvoke(medicalDispatcher, "AuditContract:GetAuditTrail",
+		missionID, vehicleID, segmentID, actorID, fmt.Sprint(fromTime), fmt.Sprint(toTime))
+	if err := json.Unmarshal([]byte(payload), &entries); err != nil {
+		l.t.Fatal(err)
+	}
+	return entries
+}
+
+func TestGetAuditTrailReadsCompositeKeys(t *testing.T) {
+	// The mock stub has no rich query support, so this also shows no CouchDB query is made
+	l := newLedger(t)
+	l.registerVehicle(medicalDispatcher, "AMB-1", "medical", "ambulance", 2)
+	l.registerVehicle(policeDispatcher, "POL-1", "police", "patrol_car", 3)
+	start := l.now
+	l.startMission(medicalDispatcher, "M1", "AMB-1", "A", "B", "high", `[{"segmentId":"S1","fromNode":"A","toNode":"B"}]`)
+	l.now += 100
+	l.startMission(policeDispatcher, "P1", "POL-1", "C", "D", "low", `[{"segmentId":"S2","fromNode":"C","toNode":"D"}]`)
+
+	all := l.auditTrail("", "", "", "", 0, 0)
+	seen := map[string]bool{}
+	for i, entry := range all {
+		if seen[entry.EventID] {
+			t.Fatalf("entry %s returned twice", entry.EventID)
+		}
+		seen[entry.EventID] = true
+		if i > 0 && entry.Timestamp < all[i-1].Timestamp {
+			t.Fatal("entries are not oldest first")
+		}
+	}
+
+	count := func(match func(models.AuditEvent) bool) int {
+		n := 0
+		for _, entry := range all {
+			if match(entry) {
+				n++
+			}
+		}
+		return n
+	}
+	policeActor := ""
+	for _, entry := range all {
+		if entry.MissionID == "P1" {
+			policeActor = entry.ActorID
+		}
+	}
+
+	for _, tc := range []struct {
+		name                                     string
+		missionID, vehicleID, segmentID, actorID string
+		fromTime, toTime                         int64
+		match                                    func(models.AuditEvent) bool
+	}{
+		{"mission", "M1", "", "", "", 0, 0, func(e models.AuditEvent) bool { return e.MissionID == "M1" }},
+		{"vehicle", "", "AMB-1", "", "", 0, 0, func(e models.AuditEvent) bool { return e.VehicleID == "AMB-1" }},
+		{"segment", "", "", "S2", "", 0, 0, func(e models.AuditEvent) bool { return e.SegmentID == "S2" }},
+		{"actor", "", "", "", policeActor, 0, 0, func(e models.AuditEvent) bool { return e.ActorID == policeActor }},
+		{"mission and segment", "P1", "", "S2", "", 0, 0, func(e models.AuditEvent) bool { return e.MissionID == "P1" && e.SegmentID == "S2" }},
+		{"time range", "", "", "", "", start + 1, 0, func(e models.AuditEvent) bool { return e.Timestamp >= start+1 }},
+		{"unknown mission", "M9", "", "", "", 0, 0, func(e models.AuditEvent) bool { return false }},
+	} {
+		got := l.auditTrail(tc.missionID, tc.vehicleID, tc.segmentID, tc.actorID, tc.fromTime, tc.toTime)
+		for _, entry := range got {
+			if !tc.match(entry) {
+				t.Fatalf("%s: unexpected entry %+v", tc.name, entry)
+			}
+		}
+		if want := count(tc.match); len(got) != want {
+			t.Fatalf("%s: got %d entries, want %d", tc.name, len(got), want)
+		}
+	}
+}
+
+func TestBuildSecondaryIndexesListsAuditEntries(t *testing.T) {
+	l := newLedger(t)
+	l.registerVehicle(medicalDispatcher, "AMB-1", "medical", "ambulance", 2)
+	before := len(l.auditTrail("", "", "", "", 0, 0))
+	if before == 0 {
+		t.Fatal("no audit entries listed")
+	}
+
+	// Entries written before the actor index existed are not listed until the migration runs
+	iterator, err := l.stub.GetStateByPartialCompositeKey(auditActorIndex, []string{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for iterator.HasNext() {
+		result, err := iterator.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		l.stub.DelState(result.Key)
+	}
+	iterator.Close()
+	if got := len(l.auditTrail("", "", "", "", 0, 0)); got != 0 {
+		t.Fatalf("%d entries listed without the actor index", got)
+	}
+
+	l.mustInvoke(medicalAdmin, "MigrationContract:BuildSecondaryIndexes")
+	if got := len(l.auditTrail("", "", "", "", 0, 0)); got < before {
+		t.Fatalf("%d entries listed after the migration, want at least %d", got, before)
+	}
+}
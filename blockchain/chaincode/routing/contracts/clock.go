@@ -0,0 +1,31 @@
+package contracts
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// txTimestamp returns the transaction timestamp (Unix seconds) set by the client
+// in the proposal. Every endorsing peer sees the same value, unlike time.Now(),
+// so write sets stay identical across endorsements.
+func txTimestamp(ctx contractapi.TransactionContextInterface) (int64, error) {
+	ts, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return 0, fmt.Errorf("failed to read transaction timestamp: %v", err)
+	}
+	if ts == nil {
+		return 0, fmt.Errorf("transaction timestamp is not set")
+	}
+	return ts.GetSeconds(), nil
+}
+
+// txScopedID builds a chaincode-generated key from a prefix, optional parts and
+// the transaction ID (e.g. "CONFLICT-SEG_H01_I01-<txId>")
+// The TxID is identical on every endorser, so the key is deterministic
+func txScopedID(ctx contractapi.TransactionContextInterface, prefix string, parts ...string) string {
+	elems := append([]string{prefix}, parts...)
+	elems = append(elems, ctx.GetStub().GetTxID())
+	return strings.Join(elems, "-")
+}
@@ -0,0 +1,84 @@
+package contracts
+
+import (
+	"testing"
+)
+
+// endorse runs the same transactions on a fresh ledger and returns the write set
+// and event of each one, as one endorsing peer would produce them
+func endorse(t *testing.T) ([][]string, []string) {
+	l := newLedger(t)
+	l.registerVehicle(medicalDispatcher, "AMB-1", "medical", "ambulance", 2)
+	l.registerVehicle(policeDispatcher, "POL-1", "police", "patrol_car", 3)
+
+	steps := []func(){
+		func() {
+			l.mustInvoke(medicalDispatcher, "MissionContract:CreateMission", "M1", "AMB-1", "A", "C", "high", "")
+		},
+		func() {
+			l.mustInvoke(medicalDispatcher, "MissionContract:ActivateMission", "M1",
+				`[{"segmentId":"S1","fromNode":"A","toNode":"B"},{"segmentId":"S2","fromNode":"B","toNode":"C"}]`)
+		},
+		func() {
+			l.mustInvoke(policeDispatcher, "MissionContract:CreateMission", "P1", "POL-1", "A", "B", "critical", "")
+		},
+		func() {
+			l.mustInvoke(policeDispatcher, "MissionContract:ActivateMission", "P1", `[{"segmentId":"S1","fromNode":"A","toNode":"B"}]`)
+		},
+		func() {
+			l.mustInvoke(medicalDispatcher, "MissionContract:CompleteMission", "M1")
+		},
+	}
+
+	var writeSets [][]string
+	var events []string
+	for _, step := range steps {
+		step()
+		writeSets = append(writeSets, l.stub.writes)
+		events = append(events, string(l.stub.event))
+		l.now += 30
+	}
+	return writeSets, events
+}
+
+func TestEndorsementsProduceIdenticalWriteSets(t *testing.T) {
+	firstWrites, firstEvents := endorse(t)
+	secondWrites, secondEvents := endorse(t)
+
+	for i := range firstWrites {
+		if len(firstWrites[i]) == 0 {
+			t.Fatalf("transaction %d wrote nothing", i)
+		}
+		if len(firstWrites[i]) != len(secondWrites[i]) {
+			t.Fatalf("transaction %d: %d writes vs %d", i, len(firstWrites[i]), len(secondWrites[i]))
+		}
+		for j := range firstWrites[i] {
+			if firstWrites[i][j] != secondWrites[i][j] {
+				t.Fatalf("transaction %d write %d differs:\n%s\n%s", i, j, firstWrites[i][j], secondWrites[i][j])
+			}
+		}
+		if firstEvents[i] != secondEvents[i] {
+			t.Fatalf("transaction %d event differs:\n%s\n%s", i, firstEvents[i], secondEvents[i])
+		}
+	}
+}
+
+func TestConflictIDIsScopedToTransaction(t *testing.T) {
+	l := newLedger(t)
+	l.stub.MockTransactionStart("tx-fixed")
+	defer l.stub.MockTransactionEnd("tx-fixed")
+
+	ctx := new(RoutingContext)
+	ctx.SetStub(l.stub)
+	if got, want := txScopedID(ctx, "CONFLICT", "S1"), "CONFLICT-S1-tx-fixed"; got != want {
+		t.Fatalf("txScopedID = %s, want %s", got, want)
+	}
+
+	timestamp, err := txTimestamp(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if timestamp != l.stub.now {
+		t.Fatalf("txTimestamp = %d, want the proposal timestamp %d", timestamp, l.stub.now)
+	}
+}
@@ -0,0 +1,183 @@
+package contracts
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/emergency-routing/chaincode/routing/models"
+)
+
+// BlockSegment closes a segment to traffic during [startAt, endAt] (accident, flooding, parade)
+// startAt 0 means "from now", endAt 0 keeps the road closed until UnblockSegment
+// Reservations inside the closure are dropped and their missions are flagged for reroute.
+// Blocking a segment the caller's org already closed replaces that closure
+func (c *SegmentContract) BlockSegment(
+	ctx RoutingContextInterface,
+	segmentID string,
+	reason string,
+	startAt int64,
+	endAt int64,
+) error {
+	if reason == "" {
+		return fmt.Errorf("a reason is required to block segment %s", segmentID)
+	}
+
+	callerOrg, err := resolveCallerOrg(ctx)
+	if err != nil {
+		return err
+	}
+
+	segment, err := c.getSegment(ctx, segmentID)
+	if err != nil {
+		return err
+	}
+	if segment == nil {
+		segment = c.createFreeSegment(segmentID)
+	}
+
+	now, err := txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+
+	startAt, endAt, err = normalizeWindow(startAt, endAt, now)
+	if err != nil {
+		return err
+	}
+
+	liftEndedBlockage(segment, now)
+	if segment.Blockage != nil && segment.Blockage.OrgType != callerOrg.OrgType {
+		return fmt.Errorf("segment %s is already blocked by %s", segmentID, segment.Blockage.BlockedBy)
+	}
+
+	segment.Blockage = &models.Blockage{
+		Reason:    reason,
+		StartAt:   startAt,
+		EndAt:     endAt,
+		BlockedBy: callerOrg.MSPID,
+		OrgType:   callerOrg.OrgType,
+		BlockedAt: now,
+	}
+
+	// Expired reservations are released as usual, not flagged by the closure; the
+	// waitlist only gets the windows they free outside of it
+	if _, err := c.expireReservations(ctx, segment, now); err != nil {
+		return err
+	}
+	closed := removeReservations(segment, inWindow(startAt, endAt))
+
+	if _, err := c.writeSegment(ctx, segment); err != nil {
+		return err
+	}
+
+	// Missions that would drive the closed road must reroute
+	missionContract := &MissionContract{}
+	flagged := []string{}
+	for _, r := range closed {
+		err = missionContract.markPreempted(ctx, r.MissionID, models.PreemptedSegment{
+			SegmentID:   segmentID,
+			PreemptedAt: now,
+			Reason:      fmt.Sprintf("segment blocked: %s", reason),
+		})
+		if err != nil {
+			return err
+		}
+		flagged = append(flagged, r.MissionID)
+
+		ctx.Audit(models.AuditEvent{
+			EventType: models.EventSegmentBlocked,
+			MissionID: r.MissionID,
+			VehicleID: r.VehicleID,
+			SegmentID: segmentID,
+			Details: map[string]interface{}{
+				"reason":  reason,
+				"startAt": startAt,
+				"endAt":   endAt,
+			},
+		})
+	}
+
+	// Raise event
+	blockEvent := map[string]interface{}{
+		"type":            models.EventSegmentBlocked,
+		"segmentId":       segmentID,
+		"blockage":        segment.Blockage,
+		"flaggedMissions": flagged,
+	}
+	eventJSON, _ := json.Marshal(blockEvent)
+	ctx.RaiseEvent(models.EventSegmentBlocked, eventJSON)
+	ctx.Audit(models.AuditEvent{
+		EventType: models.EventSegmentBlocked,
+		SegmentID: segmentID,
+		Details: map[string]interface{}{
+			"reason":          reason,
+			"startAt":         startAt,
+			"endAt":           endAt,
+			"flaggedMissions": len(flagged),
+		},
+	})
+
+	return nil
+}
+
+// UnblockSegment reopens a segment closed by the caller's org
+// Queued requests that were waiting on the closure are granted
+func (c *SegmentContract) UnblockSegment(
+	ctx RoutingContextInterface,
+	segmentID string,
+) error {
+	callerOrg, err := resolveCallerOrg(ctx)
+	if err != nil {
+		return err
+	}
+
+	segment, err := c.getSegment(ctx, segmentID)
+	if err != nil {
+		return err
+	}
+	if segment == nil || segment.Blockage == nil {
+		return fmt.Errorf("segment %s is not blocked", segmentID)
+	}
+	if segment.Blockage.OrgType != callerOrg.OrgType {
+		return fmt.Errorf("cannot unblock segment %s blocked by %s", segmentID, segment.Blockage.BlockedBy)
+	}
+
+	segment.Blockage = nil
+
+	now, err := txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+	if err := c.grantWaitlist(ctx, segment, now); err != nil {
+		return err
+	}
+
+	return c.putSegment(ctx, segment, models.EventSegmentUnblocked, "", "")
+}
+
+// liftEndedBlockage clears a closure whose end time has passed
+// Returns true if the segment was reopened
+func liftEndedBlockage(segment *models.Segment, now int64) bool {
+	if segment.Blockage == nil || segment.Blockage.EndAt == 0 || segment.Blockage.EndAt > now {
+		return false
+	}
+	segment.Blockage = nil
+	return true
+}
+
+// closureActive reports whether a closure is in effect at now
+func closureActive(blockage *models.Blockage, now int64) bool {
+	return blockage != nil && blockage.StartAt <= now && (blockage.EndAt == 0 || now < blockage.EndAt)
+}
+
+// checkOpen rejects a window that falls inside a segment's closure
+func checkOpen(segment *models.Segment, enterAt int64, exitAt int64) error {
+	blockage := segment.Blockage
+	if blockage == nil || !windowsOverlap(blockage.StartAt, blockage.EndAt, enterAt, exitAt) {
+		return nil
+	}
+	if blockage.EndAt == 0 {
+		return fmt.Errorf("segment %s is blocked until further notice: %s", segment.SegmentID, blockage.Reason)
+	}
+	return fmt.Errorf("segment %s is blocked until %d: %s", segment.SegmentID, blockage.EndAt, blockage.Reason)
+}
@@ -0,0 +1,54 @@
+package contracts
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/emergency-routing/chaincode/routing/models"
+)
+
+// blockedSegments lists the segments GetSegmentsByStatus reports as blocked
+func (l *ledger) blockedSegments() []string {
+	l.t.Helper()
+
+	var segments []models.Segment
+	if err := json.Unmarshal([]byte(l.mustInvoke(medicalDispatcher, "SegmentContract:GetSegmentsByStatus", models.StatusBlocked)), &segments); err != nil {
+		l.t.Fatal(err)
+	}
+	ids := []string{}
+	for _, segment := range segments {
+		ids = append(ids, segment.SegmentID)
+	}
+	return ids
+}
+
+func TestScheduledClosureBlocksOnlyInsideItsWindow(t *testing.T) {
+	l := newLedger(t)
+	l.mustInvoke(trafficAuthority, "SegmentContract:BlockSegment", "S1", "parade", fmt.Sprint(l.now+100), fmt.Sprint(l.now+200))
+
+	if status := l.segment("S1").Status; status != models.StatusFree {
+		t.Fatalf("S1 is %s before the closure starts, want %s", status, models.StatusFree)
+	}
+	if blocked := l.blockedSegments(); len(blocked) != 0 {
+		t.Fatalf("segments listed as blocked before the closure starts: %v", blocked)
+	}
+
+	l.now += 100
+	if blocked := l.blockedSegments(); fmt.Sprint(blocked) != "[S1]" {
+		t.Fatalf("blocked segments once the closure started: %v, want [S1]", blocked)
+	}
+	l.mustInvoke(medicalDispatcher, "SegmentContract:SweepExpiredReservations", "10")
+	if status := l.segment("S1").Status; status != models.StatusBlocked {
+		t.Fatalf("S1 is stored as %s after the sweep, want %s", status, models.StatusBlocked)
+	}
+
+	l.now += 100
+	l.mustInvoke(medicalDispatcher, "SegmentContract:SweepExpiredReservations", "10")
+	if segment := l.segment("S1"); segment.Status != models.StatusFree || segment.Blockage != nil {
+		t.Fatalf("S1 should reopen when the closure ends, got %s with %+v", segment.Status, segment.Blockage)
+	}
+	if blocked := l.blockedSegments(); len(blocked) != 0 {
+		t.Fatalf("segments listed as blocked after the closure ended: %v", blocked)
+	}
+}
@@ -0,0 +1,156 @@
+package contracts
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/emergency-routing/chaincode/routing/models"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// RoutingContextInterface is the transaction context passed to every routing contract
+// It extends the standard context with per-transaction domain event and audit accumulators
+type RoutingContextInterface interface {
+	contractapi.TransactionContextInterface
+	RaiseEvent(eventType string, payload []byte)
+	GetEvents() []models.DomainEvent
+	Audit(entry models.AuditEvent)
+	GetAuditEntries() []models.AuditEvent
+	ReadState(key string) ([]byte, error)
+	WriteState(key string, value []byte) error
+	DeleteState(key string) error
+}
+
+// RoutingContext is the concrete transaction context used by all contracts
+type RoutingContext struct {
+	contractapi.TransactionContext
+	events []models.DomainEvent
+	audit  []models.AuditEvent
+	writes map[string][]byte
+}
+
+// ReadState reads a key, seeing writes made earlier in the same transaction
+// The peer's GetState only returns committed state, so without this a document
+// updated twice in one transaction (e.g. a mission preempted on two segments)
+// would lose the first update
+func (ctx *RoutingContext) ReadState(key string) ([]byte, error) {
+	if value, ok := ctx.writes[key]; ok {
+		return value, nil
+	}
+	return ctx.GetStub().GetState(key)
+}
+
+// WriteState writes a key and remembers the value for later reads in this transaction
+func (ctx *RoutingContext) WriteState(key string, value []byte) error {
+	err := ctx.GetStub().PutState(key, value)
+	if err != nil {
+		return err
+	}
+	if ctx.writes == nil {
+		ctx.writes = make(map[string][]byte)
+	}
+	ctx.writes[key] = value
+	return nil
+}
+
+// DeleteState deletes a key; later reads in this transaction see it as absent
+func (ctx *RoutingContext) DeleteState(key string) error {
+	err := ctx.GetStub().DelState(key)
+	if err != nil {
+		return err
+	}
+	if ctx.writes == nil {
+		ctx.writes = make(map[string][]byte)
+	}
+	ctx.writes[key] = nil
+	return nil
+}
+
+// RaiseEvent records a domain event to be emitted when the transaction ends
+func (ctx *RoutingContext) RaiseEvent(eventType string, payload []byte) {
+	ctx.events = append(ctx.events, models.DomainEvent{
+		Type:    eventType,
+		Payload: json.RawMessage(payload),
+	})
+}
+
+// GetEvents returns the domain events raised so far in this transaction
+func (ctx *RoutingContext) GetEvents() []models.DomainEvent {
+	return ctx.events
+}
+
+// Audit records a state change to be written to the audit trail when the transaction ends
+// Only the event type, related IDs and details need to be set; the rest is filled in on write
+func (ctx *RoutingContext) Audit(entry models.AuditEvent) {
+	ctx.audit = append(ctx.audit, entry)
+}
+
+// GetAuditEntries returns the audit entries recorded so far in this transaction
+func (ctx *RoutingContext) GetAuditEntries() []models.AuditEvent {
+	return ctx.audit
+}
+
+// newRoutingContract returns the base contract shared by all routing contracts,
+// wired with the routing context, the role check and the end-of-transaction flush
+func newRoutingContract(contractName string) contractapi.Contract {
+	return contractapi.Contract{
+		TransactionContextHandler: new(RoutingContext),
+		BeforeTransaction:         newAuthorizer(contractName),
+		AfterTransaction:          finishTransaction,
+	}
+}
+
+// finishTransaction writes the audit trail and emits the event envelope
+// Runs only after a successful transaction
+func finishTransaction(ctx RoutingContextInterface) error {
+	if err := writeAuditTrail(ctx); err != nil {
+		return err
+	}
+	return emitEvents(ctx)
+}
+
+// emitEvents publishes all events raised during the transaction as one envelope
+// Runs only after a successful transaction; no event is set if none were raised
+func emitEvents(ctx RoutingContextInterface) error {
+	events := ctx.GetEvents()
+	if len(events) == 0 {
+		return nil
+	}
+
+	envelope := models.EventEnvelope{
+		SchemaVersion: models.EventSchemaVersion,
+		TxID:          ctx.GetStub().GetTxID(),
+		Events:        events,
+	}
+	envelopeJSON, err := json.Marshal(envelope)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event envelope: %v", err)
+	}
+
+	err = ctx.GetStub().SetEvent(models.EventEnvelopeName, envelopeJSON)
+	if err != nil {
+		return fmt.Errorf("failed to set event: %v", err)
+	}
+
+	return nil
+}
+
+// NewVehicleContract returns a VehicleContract using the routing context
+func NewVehicleContract() *VehicleContract {
+	return &VehicleContract{Contract: newRoutingContract("VehicleContract")}
+}
+
+// NewSegmentContract returns a SegmentContract using the routing context
+func NewSegmentContract() *SegmentContract {
+	return &SegmentContract{Contract: newRoutingContract("SegmentContract")}
+}
+
+// NewMissionContract returns a MissionContract using the routing context
+func NewMissionContract() *MissionContract {
+	return &MissionContract{Contract: newRoutingContract("MissionContract")}
+}
+
+// NewAuditContract returns an AuditContract using the routing context
+func NewAuditContract() *AuditContract {
+	return &AuditContract{Contract: newRoutingContract("AuditContract")}
+}
@@ -0,0 +1,60 @@
+package contracts
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/emergency-routing/chaincode/routing/models"
+)
+
+func TestTransactionEmitsOneEnvelope(t *testing.T) {
+	l := newLedger(t)
+	l.registerVehicle(policeDispatcher, "POL-1", "police", "patrol_car", 3)
+	l.registerVehicle(medicalDispatcher, "AMB-1", "medical", "ambulance", 1)
+	l.startMission(policeDispatcher, "P1", "POL-1", "A", "B", "low", `[{"segmentId":"S1","fromNode":"A","toNode":"B"}]`)
+	l.mustInvoke(medicalDispatcher, "MissionContract:CreateMission", "M1", "AMB-1", "A", "B", "critical", "")
+
+	// Activating M1 reserves S1 and its intersections and preempts P1 in one transaction
+	l.mustInvoke(medicalDispatcher, "MissionContract:ActivateMission", "M1", `[{"segmentId":"S1","fromNode":"A","toNode":"B"}]`)
+
+	if l.stub.setEvents != 1 || l.stub.eventName != models.EventEnvelopeName {
+		t.Fatalf("SetEvent called %d times (last %q), want once with %q", l.stub.setEvents, l.stub.eventName, models.EventEnvelopeName)
+	}
+	var envelope models.EventEnvelope
+	if err := json.Unmarshal(l.stub.event, &envelope); err != nil {
+		t.Fatalf("failed to decode the envelope: %v", err)
+	}
+	txID := fmt.Sprintf("tx%04d", l.txSeq)
+	if envelope.SchemaVersion != models.EventSchemaVersion || envelope.TxID != txID {
+		t.Fatalf("envelope has schema %d and txId %q, want %d and %q", envelope.SchemaVersion, envelope.TxID, models.EventSchemaVersion, txID)
+	}
+
+	raised := map[string]int{}
+	order := []string{}
+	for _, event := range envelope.Events {
+		raised[event.Type]++
+		order = append(order, event.Type)
+		if !json.Valid(event.Payload) {
+			t.Fatalf("%s carries an invalid payload: %s", event.Type, event.Payload)
+		}
+	}
+	// P1 loses S1 and both its intersections
+	if raised[models.EventPreemptionTriggered] != 3 {
+		t.Fatalf("want 3 preemptions in the envelope, got %v", order)
+	}
+	for _, eventType := range []string{models.EventVehicleUpdated, models.EventMissionActivated} {
+		if raised[eventType] != 1 {
+			t.Fatalf("want one %s in the envelope, got %v", eventType, order)
+		}
+	}
+	if last := order[len(order)-1]; last != models.EventMissionActivated {
+		t.Fatalf("events out of order, the activation should come last: %v", order)
+	}
+
+	// A rejected transaction emits nothing
+	l.mustFail(medicalDispatcher, "is not in pending status", "MissionContract:ActivateMission", "M1", `[{"segmentId":"S1","fromNode":"A","toNode":"B"}]`)
+	if l.stub.setEvents != 0 {
+		t.Fatalf("a failed transaction emitted %s", l.stub.event)
+	}
+}
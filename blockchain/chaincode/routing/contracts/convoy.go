@@ -0,0 +1,485 @@
+package contracts
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/emergency-routing/chaincode/routing/models"
+)
+
+// ProposeConvoy proposes that a mission escorts a lead mission (e.g., police escorting
+// an ambulance). The caller's org accepts for the side(s) it owns; a link between two
+// orgs takes effect once the other org calls AcceptConvoy
+func (c *MissionContract) ProposeConvoy(
+	ctx RoutingContextInterface,
+	memberMissionID string,
+	leadMissionID string,
+) error {
+	if memberMissionID == leadMissionID {
+		return fmt.Errorf("a mission cannot escort itself")
+	}
+
+	member, err := c.GetMission(ctx, memberMissionID)
+	if err != nil {
+		return err
+	}
+	lead, err := c.GetMission(ctx, leadMissionID)
+	if err != nil {
+		return err
+	}
+	if err := checkConvoyCandidates(member, lead); err != nil {
+		return err
+	}
+
+	// The caller must own one side of the link
+	callerOrg, err := resolveCallerOrg(ctx)
+	if err != nil {
+		return err
+	}
+	ownsMember := callerOrg.OrgType == member.OrgType
+	ownsLead := callerOrg.OrgType == lead.OrgType
+	if !ownsMember && !ownsLead {
+		return fmt.Errorf("access denied: %s owns neither mission %s nor %s", callerOrg.MSPID, memberMissionID, leadMissionID)
+	}
+
+	now, err := txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+
+	member.Convoy = &models.ConvoyLink{
+		LeadMissionID:  leadMissionID,
+		Status:         models.ConvoyProposed,
+		LeadAccepted:   ownsLead,
+		MemberAccepted: ownsMember,
+		ProposedBy:     callerOrg.MSPID,
+		ProposedAt:     now,
+	}
+
+	// Missions of the same org need no second opinion
+	if ownsMember && ownsLead {
+		return c.linkConvoy(ctx, member, lead, now)
+	}
+
+	if err := putMission(ctx, member); err != nil {
+		return err
+	}
+
+	// Raise event
+	proposalEvent := map[string]interface{}{
+		"type":            models.EventConvoyProposed,
+		"memberMissionId": memberMissionID,
+		"leadMissionId":   leadMissionID,
+		"proposedBy":      callerOrg.MSPID,
+	}
+	eventJSON, _ := json.Marshal(proposalEvent)
+	ctx.RaiseEvent(models.EventConvoyProposed, eventJSON)
+	auditMission(ctx, models.EventConvoyProposed, member, map[string]interface{}{"leadMissionId": leadMissionID})
+	auditMission(ctx, models.EventConvoyProposed, lead, map[string]interface{}{"memberMissionId": memberMissionID})
+
+	return nil
+}
+
+// AcceptConvoy accepts a convoy proposal on behalf of the caller's org
+// Once both orgs accepted, the missions share reservations on the lead's path
+func (c *MissionContract) AcceptConvoy(
+	ctx RoutingContextInterface,
+	memberMissionID string,
+) error {
+	member, err := c.GetMission(ctx, memberMissionID)
+	if err != nil {
+		return err
+	}
+	if member.Convoy == nil || member.Convoy.Status != models.ConvoyProposed {
+		return fmt.Errorf("mission %s has no pending convoy proposal", memberMissionID)
+	}
+	lead, err := c.GetMission(ctx, member.Convoy.LeadMissionID)
+	if err != nil {
+		return err
+	}
+	if err := checkConvoyCandidates(member, lead); err != nil {
+		return err
+	}
+
+	callerOrg, err := resolveCallerOrg(ctx)
+	if err != nil {
+		return err
+	}
+	accepted := false
+	if callerOrg.OrgType == lead.OrgType && !member.Convoy.LeadAccepted {
+		member.Convoy.LeadAccepted = true
+		accepted = true
+	}
+	if callerOrg.OrgType == member.OrgType && !member.Convoy.MemberAccepted {
+		member.Convoy.MemberAccepted = true
+		accepted = true
+	}
+	if !accepted {
+		return fmt.Errorf("%s has nothing to accept on the convoy proposal of mission %s", callerOrg.MSPID, memberMissionID)
+	}
+
+	now, err := txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+
+	return c.linkConvoy(ctx, member, lead, now)
+}
+
+// LeaveConvoy removes a mission from its convoy, or withdraws or declines a proposal
+// Either org may call it. Reservations already shared stay in place
+func (c *MissionContract) LeaveConvoy(
+	ctx RoutingContextInterface,
+	memberMissionID string,
+) error {
+	member, err := c.GetMission(ctx, memberMissionID)
+	if err != nil {
+		return err
+	}
+	if member.Convoy == nil {
+		return fmt.Errorf("mission %s is not in a convoy", memberMissionID)
+	}
+	lead, err := c.GetMission(ctx, member.Convoy.LeadMissionID)
+	if err != nil {
+		return err
+	}
+
+	callerOrg, err := resolveCallerOrg(ctx)
+	if err != nil {
+		return err
+	}
+	if callerOrg.OrgType != member.OrgType && callerOrg.OrgType != lead.OrgType {
+		return fmt.Errorf("access denied: %s is not a party to the convoy of mission %s", callerOrg.MSPID, memberMissionID)
+	}
+
+	if member.Convoy.Status == models.ConvoyAccepted {
+		if err := c.removeConvoyMember(ctx, lead, memberMissionID); err != nil {
+			return err
+		}
+	}
+	member.Convoy = nil
+	if err := putMission(ctx, member); err != nil {
+		return err
+	}
+
+	unlinkEvent := map[string]interface{}{
+		"type":            models.EventConvoyUnlinked,
+		"memberMissionId": memberMissionID,
+		"leadMissionId":   lead.MissionID,
+		"by":              callerOrg.MSPID,
+	}
+	eventJSON, _ := json.Marshal(unlinkEvent)
+	ctx.RaiseEvent(models.EventConvoyUnlinked, eventJSON)
+	auditMission(ctx, models.EventConvoyUnlinked, member, map[string]interface{}{"leadMissionId": lead.MissionID})
+
+	return nil
+}
+
+// GetConvoyMembers retrieves the missions escorting a lead mission
+func (c *MissionContract) GetConvoyMembers(
+	ctx RoutingContextInterface,
+	leadMissionID string,
+) ([]*models.Mission, error) {
+	lead, err := c.GetMission(ctx, leadMissionID)
+	if err != nil {
+		return nil, err
+	}
+
+	members := []*models.Mission{}
+	for _, memberID := range lead.ConvoyMembers {
+		member, err := c.GetMission(ctx, memberID)
+		if err != nil {
+			return nil, err
+		}
+		members = append(members, member)
+	}
+
+	return members, nil
+}
+
+// checkConvoyCandidates rejects links that would nest convoys or join finished missions
+func checkConvoyCandidates(member *models.Mission, lead *models.Mission) error {
+	for _, mission := range []*models.Mission{member, lead} {
+		if mission.Status != models.MissionPending && !isMissionUnderway(mission.Status) {
+			return fmt.Errorf("mission %s is already %s", mission.MissionID, mission.Status)
+		}
+	}
+	if member.Convoy != nil && member.Convoy.Status == models.ConvoyAccepted {
+		return fmt.Errorf("mission %s already escorts %s", member.MissionID, member.Convoy.LeadMissionID)
+	}
+	if len(member.ConvoyMembers) > 0 {
+		return fmt.Errorf("mission %s leads a convoy and cannot escort another mission", member.MissionID)
+	}
+	if lead.Convoy != nil {
+		return fmt.Errorf("mission %s escorts %s and cannot lead a convoy", lead.MissionID, lead.Convoy.LeadMissionID)
+	}
+	if len(member.Waypoints) > 0 {
+		return fmt.Errorf("multi-stop mission %s cannot escort another mission", member.MissionID)
+	}
+	return nil
+}
+
+// linkConvoy puts an agreed link into effect
+// An escort still pending behind a lead that is already underway follows the
+// rest of the lead's path straight away. A lead whose remaining steps no longer drive
+// to its destination (stored before steps were kept, or holding segments it was
+// granted off its route) leaves its escort pending for the dispatcher to activate
+func (c *MissionContract) linkConvoy(
+	ctx RoutingContextInterface,
+	member *models.Mission,
+	lead *models.Mission,
+	now int64,
+) error {
+	member.Convoy.Status = models.ConvoyAccepted
+	member.Convoy.AcceptedAt = now
+	lead.ConvoyMembers = append(lead.ConvoyMembers, member.MissionID)
+
+	if err := putMission(ctx, lead); err != nil {
+		return err
+	}
+	if err := putMission(ctx, member); err != nil {
+		return err
+	}
+
+	// Raise event
+	linkEvent := map[string]interface{}{
+		"type":            models.EventConvoyLinked,
+		"memberMissionId": member.MissionID,
+		"leadMissionId":   lead.MissionID,
+		"memberOrg":       member.OrgType,
+		"leadOrg":         lead.OrgType,
+	}
+	eventJSON, _ := json.Marshal(linkEvent)
+	ctx.RaiseEvent(models.EventConvoyLinked, eventJSON)
+	auditMission(ctx, models.EventConvoyLinked, member, map[string]interface{}{"leadMissionId": lead.MissionID})
+	auditMission(ctx, models.EventConvoyLinked, lead, map[string]interface{}{"memberMissionId": member.MissionID})
+
+	if member.Status != models.MissionPending || !isMissionUnderway(lead.Status) {
+		return nil
+	}
+	if len(lead.Steps) != len(lead.Path) {
+		return nil
+	}
+	start := lead.CurrentIndex
+	if start < 0 {
+		start = 0
+	}
+	steps := append([]models.PathSegment{}, lead.Steps[start:]...)
+	if len(steps) == 0 || checkRoute(steps, nil, lead.DestNode) != nil {
+		return nil
+	}
+	return c.activateMission(ctx, member, steps)
+}
+
+// endConvoy settles the convoy of a mission that was just completed or aborted
+// A lead takes its escorts with it: those underway end the way it did, those never
+// activated are aborted. An escort leaves its lead's convoy
+func (c *MissionContract) endConvoy(
+	ctx RoutingContextInterface,
+	mission *models.Mission,
+) error {
+	for _, memberID := range mission.ConvoyMembers {
+		member, err := c.GetMission(ctx, memberID)
+		if err != nil {
+			return err
+		}
+		reason := fmt.Sprintf("convoy lead %s %s", mission.MissionID, mission.Status)
+		switch {
+		case member.Status == models.MissionPending:
+			err = c.closeMission(ctx, member, models.MissionAborted, reason)
+		case isMissionUnderway(member.Status):
+			err = c.closeMission(ctx, member, mission.Status, reason)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to close convoy member %s: %v", memberID, err)
+		}
+	}
+
+	if mission.Convoy != nil && mission.Convoy.Status == models.ConvoyAccepted {
+		lead, err := c.GetMission(ctx, mission.Convoy.LeadMissionID)
+		if err != nil {
+			return err
+		}
+		return c.removeConvoyMember(ctx, lead, mission.MissionID)
+	}
+
+	return nil
+}
+
+// closeMission completes or aborts a convoy member on behalf of its lead
+// Its reservations are released to the waitlist and its vehicle is made available again
+func (c *MissionContract) closeMission(
+	ctx RoutingContextInterface,
+	mission *models.Mission,
+	status string,
+	reason string,
+) error {
+	now, err := txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+
+	if isMissionUnderway(mission.Status) {
+		segmentContract := &SegmentContract{}
+		for _, seg := range mission.Path {
+			segment, err := segmentContract.getSegment(ctx, seg)
+			if err != nil {
+				return err
+			}
+			if segment == nil {
+				continue
+			}
+			released, _, err := segmentContract.releaseReservations(ctx, segment, byMission(mission.MissionID), nil, now)
+			if err != nil {
+				return err
+			}
+			if len(released) == 0 {
+				continue
+			}
+			if err := segmentContract.putSegment(ctx, segment, models.EventSegmentReleased, mission.MissionID, mission.VehicleID); err != nil {
+				return err
+			}
+		}
+		if err := releaseNodes(ctx, mission); err != nil {
+			return err
+		}
+
+		if err := setMissionVehicleStatus(ctx, mission.VehicleID, models.StatusActive); err != nil {
+			return err
+		}
+	}
+
+	mission.Status = status
+	mission.CompletedAt = now
+	if err := putMission(ctx, mission); err != nil {
+		return err
+	}
+
+	// Raise event
+	eventType := models.EventMissionCompleted
+	if status == models.MissionAborted {
+		eventType = models.EventMissionAborted
+	}
+	closeEvent := map[string]interface{}{
+		"mission": mission,
+		"reason":  reason,
+	}
+	eventJSON, _ := json.Marshal(closeEvent)
+	ctx.RaiseEvent(eventType, eventJSON)
+	auditMission(ctx, eventType, mission, map[string]interface{}{"reason": reason})
+
+	return nil
+}
+
+// unlinkEscorts ends the convoy of a lead whose route changed under its escorts
+// (UpdateMissionPath, HandoffMission): they no longer follow its path, so each is
+// unlinked with an event and goes on alone. Reservations already shared stay in place,
+// as in LeaveConvoy. The caller stores the lead
+func (c *MissionContract) unlinkEscorts(
+	ctx RoutingContextInterface,
+	lead *models.Mission,
+	reason string,
+) error {
+	for _, memberID := range lead.ConvoyMembers {
+		member, err := c.GetMission(ctx, memberID)
+		if err != nil {
+			return err
+		}
+		member.Convoy = nil
+		if err := putMission(ctx, member); err != nil {
+			return err
+		}
+
+		unlinkEvent := map[string]interface{}{
+			"type":            models.EventConvoyUnlinked,
+			"memberMissionId": memberID,
+			"leadMissionId":   lead.MissionID,
+			"reason":          reason,
+		}
+		eventJSON, _ := json.Marshal(unlinkEvent)
+		ctx.RaiseEvent(models.EventConvoyUnlinked, eventJSON)
+		auditMission(ctx, models.EventConvoyUnlinked, member, map[string]interface{}{
+			"leadMissionId": lead.MissionID,
+			"reason":        reason,
+		})
+	}
+	lead.ConvoyMembers = nil
+	return nil
+}
+
+// removeConvoyMember drops a mission from its lead's member list
+func (c *MissionContract) removeConvoyMember(
+	ctx RoutingContextInterface,
+	lead *models.Mission,
+	memberID string,
+) error {
+	members := []string{}
+	for _, id := range lead.ConvoyMembers {
+		if id != memberID {
+			members = append(members, id)
+		}
+	}
+	lead.ConvoyMembers = members
+	return putMission(ctx, lead)
+}
+
+// convoyOf returns the convoy a mission travels in, named after its lead mission
+// Returns "" for missions outside a convoy and for IDs that are not missions
+func convoyOf(ctx RoutingContextInterface, missionID string) (string, error) {
+	missionJSON, err := getEntityState(ctx, missionObjectType, missionID)
+	if err != nil {
+		return "", fmt.Errorf("failed to read state: %v", err)
+	}
+	if missionJSON == nil {
+		return "", nil
+	}
+
+	var mission models.Mission
+	if err := json.Unmarshal(missionJSON, &mission); err != nil {
+		return "", fmt.Errorf("failed to unmarshal mission: %v", err)
+	}
+	if len(mission.ConvoyMembers) > 0 {
+		return mission.MissionID, nil
+	}
+	if mission.Convoy != nil && mission.Convoy.Status == models.ConvoyAccepted {
+		return mission.Convoy.LeadMissionID, nil
+	}
+	return "", nil
+}
+
+// outsideConvoy drops the reservations held by the given mission's own convoy
+func outsideConvoy(ctx RoutingContextInterface, missionID string, reservations []models.Reservation) ([]models.Reservation, error) {
+	if len(reservations) == 0 {
+		return reservations, nil
+	}
+	convoy, err := convoyOf(ctx, missionID)
+	if err != nil || convoy == "" {
+		return reservations, err
+	}
+
+	others := []models.Reservation{}
+	for _, r := range reservations {
+		theirs, err := convoyOf(ctx, r.MissionID)
+		if err != nil {
+			return nil, err
+		}
+		if theirs != convoy {
+			others = append(others, r)
+		}
+	}
+	return others, nil
+}
+
+// putMission stores a mission document
+func putMission(ctx RoutingContextInterface, mission *models.Mission) error {
+	missionJSON, err := json.Marshal(mission)
+	if err != nil {
+		return fmt.Errorf("failed to marshal mission: %v", err)
+	}
+
+	err = putEntityState(ctx, missionObjectType, mission.MissionID, missionJSON)
+	if err != nil {
+		return fmt.Errorf("failed to write state: %v", err)
+	}
+	return nil
+}
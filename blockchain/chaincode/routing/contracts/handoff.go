@@ -0,0 +1,347 @@
+package contracts
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/emergency-routing/chaincode/routing/models"
+)
+
+// HandoffMission moves an underway mission and its reservations to another vehicle of
+// the same org in one transaction (e.g., when the assigned vehicle breaks down)
+// Segments on both the old and the new path change holder without ever being freed;
+// the rest of the old path is released and the rest of the new path is reserved.
+// A multi-stop mission takes one path per leg not yet driven, as in UpdateMissionPath,
+// and a convoy lead's escorts are unlinked
+func (c *MissionContract) HandoffMission(
+	ctx RoutingContextInterface,
+	missionID string,
+	newVehicleID string,
+	newPathJSON string,
+) error {
+	// Get mission
+	mission, err := c.GetMission(ctx, missionID)
+	if err != nil {
+		return err
+	}
+
+	// Verify mission is underway
+	if !isMissionUnderway(mission.Status) {
+		return fmt.Errorf("mission %s is not active (current: %s)", missionID, mission.Status)
+	}
+
+	// Verify caller org matches mission org
+	callerOrg, err := resolveCallerOrg(ctx)
+	if err != nil {
+		return err
+	}
+	if callerOrg.OrgType != mission.OrgType {
+		return fmt.Errorf("cannot hand off mission from different organization")
+	}
+
+	// Verify the new vehicle belongs to the same org and is available
+	if newVehicleID == mission.VehicleID {
+		return fmt.Errorf("mission %s is already assigned to vehicle %s", missionID, newVehicleID)
+	}
+	vehicleContract := &VehicleContract{}
+	newVehicle, err := vehicleContract.GetVehicle(ctx, newVehicleID)
+	if err != nil {
+		return err
+	}
+	if newVehicle.OrgType != mission.OrgType {
+		return fmt.Errorf("cannot hand off mission: vehicle %s belongs to %s, not %s", newVehicleID, newVehicle.OrgType, mission.OrgType)
+	}
+	if newVehicle.Status != models.StatusActive {
+		return fmt.Errorf("vehicle %s is not available (current: %s)", newVehicleID, newVehicle.Status)
+	}
+
+	// The mission's priority follows the new vehicle type
+	priorityLevel := mission.PriorityLevel
+	if mission.Severity != "" {
+		priorityLevel, err = effectivePriority(callerOrg, newVehicle.VehicleType, mission.Severity)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Parse new path - the new vehicle may start anywhere, the chaincode does not track it
+	steps, err := parseMissionPath(mission, newPathJSON, nil)
+	if err != nil {
+		return err
+	}
+	if len(steps) == 0 {
+		return fmt.Errorf("path cannot be empty")
+	}
+	newPath := []string{}
+	newPathSet := make(map[string]bool)
+	for _, step := range steps {
+		newPath = append(newPath, step.SegmentID)
+		newPathSet[step.SegmentID] = true
+	}
+	oldPathSet := make(map[string]bool)
+	for _, seg := range mission.Path {
+		oldPathSet[seg] = true
+	}
+
+	now, err := txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+
+	// Queued requests follow the mission before anything is released, so none is
+	// granted to the old vehicle on the way
+	segmentContract := &SegmentContract{}
+	route := *mission
+	route.Path = newPath
+	route.Steps = steps
+	route.CurrentIndex = -1
+	if err := segmentContract.handOffQueued(ctx, mission, &route, newVehicleID, priorityLevel); err != nil {
+		return err
+	}
+
+	// Release old segments that are not in the new path
+	released := []string{}
+	for _, seg := range mission.Path {
+		if newPathSet[seg] {
+			continue
+		}
+		segment, err := segmentContract.getSegment(ctx, seg)
+		if err != nil {
+			return err
+		}
+		if segment == nil {
+			continue
+		}
+		freed, _, err := segmentContract.releaseReservations(ctx, segment, byMission(missionID), nil, now)
+		if err != nil {
+			return err
+		}
+		if len(freed) == 0 {
+			continue
+		}
+		if err := segmentContract.putSegment(ctx, segment, models.EventSegmentReleased, missionID, mission.VehicleID); err != nil {
+			return err
+		}
+		released = append(released, seg)
+	}
+
+	// Carry kept reservations over to the new vehicle, reserve the rest
+	// A kept segment given a new ETA window is re-reserved for that window
+	kept := []string{}
+	conflicts := []*models.Conflict{}
+	for i := range steps {
+		if oldPathSet[steps[i].SegmentID] && steps[i].EnterAt == 0 && steps[i].ExitAt == 0 {
+			transferred, err := segmentContract.transferReservation(ctx, &steps[i], missionID, newVehicleID, priorityLevel, now)
+			if err != nil {
+				return err
+			}
+			if transferred {
+				kept = append(kept, steps[i].SegmentID)
+				continue
+			}
+		}
+		step := steps[i]
+
+		conflict, err := segmentContract.reserveSegment(
+			ctx,
+			step.SegmentID,
+			newVehicleID,
+			missionID,
+			mission.OrgType,
+			priorityLevel,
+			step.EnterAt,
+			step.ExitAt,
+			step.FromNode,
+			step.ToNode,
+			false,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to reserve segment %s: %v", step.SegmentID, err)
+		}
+		if conflict != nil {
+			conflicts = append(conflicts, conflict)
+		}
+	}
+
+	// Reload: reserving may have preempted or expired reservations and updated the mission
+	mission, err = c.GetMission(ctx, missionID)
+	if err != nil {
+		return err
+	}
+
+	// The new vehicle holds the intersections along the new path
+	nodeConflicts, err := c.reserveNodes(ctx, mission, newVehicleID, priorityLevel, steps)
+	if err != nil {
+		return err
+	}
+	conflicts = append(conflicts, nodeConflicts...)
+
+	oldVehicleID := mission.VehicleID
+	reason := fmt.Sprintf("convoy lead %s handed off to %s", missionID, newVehicleID)
+	if err := c.unlinkEscorts(ctx, mission, reason); err != nil {
+		return err
+	}
+	mission.VehicleID = newVehicleID
+	mission.PriorityLevel = priorityLevel
+	mission.Path = newPath
+	mission.Steps = steps
+	mission.CurrentIndex = -1
+	mission.Status = models.MissionActive
+	mission.StaleReason = ""
+	mission.LeaseExpiresAt = now + reservationLeaseSeconds
+	mission.Handoffs = append(mission.Handoffs, models.Handoff{
+		FromVehicleID: oldVehicleID,
+		ToVehicleID:   newVehicleID,
+		KeptSegments:  kept,
+		HandedOffAt:   now,
+		HandedOffBy:   callerOrg.MSPID,
+	})
+
+	missionJSON, err := json.Marshal(mission)
+	if err != nil {
+		return fmt.Errorf("failed to marshal mission: %v", err)
+	}
+
+	err = putEntityState(ctx, missionObjectType, missionID, missionJSON)
+	if err != nil {
+		return fmt.Errorf("failed to write state: %v", err)
+	}
+
+	// Swap the vehicles' statuses
+	if err := vehicleContract.UpdateVehicleStatus(ctx, oldVehicleID, models.StatusActive); err != nil {
+		return err
+	}
+	if err := vehicleContract.UpdateVehicleStatus(ctx, newVehicleID, models.StatusOnMission); err != nil {
+		return err
+	}
+
+	// Raise event - the handoff is audited on the mission and both vehicles' trails
+	handoffEvent := map[string]interface{}{
+		"type":          models.EventMissionHandedOff,
+		"missionId":     missionID,
+		"fromVehicleId": oldVehicleID,
+		"toVehicleId":   newVehicleID,
+		"path":          newPath,
+		"kept":          kept,
+		"released":      released,
+		"conflicts":     conflicts,
+	}
+	eventJSON, _ := json.Marshal(handoffEvent)
+	ctx.RaiseEvent(models.EventMissionHandedOff, eventJSON)
+	auditMission(ctx, models.EventMissionHandedOff, mission, map[string]interface{}{
+		"fromVehicleId": oldVehicleID,
+		"toVehicleId":   newVehicleID,
+		"kept":          kept,
+		"released":      released,
+		"conflicts":     len(conflicts),
+	})
+	ctx.Audit(models.AuditEvent{
+		EventType: models.EventMissionHandedOff,
+		MissionID: missionID,
+		VehicleID: oldVehicleID,
+		Details: map[string]interface{}{
+			"toVehicleId": newVehicleID,
+		},
+	})
+
+	return nil
+}
+
+// transferReservation moves a mission's live reservation on a step's segment to another
+// vehicle, keeping its window. Returns false if the mission no longer holds the segment,
+// or if the new priority no longer keeps a lane once the overlapping reservations are
+// counted (e.g. after the capacity was lowered); the step then takes the held window so
+// the caller settles it like any other request (see reserveSegment)
+func (c *SegmentContract) transferReservation(
+	ctx RoutingContextInterface,
+	step *models.PathSegment,
+	missionID string,
+	vehicleID string,
+	priorityLevel int,
+	now int64,
+) (bool, error) {
+	segment, err := c.getSegment(ctx, step.SegmentID)
+	if err != nil {
+		return false, err
+	}
+	if segment == nil {
+		return false, nil
+	}
+
+	i := findReservation(segment, byMission(missionID))
+	if i < 0 || expiredAt(now)(segment.Reservations[i]) {
+		return false, nil
+	}
+
+	held := segment.Reservations[i]
+	live, _ := splitReservations(segment.Reservations, expiredAt(now))
+	others, _ := splitReservations(live, byMission(missionID))
+	_, sameWay := splitReservations(others, sameDirection(held.Direction))
+	_, sameWay = splitReservations(sameWay, inWindow(held.EnterAt, held.ExitAt))
+	overlapping, err := outsideConvoy(ctx, missionID, sameWay)
+	if err != nil {
+		return false, err
+	}
+	if len(contenders(overlapping, segmentCapacity(segment))) > 0 {
+		step.EnterAt = held.EnterAt
+		step.ExitAt = held.ExitAt
+		return false, nil
+	}
+
+	// The new vehicle has not entered the segment yet
+	segment.Reservations[i].VehicleID = vehicleID
+	segment.Reservations[i].PriorityLevel = priorityLevel
+	segment.Reservations[i].Status = models.StatusReserved
+	segment.Reservations[i].LeaseExpiresAt = now + reservationLeaseSeconds
+
+	if err := c.putSegment(ctx, segment, models.EventSegmentReserved, missionID, vehicleID); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// handOffQueued moves a mission's queued requests to its new vehicle and priority, and
+// drops those whose step does not connect to route, the mission as it will be once
+// handed off (see routeSlot). The waitlists are re-sorted and stored
+func (c *SegmentContract) handOffQueued(
+	ctx RoutingContextInterface,
+	mission *models.Mission,
+	route *models.Mission,
+	vehicleID string,
+	priorityLevel int,
+) error {
+	segmentIDs, err := queuedSegments(ctx, mission)
+	if err != nil {
+		return err
+	}
+
+	for _, segmentID := range segmentIDs {
+		segment, err := c.getSegment(ctx, segmentID)
+		if err != nil {
+			return err
+		}
+		if segment == nil {
+			continue
+		}
+		queued := removeQueued(segment, byMission(mission.MissionID))
+		if len(queued) == 0 {
+			continue
+		}
+
+		for _, request := range queued {
+			step := models.PathSegment{SegmentID: segmentID, FromNode: request.Direction, ToNode: request.ToNode}
+			if slot, _ := routeSlot(route, step); slot < 0 {
+				continue
+			}
+			request.VehicleID = vehicleID
+			request.PriorityLevel = priorityLevel
+			segment.Waitlist = append(segment.Waitlist, request)
+		}
+		sortWaitlist(segment)
+
+		if err := c.putSegment(ctx, segment, models.EventSegmentQueued, mission.MissionID, vehicleID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,428 @@
+package contracts
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/emergency-routing/chaincode/routing/models"
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes/timestamp"
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-chaincode-go/shimtest"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	"github.com/hyperledger/fabric-protos-go/ledger/queryresult"
+	"github.com/hyperledger/fabric-protos-go/msp"
+	"github.com/hyperledger/fabric-protos-go/peer"
+)
+
+// attributeOID is the certificate extension Fabric CA uses for identity attributes
+var attributeOID = asn1.ObjectIdentifier{1, 2, 3, 4, 5, 6, 7, 8, 1}
+
+// identity is a test caller: an MSP plus the attributes and NodeOU on its certificate
+type identity struct {
+	mspID string
+	name  string
+	ou    string
+	attrs map[string]string
+}
+
+var (
+	medicalAdmin      = identity{mspID: "MedicalMSP", name: "Admin@medical", ou: "admin"}
+	medicalDispatcher = identity{mspID: "MedicalMSP", name: "dispatch@medical", attrs: map[string]string{"role": models.RoleDispatcher}}
+	policeDispatcher  = identity{mspID: "PoliceMSP", name: "dispatch@police", attrs: map[string]string{"role": models.RoleDispatcher}}
+	trafficAuthority  = identity{mspID: "PoliceMSP", name: "authority@police", attrs: map[string]string{"role": models.RoleAuthority}}
+)
+
+// driver returns a driver identity bound to one vehicle
+func driver(mspID string, vehicleID string) identity {
+	return identity{
+		mspID: mspID,
+		name:  "driver-" + vehicleID,
+		attrs: map[string]string{"role": models.RoleDriver, "vehicleId": vehicleID},
+	}
+}
+
+// serialize issues a self-signed certificate for the identity and wraps it the way
+// the peer presents the creator to the chaincode
+func (id identity) serialize(t *testing.T) []byte {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: id.name},
+		NotBefore:    time.Unix(0, 0),
+		NotAfter:     time.Unix(4102444800, 0),
+	}
+	if id.ou != "" {
+		template.Subject.OrganizationalUnit = []string{id.ou}
+	}
+	if len(id.attrs) > 0 {
+		attrsJSON, err := json.Marshal(map[string]interface{}{"attrs": id.attrs})
+		if err != nil {
+			t.Fatalf("failed to marshal attributes: %v", err)
+		}
+		template.ExtraExtensions = []pkix.Extension{{Id: attributeOID, Value: attrsJSON}}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("failed to create certificate: %v", err)
+	}
+
+	creator, err := proto.Marshal(&msp.SerializedIdentity{
+		Mspid:   id.mspID,
+		IdBytes: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+	})
+	if err != nil {
+		t.Fatalf("failed to marshal identity: %v", err)
+	}
+	return creator
+}
+
+// testStub is a MockStub whose creator, clock and arguments are set per call,
+// and which records the write set and events of the last transaction and the
+// history of every key
+type testStub struct {
+	*shimtest.MockStub
+	args      [][]byte
+	creator   []byte
+	now       int64
+	writes    []string
+	event     []byte
+	eventName string
+	setEvents int
+	history   map[string][]*queryresult.KeyModification
+}
+
+func (s *testStub) GetArgs() [][]byte { return s.args }
+
+func (s *testStub) GetStringArgs() []string {
+	args := []string{}
+	for _, arg := range s.args {
+		args = append(args, string(arg))
+	}
+	return args
+}
+
+func (s *testStub) GetFunctionAndParameters() (string, []string) {
+	args := s.GetStringArgs()
+	if len(args) == 0 {
+		return "", nil
+	}
+	return args[0], args[1:]
+}
+
+func (s *testStub) GetCreator() ([]byte, error) { return s.creator, nil }
+
+func (s *testStub) GetTxTimestamp() (*timestamp.Timestamp, error) {
+	return &timestamp.Timestamp{Seconds: s.now}, nil
+}
+
+func (s *testStub) PutState(key string, value []byte) error {
+	s.writes = append(s.writes, key+"="+string(value))
+	s.record(key, value, false)
+	return s.MockStub.PutState(key, value)
+}
+
+func (s *testStub) DelState(key string) error {
+	s.writes = append(s.writes, key+"=<deleted>")
+	s.record(key, nil, true)
+	return s.MockStub.DelState(key)
+}
+
+// record adds a version to a key's history; as on a peer, only the last write of
+// a transaction is kept
+func (s *testStub) record(key string, value []byte, isDelete bool) {
+	if s.history == nil {
+		s.history = map[string][]*queryresult.KeyModification{}
+	}
+	version := &queryresult.KeyModification{
+		TxId:      s.TxID,
+		Value:     value,
+		Timestamp: &timestamp.Timestamp{Seconds: s.now},
+		IsDelete:  isDelete,
+	}
+	versions := s.history[key]
+	if n := len(versions); n > 0 && versions[n-1].TxId == s.TxID {
+		versions[n-1] = version
+		return
+	}
+	s.history[key] = append(versions, version)
+}
+
+// GetHistoryForKey returns a key's versions newest first, as the peer does
+func (s *testStub) GetHistoryForKey(key string) (shim.HistoryQueryIteratorInterface, error) {
+	versions := s.history[key]
+	newestFirst := make([]*queryresult.KeyModification, 0, len(versions))
+	for i := len(versions) - 1; i >= 0; i-- {
+		newestFirst = append(newestFirst, versions[i])
+	}
+	return &historyIterator{versions: newestFirst}, nil
+}
+
+// GetStateByPartialCompositeKeyWithPagination pages through a composite key range.
+// The bookmark is the key the next page starts at, empty once the range is exhausted
+func (s *testStub) GetStateByPartialCompositeKeyWithPagination(objectType string, attributes []string,
+	pageSize int32, bookmark string) (shim.StateQueryIteratorInterface, *peer.QueryResponseMetadata, error) {
+	all, err := s.MockStub.GetStateByPartialCompositeKey(objectType, attributes)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer all.Close()
+
+	page := &pageIterator{}
+	next := ""
+	for all.HasNext() {
+		kv, err := all.Next()
+		if err != nil {
+			return nil, nil, err
+		}
+		if kv.Key < bookmark {
+			continue
+		}
+		if int32(len(page.results)) == pageSize {
+			next = kv.Key
+			break
+		}
+		page.results = append(page.results, kv)
+	}
+	return page, &peer.QueryResponseMetadata{FetchedRecordsCount: int32(len(page.results)), Bookmark: next}, nil
+}
+
+// pageIterator walks one page of results read by testStub
+type pageIterator struct {
+	results []*queryresult.KV
+}
+
+func (it *pageIterator) HasNext() bool { return len(it.results) > 0 }
+
+func (it *pageIterator) Next() (*queryresult.KV, error) {
+	if len(it.results) == 0 {
+		return nil, fmt.Errorf("no more results")
+	}
+	result := it.results[0]
+	it.results = it.results[1:]
+	return result, nil
+}
+
+func (it *pageIterator) Close() error { return nil }
+
+// historyIterator walks a key history recorded by testStub
+type historyIterator struct {
+	versions []*queryresult.KeyModification
+}
+
+func (it *historyIterator) HasNext() bool { return len(it.versions) > 0 }
+
+func (it *historyIterator) Next() (*queryresult.KeyModification, error) {
+	if len(it.versions) == 0 {
+		return nil, fmt.Errorf("no more versions")
+	}
+	version := it.versions[0]
+	it.versions = it.versions[1:]
+	return version, nil
+}
+
+func (it *historyIterator) Close() error { return nil }
+
+func (s *testStub) SetEvent(name string, payload []byte) error {
+	s.event = payload
+	s.eventName = name
+	s.setEvents++
+	return nil
+}
+
+// ledger runs transactions against one world state, the way a single peer would
+type ledger struct {
+	t     *testing.T
+	cc    *contractapi.ContractChaincode
+	stub  *testStub
+	ids   map[string][]byte
+	now   int64
+	txSeq int
+}
+
+// newLedger returns a ledger with the default org registry, seeded by the medical admin
+func newLedger(t *testing.T) *ledger {
+	t.Helper()
+
+	cc, err := contractapi.NewChaincode(
+		NewVehicleContract(),
+		NewSegmentContract(),
+		NewMissionContract(),
+		NewOrgContract(),
+		NewAuditContract(),
+		NewMigrationContract(),
+	)
+	if err != nil {
+		t.Fatalf("failed to create chaincode: %v", err)
+	}
+
+	l := &ledger{
+		t:    t,
+		cc:   cc,
+		stub: &testStub{MockStub: shimtest.NewMockStub("routing", nil)},
+		ids:  map[string][]byte{},
+		now:  1700000000,
+	}
+	l.mustInvoke(medicalAdmin, "OrgContract:InitOrgRegistry", "")
+	return l
+}
+
+// invoke submits a transaction as the given caller and returns its payload,
+// or the error message the chaincode answered with
+func (l *ledger) invoke(caller identity, fn string, args ...string) (string, error) {
+	l.t.Helper()
+
+	creator, ok := l.ids[caller.name]
+	if !ok {
+		creator = caller.serialize(l.t)
+		l.ids[caller.name] = creator
+	}
+
+	l.txSeq++
+	txID := fmt.Sprintf("tx%04d", l.txSeq)
+	l.stub.args = [][]byte{[]byte(fn)}
+	for _, arg := range args {
+		l.stub.args = append(l.stub.args, []byte(arg))
+	}
+	l.stub.creator = creator
+	l.stub.now = l.now
+	l.stub.writes = nil
+	l.stub.event = nil
+	l.stub.eventName = ""
+	l.stub.setEvents = 0
+
+	l.stub.MockTransactionStart(txID)
+	response := l.cc.Invoke(l.stub)
+	l.stub.MockTransactionEnd(txID)
+
+	if response.Status != 200 {
+		return "", fmt.Errorf("%s", response.Message)
+	}
+	return string(response.Payload), nil
+}
+
+// mustInvoke is invoke for transactions the test expects to succeed
+func (l *ledger) mustInvoke(caller identity, fn string, args ...string) string {
+	l.t.Helper()
+
+	payload, err := l.invoke(caller, fn, args...)
+	if err != nil {
+		l.t.Fatalf("%s failed: %v", fn, err)
+	}
+	return payload
+}
+
+// mustFail is invoke for transactions the test expects to be rejected with
+// an error containing want
+func (l *ledger) mustFail(caller identity, want string, fn string, args ...string) {
+	l.t.Helper()
+
+	_, err := l.invoke(caller, fn, args...)
+	if err == nil {
+		l.t.Fatalf("%s succeeded, want error containing %q", fn, want)
+	}
+	if !strings.Contains(err.Error(), want) {
+		l.t.Fatalf("%s failed with %q, want error containing %q", fn, err, want)
+	}
+}
+
+// segment reads a segment as stored
+func (l *ledger) segment(segmentID string) models.Segment {
+	l.t.Helper()
+
+	var segment models.Segment
+	l.decode(segmentObjectType, segmentID, &segment)
+	return segment
+}
+
+// mission reads a mission as stored
+func (l *ledger) mission(missionID string) models.Mission {
+	l.t.Helper()
+
+	var mission models.Mission
+	l.decode(missionObjectType, missionID, &mission)
+	return mission
+}
+
+// node reads an intersection as stored
+func (l *ledger) node(nodeID string) models.Node {
+	l.t.Helper()
+
+	var node models.Node
+	l.decode(nodeObjectType, nodeID, &node)
+	return node
+}
+
+// decode reads an entity straight from the mock world state
+func (l *ledger) decode(objectType string, id string, v interface{}) {
+	l.t.Helper()
+
+	key, err := l.stub.CreateCompositeKey(objectType, []string{id})
+	if err != nil {
+		l.t.Fatalf("failed to create key: %v", err)
+	}
+	value := l.stub.State[key]
+	if value == nil {
+		l.t.Fatalf("%s %s not found", objectType, id)
+	}
+	if err := json.Unmarshal(value, v); err != nil {
+		l.t.Fatalf("failed to unmarshal %s %s: %v", objectType, id, err)
+	}
+}
+
+// registerVehicle registers a vehicle as the org's dispatcher
+func (l *ledger) registerVehicle(caller identity, vehicleID string, orgType string, vehicleType string, priority int) {
+	l.t.Helper()
+	l.mustInvoke(caller, "VehicleContract:RegisterVehicle", vehicleID, orgType, vehicleType, fmt.Sprint(priority))
+}
+
+// startMission creates and activates a mission along the given path JSON
+func (l *ledger) startMission(caller identity, missionID string, vehicleID string, origin string, dest string, severity string, pathJSON string) {
+	l.t.Helper()
+	l.mustInvoke(caller, "MissionContract:CreateMission", missionID, vehicleID, origin, dest, severity, "")
+	l.mustInvoke(caller, "MissionContract:ActivateMission", missionID, pathJSON)
+}
+
+// seedSegment stores a segment as legacy or out-of-band state would have left it,
+// outside of any contract transaction
+func (l *ledger) seedSegment(segment models.Segment) {
+	l.t.Helper()
+
+	l.stub.MockTransactionStart("seed")
+	defer l.stub.MockTransactionEnd("seed")
+
+	ctx := new(RoutingContext)
+	ctx.SetStub(l.stub)
+	segment.DocType = models.DocTypeSegment
+	if _, err := (&SegmentContract{}).writeSegment(ctx, &segment); err != nil {
+		l.t.Fatalf("failed to seed segment %s: %v", segment.SegmentID, err)
+	}
+}
+
+// pendingConflicts returns the conflicts awaiting resolution
+func (l *ledger) pendingConflicts() []models.Conflict {
+	l.t.Helper()
+
+	var conflicts []models.Conflict
+	payload := l.mustInvoke(medicalDispatcher, "SegmentContract:GetPendingConflicts")
+	if err := json.Unmarshal([]byte(payload), &conflicts); err != nil {
+		l.t.Fatalf("failed to unmarshal conflicts: %v", err)
+	}
+	return conflicts
+}
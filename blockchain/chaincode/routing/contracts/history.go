@@ -0,0 +1,72 @@
+package contracts
+
+import (
+	"fmt"
+)
+
+// keyVersion is one committed version of an entity key
+type keyVersion struct {
+	txID      string
+	timestamp int64
+	isDelete  bool
+	value     []byte
+}
+
+// keyHistory returns the committed versions of an entity key, oldest first
+// fromTime and toTime bound the transaction timestamp (inclusive); 0 leaves that side open
+// Requires history to be enabled on the peer (core.ledger.history.enableHistoryDatabase)
+func keyHistory(
+	ctx RoutingContextInterface,
+	objectType string,
+	id string,
+	fromTime int64,
+	toTime int64,
+) ([]keyVersion, error) {
+	if id == "" {
+		return nil, fmt.Errorf("ID cannot be empty")
+	}
+	if fromTime > 0 && toTime > 0 && toTime < fromTime {
+		return nil, fmt.Errorf("invalid time range: %d is before %d", toTime, fromTime)
+	}
+
+	key, err := entityKey(ctx, objectType, id)
+	if err != nil {
+		return nil, err
+	}
+
+	resultsIterator, err := ctx.GetStub().GetHistoryForKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read history of %s: %v", id, err)
+	}
+	defer resultsIterator.Close()
+
+	// The peer returns the newest version first
+	var versions []keyVersion
+	for resultsIterator.HasNext() {
+		modification, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		timestamp := modification.GetTimestamp().GetSeconds()
+		if fromTime > 0 && timestamp < fromTime {
+			continue
+		}
+		if toTime > 0 && timestamp > toTime {
+			continue
+		}
+
+		versions = append(versions, keyVersion{
+			txID:      modification.GetTxId(),
+			timestamp: timestamp,
+			isDelete:  modification.GetIsDelete(),
+			value:     modification.GetValue(),
+		})
+	}
+
+	for i, j := 0, len(versions)-1; i < j; i, j = i+1, j-1 {
+		versions[i], versions[j] = versions[j], versions[i]
+	}
+
+	return versions, nil
+}
@@ -0,0 +1,92 @@
+package contracts
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/emergency-routing/chaincode/routing/models"
+)
+
+// missionHistory reads a mission's versions between fromTime and toTime
+func (l *ledger) missionHistory(missionID string, fromTime int64, toTime int64) []*models.MissionVersion {
+	l.t.Helper()
+
+	var history []*models.MissionVersion
+	payload := l.mustInvoke(medicalDispatcher, "MissionContract:GetMissionHistory", missionID, fmt.Sprint(fromTime), fmt.Sprint(toTime))
+	if err := json.Unmarshal([]byte(payload), &history); err != nil {
+		l.t.Fatalf("failed to decode the history of %s: %v", missionID, err)
+	}
+	return history
+}
+
+func TestHistoryListsVersionsOldestFirst(t *testing.T) {
+	l := newLedger(t)
+	l.registerVehicle(medicalDispatcher, "AMB-1", "medical", "ambulance", 2)
+
+	created := l.now
+	l.mustInvoke(medicalDispatcher, "MissionContract:CreateMission", "M1", "AMB-1", "A", "B", "high", "")
+	l.now += 60
+	activated := l.now
+	l.mustInvoke(medicalDispatcher, "MissionContract:ActivateMission", "M1", `[{"segmentId":"S1","fromNode":"A","toNode":"B"}]`)
+	l.now += 60
+	completed := l.now
+	l.mustInvoke(medicalDispatcher, "MissionContract:CompleteMission", "M1")
+
+	// One version per transaction, however often it wrote the mission
+	history := l.missionHistory("M1", 0, 0)
+	want := []struct {
+		timestamp int64
+		status    string
+	}{
+		{created, models.MissionPending},
+		{activated, models.MissionActive},
+		{completed, models.MissionCompleted},
+	}
+	if len(history) != len(want) {
+		t.Fatalf("got %d versions of M1, want %d", len(history), len(want))
+	}
+	for i, w := range want {
+		if history[i].Timestamp != w.timestamp || history[i].Mission == nil || history[i].Mission.Status != w.status || history[i].TxID == "" {
+			t.Fatalf("version %d is %+v, want %s at %d", i, history[i], w.status, w.timestamp)
+		}
+	}
+
+	// Both bounds are inclusive
+	if between := l.missionHistory("M1", activated, completed); len(between) != 2 || between[0].Timestamp != activated {
+		t.Fatalf("got %d versions between %d and %d, want 2", len(between), activated, completed)
+	}
+	if since := l.missionHistory("M1", completed, 0); len(since) != 1 || since[0].Mission.Status != models.MissionCompleted {
+		t.Fatalf("got %d versions since %d, want the completed one", len(since), completed)
+	}
+
+	var segmentHistory []*models.SegmentVersion
+	if err := json.Unmarshal([]byte(l.mustInvoke(medicalDispatcher, "SegmentContract:GetSegmentHistory", "S1", "0", "0")), &segmentHistory); err != nil {
+		t.Fatalf("failed to decode the history of S1: %v", err)
+	}
+	if len(segmentHistory) != 2 || segmentHistory[0].Segment.Status != models.StatusReserved || segmentHistory[1].Segment.Status != models.StatusFree {
+		t.Fatalf("S1 should have been reserved then freed, got %d versions", len(segmentHistory))
+	}
+
+	var vehicleHistory []*models.VehicleVersion
+	if err := json.Unmarshal([]byte(l.mustInvoke(medicalDispatcher, "VehicleContract:GetVehicleHistory", "AMB-1", fmt.Sprint(activated), "0")), &vehicleHistory); err != nil {
+		t.Fatalf("failed to decode the history of AMB-1: %v", err)
+	}
+	if len(vehicleHistory) != 2 || vehicleHistory[0].Vehicle.Status != models.StatusOnMission || vehicleHistory[1].Vehicle.Status != models.StatusActive {
+		t.Fatalf("AMB-1 should have gone on the mission and back, got %d versions", len(vehicleHistory))
+	}
+}
+
+func TestHistoryRejectsBadArguments(t *testing.T) {
+	l := newLedger(t)
+
+	l.mustFail(medicalDispatcher, "invalid time range", "MissionContract:GetMissionHistory", "M1", "200", "100")
+	l.mustFail(medicalDispatcher, "invalid time range", "SegmentContract:GetSegmentHistory", "S1", "200", "100")
+	l.mustFail(medicalDispatcher, "invalid time range", "VehicleContract:GetVehicleHistory", "AMB-1", "200", "100")
+	l.mustFail(medicalDispatcher, "ID cannot be empty", "MissionContract:GetMissionHistory", "", "0", "0")
+
+	// A key never written has no history
+	if history := l.missionHistory("M9", 0, 0); len(history) != 0 {
+		t.Fatalf("M9 was never written but has %d versions", len(history))
+	}
+}
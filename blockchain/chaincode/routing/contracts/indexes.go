@@ -0,0 +1,247 @@
+package contracts
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+)
+
+// Secondary index namespaces - one key per entity made of the indexed attributes
+// and the entity ID. List queries read them with GetStateByPartialCompositeKey instead
+// of CouchDB rich queries, so they work on LevelDB and are re-checked for phantom
+// reads when a submit transaction is validated
+const (
+	vehicleOrgIndex     = "vehicle~org~id"
+	missionStatusIndex  = "mission~status~id"
+	missionOrgIndex     = "mission~org~id"
+	missionVehicleIndex = "mission~vehicle~status~id"
+	segmentStatusIndex  = "segment~status~id"
+	segmentClosureIndex = "segment~closure~id"
+	nodeStatusIndex     = "node~status~id"
+	conflictStatusIndex = "conflict~status~id"
+
+	// One key per audit event, keyed on the actor and pointing at one copy of the
+	// entry in the audit chains (see GetAuditTrail)
+	auditActorIndex = "audit~actor~type~entity~seq"
+)
+
+// indexMarker is the value stored under index keys (an empty value would delete the key)
+var indexMarker = []byte{0x00}
+
+// secondaryIndex names the document fields an index is keyed on, in key order
+// Nested fields are written as a dotted path. A sparse index has no key for
+// documents where one of its fields is empty or missing
+type secondaryIndex struct {
+	objectType string
+	fields     []string
+	sparse     bool
+}
+
+// secondaryIndexes lists the indexes maintained for each entity namespace
+var secondaryIndexes = map[string][]secondaryIndex{
+	vehicleObjectType: {
+		{objectType: vehicleOrgIndex, fields: []string{"orgType"}},
+	},
+	missionObjectType: {
+		{objectType: missionStatusIndex, fields: []string{"status"}},
+		{objectType: missionOrgIndex, fields: []string{"orgType"}},
+		{objectType: missionVehicleIndex, fields: []string{"vehicleId", "status"}},
+	},
+	segmentObjectType: {
+		{objectType: segmentStatusIndex, fields: []string{"status"}},
+		// Segments with a closure, current or scheduled, by the org that closed them
+		{objectType: segmentClosureIndex, fields: []string{"blockage.orgType"}, sparse: true},
+	},
+	nodeObjectType: {
+		{objectType: nodeStatusIndex, fields: []string{"status"}},
+	},
+	conflictObjectType: {
+		{objectType: conflictStatusIndex, fields: []string{"status"}},
+	},
+}
+
+// indexKeys returns the index keys of a document (none for a nil document)
+func indexKeys(ctx RoutingContextInterface, objectType string, id string, doc []byte) ([]string, error) {
+	indexes := secondaryIndexes[objectType]
+	if doc == nil || len(indexes) == 0 {
+		return nil, nil
+	}
+
+	var fields map[string]interface{}
+	if err := json.Unmarshal(doc, &fields); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal document %s: %v", id, err)
+	}
+
+	keys := make([]string, 0, len(indexes))
+	for _, index := range indexes {
+		attributes := make([]string, 0, len(index.fields)+1)
+		for _, field := range index.fields {
+			attributes = append(attributes, fieldValue(fields, field))
+		}
+		if index.sparse && containsEmpty(attributes) {
+			continue
+		}
+		key, err := ctx.GetStub().CreateCompositeKey(index.objectType, append(attributes, id))
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+
+	return keys, nil
+}
+
+// fieldValue returns a string field of a document, following a dotted path into
+// nested objects ("" when the field is missing or not a string)
+func fieldValue(fields map[string]interface{}, path string) string {
+	names := strings.Split(path, ".")
+	for _, name := range names[:len(names)-1] {
+		nested, ok := fields[name].(map[string]interface{})
+		if !ok {
+			return ""
+		}
+		fields = nested
+	}
+	value, _ := fields[names[len(names)-1]].(string)
+	return value
+}
+
+// containsEmpty reports whether any of the values is empty
+func containsEmpty(values []string) bool {
+	for _, value := range values {
+		if value == "" {
+			return true
+		}
+	}
+	return false
+}
+
+// updateIndexes moves an entity's index keys from its old document to its new one
+// Current keys are always rewritten so an entity missing from an index is repaired on its next write
+func updateIndexes(ctx RoutingContextInterface, objectType string, id string, oldDoc []byte, newDoc []byte) error {
+	oldKeys, err := indexKeys(ctx, objectType, id, oldDoc)
+	if err != nil {
+		return err
+	}
+	newKeys, err := indexKeys(ctx, objectType, id, newDoc)
+	if err != nil {
+		return err
+	}
+
+	current := make(map[string]bool, len(newKeys))
+	for _, key := range newKeys {
+		current[key] = true
+		if err := ctx.WriteState(key, indexMarker); err != nil {
+			return fmt.Errorf("failed to write index: %v", err)
+		}
+	}
+	for _, key := range oldKeys {
+		if current[key] {
+			continue
+		}
+		if err := ctx.DeleteState(key); err != nil {
+			return fmt.Errorf("failed to delete index: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// queryIndex reads the documents listed under an index for the leading attribute values
+func queryIndex[T any](
+	ctx RoutingContextInterface,
+	indexType string,
+	objectType string,
+	attributes ...string,
+) ([]*T, error) {
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(indexType, attributes)
+	if err != nil {
+		return nil, err
+	}
+	return resolveIndex[T](ctx, objectType, resultsIterator)
+}
+
+// queryIndexPage reads one page of the documents listed under an index
+func queryIndexPage[T any](
+	ctx RoutingContextInterface,
+	indexType string,
+	objectType string,
+	attributes []string,
+	pageSize int32,
+	bookmark string,
+) (*resultPage[T], error) {
+	if err := checkPageSize(pageSize); err != nil {
+		return nil, err
+	}
+
+	resultsIterator, metadata, err := ctx.GetStub().GetStateByPartialCompositeKeyWithPagination(indexType, attributes, pageSize, bookmark)
+	if err != nil {
+		return nil, err
+	}
+	records, err := resolveIndex[T](ctx, objectType, resultsIterator)
+	if err != nil {
+		return nil, err
+	}
+
+	return &resultPage[T]{
+		records:      records,
+		bookmark:     metadata.GetBookmark(),
+		fetchedCount: metadata.GetFetchedRecordsCount(),
+	}, nil
+}
+
+// resolveIndex loads the document behind each index key and closes the iterator
+// Keys whose document no longer matches them (updated earlier in this transaction) are skipped
+func resolveIndex[T any](
+	ctx RoutingContextInterface,
+	objectType string,
+	resultsIterator shim.StateQueryIteratorInterface,
+) ([]*T, error) {
+	defer resultsIterator.Close()
+
+	results := []*T{}
+	for resultsIterator.HasNext() {
+		queryResult, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		_, attributes, err := ctx.GetStub().SplitCompositeKey(queryResult.Key)
+		if err != nil {
+			return nil, err
+		}
+		id := attributes[len(attributes)-1]
+		doc, err := getEntityState(ctx, objectType, id)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read state: %v", err)
+		}
+		if !indexMatches(ctx, objectType, id, doc, queryResult.Key) {
+			continue
+		}
+
+		var result T
+		err = json.Unmarshal(doc, &result)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, &result)
+	}
+
+	return results, nil
+}
+
+// indexMatches reports whether a document still produces the given index key
+func indexMatches(ctx RoutingContextInterface, objectType string, id string, doc []byte, key string) bool {
+	keys, err := indexKeys(ctx, objectType, id, doc)
+	if err != nil {
+		return false
+	}
+	for _, k := range keys {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
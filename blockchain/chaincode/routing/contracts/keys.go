@@ -0,0 +1,69 @@
+package contracts
+
+import (
+	"fmt"
+
+	"github.com/emergency-routing/chaincode/routing/models"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Composite key namespaces - each entity type lives in its own key space so a
+// mission and a vehicle with the same ID can never overwrite each other
+const (
+	vehicleObjectType   = "vehicle~id"
+	missionObjectType   = "mission~id"
+	segmentObjectType   = "segment~id"
+	nodeObjectType      = "node~id"
+	conflictObjectType  = "conflict~id"
+	orgObjectType       = "org~msp"
+	auditObjectType     = "audit~type~entity~seq"
+	auditHeadObjectType = "audithead~type~entity"
+)
+
+// objectTypeByDocType maps a document's docType to its key namespace
+var objectTypeByDocType = map[string]string{
+	models.DocTypeVehicle:  vehicleObjectType,
+	models.DocTypeMission:  missionObjectType,
+	models.DocTypeSegment:  segmentObjectType,
+	models.DocTypeConflict: conflictObjectType,
+}
+
+// entityKey builds the composite key for an entity ID in the given namespace
+func entityKey(ctx contractapi.TransactionContextInterface, objectType string, id string) (string, error) {
+	return ctx.GetStub().CreateCompositeKey(objectType, []string{id})
+}
+
+// getEntityState reads the raw document stored for an entity ID (nil if absent)
+func getEntityState(ctx RoutingContextInterface, objectType string, id string) ([]byte, error) {
+	key, err := entityKey(ctx, objectType, id)
+	if err != nil {
+		return nil, err
+	}
+	return ctx.ReadState(key)
+}
+
+// putEntityState writes the raw document for an entity ID and keeps its secondary indexes in step
+func putEntityState(ctx RoutingContextInterface, objectType string, id string, value []byte) error {
+	key, err := entityKey(ctx, objectType, id)
+	if err != nil {
+		return err
+	}
+	if len(secondaryIndexes[objectType]) > 0 {
+		oldValue, err := ctx.ReadState(key)
+		if err != nil {
+			return err
+		}
+		if err := updateIndexes(ctx, objectType, id, oldValue, value); err != nil {
+			return err
+		}
+	}
+	return ctx.WriteState(key, value)
+}
+
+// checkDocType rejects a document whose docType is not the one expected
+func checkDocType(id string, docType string, expected string) error {
+	if docType != expected {
+		return fmt.Errorf("document %s has docType %q, expected %q", id, docType, expected)
+	}
+	return nil
+}
@@ -0,0 +1,158 @@
+package contracts
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/emergency-routing/chaincode/routing/models"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// MigrationContract holds one-time state migrations between chaincode versions
+type MigrationContract struct {
+	contractapi.Contract
+}
+
+// NewMigrationContract returns a MigrationContract using the routing context
+func NewMigrationContract() *MigrationContract {
+	return &MigrationContract{Contract: newRoutingContract("MigrationContract")}
+}
+
+// MigrateToCompositeKeys moves documents stored under legacy flat keys
+// (PutState(vehicleID, ...)) into their composite key namespaces
+// Returns the number of documents migrated. Running it again is a no-op.
+// If a document already exists under the composite key it was written by the
+// new chaincode and is newer, so the legacy copy is simply dropped
+func (c *MigrationContract) MigrateToCompositeKeys(
+	ctx RoutingContextInterface,
+) (int, error) {
+	// An empty range only covers simple keys, i.e. the legacy flat documents
+	resultsIterator, err := ctx.GetStub().GetStateByRange("", "")
+	if err != nil {
+		return 0, fmt.Errorf("failed to read legacy keys: %v", err)
+	}
+	defer resultsIterator.Close()
+
+	migrated := 0
+	for resultsIterator.HasNext() {
+		queryResult, err := resultsIterator.Next()
+		if err != nil {
+			return 0, err
+		}
+
+		var doc struct {
+			DocType string `json:"docType"`
+		}
+		if err := json.Unmarshal(queryResult.Value, &doc); err != nil {
+			// Not one of our documents - leave it alone
+			continue
+		}
+		objectType, ok := objectTypeByDocType[doc.DocType]
+		if !ok {
+			continue
+		}
+
+		existingJSON, err := getEntityState(ctx, objectType, queryResult.Key)
+		if err != nil {
+			return 0, fmt.Errorf("failed to read state: %v", err)
+		}
+		if existingJSON == nil {
+			err = putEntityState(ctx, objectType, queryResult.Key, queryResult.Value)
+			if err != nil {
+				return 0, fmt.Errorf("failed to write state: %v", err)
+			}
+		}
+
+		err = ctx.GetStub().DelState(queryResult.Key)
+		if err != nil {
+			return 0, fmt.Errorf("failed to delete legacy key %s: %v", queryResult.Key, err)
+		}
+		migrated++
+	}
+
+	return migrated, nil
+}
+
+// BuildSecondaryIndexes writes the secondary index keys of every vehicle, mission,
+// segment, node and conflict, and lists every audit entry under its actor. Documents
+// written before the indexes existed are missing from them until this runs.
+// Returns the number of documents indexed; running it again only rewrites the same keys
+func (c *MigrationContract) BuildSecondaryIndexes(
+	ctx RoutingContextInterface,
+) (int, error) {
+	indexed := 0
+	for _, objectType := range []string{vehicleObjectType, missionObjectType, segmentObjectType, nodeObjectType, conflictObjectType} {
+		count, err := c.indexNamespace(ctx, objectType)
+		if err != nil {
+			return 0, err
+		}
+		indexed += count
+	}
+
+	count, err := c.indexAuditTrail(ctx)
+	if err != nil {
+		return 0, err
+	}
+	indexed += count
+
+	return indexed, nil
+}
+
+// indexAuditTrail lists one stored copy of every audit entry under its actor
+func (c *MigrationContract) indexAuditTrail(
+	ctx RoutingContextInterface,
+) (int, error) {
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(auditObjectType, []string{})
+	if err != nil {
+		return 0, fmt.Errorf("failed to read %s: %v", auditObjectType, err)
+	}
+	entries, err := decodeResults[models.AuditEvent](resultsIterator)
+	if err != nil {
+		return 0, err
+	}
+
+	seen := map[string]bool{}
+	for _, entry := range entries {
+		if seen[entry.EventID] {
+			continue
+		}
+		seen[entry.EventID] = true
+		if err := indexAuditEntry(ctx, entry); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(seen), nil
+}
+
+// indexNamespace writes the secondary index keys of every document in one namespace
+func (c *MigrationContract) indexNamespace(
+	ctx RoutingContextInterface,
+	objectType string,
+) (int, error) {
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(objectType, []string{})
+	if err != nil {
+		return 0, fmt.Errorf("failed to read %s: %v", objectType, err)
+	}
+	defer resultsIterator.Close()
+
+	indexed := 0
+	for resultsIterator.HasNext() {
+		queryResult, err := resultsIterator.Next()
+		if err != nil {
+			return 0, err
+		}
+
+		_, attributes, err := ctx.GetStub().SplitCompositeKey(queryResult.Key)
+		if err != nil {
+			return 0, err
+		}
+		err = updateIndexes(ctx, objectType, attributes[0], nil, queryResult.Value)
+		if err != nil {
+			return 0, err
+		}
+		indexed++
+	}
+
+	return indexed, nil
+}
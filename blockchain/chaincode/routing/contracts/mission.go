@@ -3,7 +3,7 @@ package contracts
 import (
 	"encoding/json"
 	"fmt"
-	"time"
+	"strings"
 
 	"github.com/emergency-routing/chaincode/routing/models"
 	"github.com/hyperledger/fabric-contract-api-go/contractapi"
@@ -15,12 +15,31 @@ type MissionContract struct {
 }
 
 // CreateMission creates a new emergency mission (pending state)
+// The mission's priority comes from the vehicle type and incident severity (see priority.go),
+// not from the vehicle's own priority level
 func (c *MissionContract) CreateMission(
-	ctx contractapi.TransactionContextInterface,
+	ctx RoutingContextInterface,
 	missionID string,
 	vehicleID string,
 	originNode string,
 	destNode string,
+	severity string, // "critical", "high", "medium", "low"
+	category string, // Free-form incident category (e.g., "cardiac_arrest")
+) error {
+	return c.createMission(ctx, missionID, vehicleID, originNode, destNode, severity, category, nil)
+}
+
+// createMission validates and stores a new pending mission
+// waypoints is nil for a single-leg mission
+func (c *MissionContract) createMission(
+	ctx RoutingContextInterface,
+	missionID string,
+	vehicleID string,
+	originNode string,
+	destNode string,
+	severity string,
+	category string,
+	waypoints []models.Waypoint,
 ) error {
 	// Validate inputs
 	if missionID == "" {
@@ -34,7 +53,7 @@ func (c *MissionContract) CreateMission(
 	}
 
 	// Check if mission already exists
-	existingJSON, err := ctx.GetStub().GetState(missionID)
+	existingJSON, err := getEntityState(ctx, missionObjectType, missionID)
 	if err != nil {
 		return fmt.Errorf("failed to read state: %v", err)
 	}
@@ -42,37 +61,19 @@ func (c *MissionContract) CreateMission(
 		return fmt.Errorf("mission %s already exists", missionID)
 	}
 
-	// Get caller identity
-	clientIdentity := ctx.GetClientIdentity()
-	mspID, err := clientIdentity.GetMSPID()
+	// Get organization of the caller from the registry
+	callerOrg, err := resolveCallerOrg(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to get MSP ID: %v", err)
-	}
-
-	// Get organization type from MSP
-	orgType := ""
-	switch mspID {
-	case "MedicalMSP":
-		orgType = "medical"
-	case "PoliceMSP":
-		orgType = "police"
-	default:
-		return fmt.Errorf("unknown organization: %s", mspID)
+		return err
 	}
+	mspID := callerOrg.MSPID
+	orgType := callerOrg.OrgType
 
 	// Verify vehicle exists and belongs to the same org
-	vehicleJSON, err := ctx.GetStub().GetState(vehicleID)
-	if err != nil {
-		return fmt.Errorf("failed to read vehicle state: %v", err)
-	}
-	if vehicleJSON == nil {
-		return fmt.Errorf("vehicle %s does not exist", vehicleID)
-	}
-
-	var vehicle models.Vehicle
-	err = json.Unmarshal(vehicleJSON, &vehicle)
+	vehicleContract := &VehicleContract{}
+	vehicle, err := vehicleContract.GetVehicle(ctx, vehicleID)
 	if err != nil {
-		return fmt.Errorf("failed to unmarshal vehicle: %v", err)
+		return err
 	}
 
 	// Check vehicle org matches caller org
@@ -85,19 +86,34 @@ func (c *MissionContract) CreateMission(
 		return fmt.Errorf("vehicle %s is already on a mission", vehicleID)
 	}
 
+	priorityLevel, err := effectivePriority(callerOrg, vehicle.VehicleType, severity)
+	if err != nil {
+		return err
+	}
+
+	now, err := txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+
 	// Create mission object
 	mission := models.Mission{
-		DocType:       "mission",
+		DocType:       models.DocTypeMission,
 		MissionID:     missionID,
 		VehicleID:     vehicleID,
 		OrgType:       orgType,
-		PriorityLevel: vehicle.PriorityLevel,
+		PriorityLevel: priorityLevel,
 		OriginNode:    originNode,
 		DestNode:      destNode,
 		Path:          []string{},
 		Status:        models.MissionPending,
-		CreatedAt:     time.Now().Unix(),
+		CreatedAt:     now,
 		CreatedBy:     mspID,
+
+		PreemptedSegments: []models.PreemptedSegment{},
+		Severity:          severity,
+		Category:          category,
+		Waypoints:         waypoints,
 	}
 
 	// Serialize and store
@@ -106,23 +122,35 @@ func (c *MissionContract) CreateMission(
 		return fmt.Errorf("failed to marshal mission: %v", err)
 	}
 
-	err = ctx.GetStub().PutState(missionID, missionJSON)
+	err = putEntityState(ctx, missionObjectType, missionID, missionJSON)
 	if err != nil {
 		return fmt.Errorf("failed to write state: %v", err)
 	}
 
-	// Emit event
-	ctx.GetStub().SetEvent(models.EventMissionCreated, missionJSON)
+	// Raise event
+	ctx.RaiseEvent(models.EventMissionCreated, missionJSON)
+	details := map[string]interface{}{
+		"originNode":    originNode,
+		"destNode":      destNode,
+		"severity":      severity,
+		"category":      category,
+		"priorityLevel": priorityLevel,
+	}
+	if len(waypoints) > 0 {
+		details["waypoints"] = waypointNodes(waypoints)
+	}
+	auditMission(ctx, models.EventMissionCreated, &mission, details)
 
 	return nil
 }
 
 // ActivateMission activates a pending mission with a calculated path
-// This reserves all segments in the path
+// This reserves all segments in the path, each for its ETA window if one is given
+// A multi-stop mission takes one path per leg and reserves every leg at once
 func (c *MissionContract) ActivateMission(
-	ctx contractapi.TransactionContextInterface,
+	ctx RoutingContextInterface,
 	missionID string,
-	pathJSON string, // JSON array of segment IDs
+	pathJSON string, // JSON array of segment IDs or of {segmentId, enterAt, exitAt}; an array of those per leg for multi-stop
 ) error {
 	// Get mission
 	mission, err := c.GetMission(ctx, missionID)
@@ -136,59 +164,95 @@ func (c *MissionContract) ActivateMission(
 	}
 
 	// Verify caller org matches mission org
-	clientIdentity := ctx.GetClientIdentity()
-	mspID, _ := clientIdentity.GetMSPID()
-	callerOrg := ""
-	switch mspID {
-	case "MedicalMSP":
-		callerOrg = "medical"
-	case "PoliceMSP":
-		callerOrg = "police"
-	}
-	if callerOrg != mission.OrgType {
+	callerOrg, err := resolveCallerOrg(ctx)
+	if err != nil {
+		return err
+	}
+	if callerOrg.OrgType != mission.OrgType {
 		return fmt.Errorf("cannot activate mission from different organization")
 	}
 
 	// Parse path
-	var path []string
-	err = json.Unmarshal([]byte(pathJSON), &path)
+	steps, err := parseMissionPath(mission, pathJSON, []string{mission.OriginNode})
 	if err != nil {
-		return fmt.Errorf("failed to parse path JSON: %v", err)
+		return err
 	}
 
-	if len(path) == 0 {
+	if len(steps) == 0 {
 		return fmt.Errorf("path cannot be empty")
 	}
+	if mission.Convoy != nil && mission.Convoy.Status == models.ConvoyAccepted {
+		lead, err := c.GetMission(ctx, mission.Convoy.LeadMissionID)
+		if err != nil {
+			return err
+		}
+		if lead.Status == models.MissionPending {
+			return fmt.Errorf("mission %s escorts %s and is activated with it", missionID, lead.MissionID)
+		}
+	}
+
+	return c.activateMission(ctx, mission, steps)
+}
+
+// activateMission reserves a parsed path for a pending mission and puts it underway
+// The caller has checked it may act for the mission. Accepted convoy members still
+// pending are activated along the same path in the same transaction
+func (c *MissionContract) activateMission(
+	ctx RoutingContextInterface,
+	mission *models.Mission,
+	steps []models.PathSegment,
+) error {
+	missionID := mission.MissionID
 
 	// Reserve all segments in the path
 	segmentContract := &SegmentContract{}
 	conflicts := []*models.Conflict{}
+	path := []string{}
 
-	for _, segmentID := range path {
-		conflict, err := segmentContract.ReserveSegment(
+	for _, step := range steps {
+		conflict, err := segmentContract.reserveSegment(
 			ctx,
-			segmentID,
+			step.SegmentID,
 			mission.VehicleID,
 			missionID,
+			mission.OrgType,
 			mission.PriorityLevel,
+			step.EnterAt,
+			step.ExitAt,
+			step.FromNode,
+			step.ToNode,
+			false,
 		)
 		if err != nil {
-			// Rollback: release already reserved segments
-			for _, reservedSeg := range mission.Path {
-				segmentContract.ReleaseSegment(ctx, reservedSeg, mission.VehicleID)
-			}
-			return fmt.Errorf("failed to reserve segment %s: %v", segmentID, err)
+			// The failed transaction discards every reservation made so far
+			return fmt.Errorf("failed to reserve segment %s: %v", step.SegmentID, err)
 		}
 		if conflict != nil {
 			conflicts = append(conflicts, conflict)
 		}
-		mission.Path = append(mission.Path, segmentID)
+		path = append(path, step.SegmentID)
+	}
+
+	// Reserve the intersections along the path
+	nodeConflicts, err := c.reserveNodes(ctx, mission, mission.VehicleID, mission.PriorityLevel, steps)
+	if err != nil {
+		return err
 	}
+	conflicts = append(conflicts, nodeConflicts...)
 
 	// Update mission status
 	mission.Status = models.MissionActive
-	mission.ActivatedAt = time.Now().Unix()
+	mission.ActivatedAt, err = txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
 	mission.Path = path
+	mission.Steps = steps
+	mission.CurrentIndex = -1
+	mission.LeaseExpiresAt = mission.ActivatedAt + reservationLeaseSeconds
+	if len(mission.Waypoints) > 0 {
+		mission.Waypoints[0].Status = models.LegActive
+	}
 
 	// Store updated mission
 	missionJSON, err := json.Marshal(mission)
@@ -196,33 +260,51 @@ func (c *MissionContract) ActivateMission(
 		return fmt.Errorf("failed to marshal mission: %v", err)
 	}
 
-	err = ctx.GetStub().PutState(missionID, missionJSON)
+	err = putEntityState(ctx, missionObjectType, missionID, missionJSON)
 	if err != nil {
 		return fmt.Errorf("failed to write state: %v", err)
 	}
 
 	// Update vehicle status
-	vehicleContract := &VehicleContract{}
-	err = vehicleContract.UpdateVehicleStatus(ctx, mission.VehicleID, models.StatusOnMission)
+	err = setMissionVehicleStatus(ctx, mission.VehicleID, models.StatusOnMission)
 	if err != nil {
 		// Non-critical - log but don't fail
 		fmt.Printf("Warning: failed to update vehicle status: %v\n", err)
 	}
 
-	// Emit event
+	// Raise event
 	activationEvent := map[string]interface{}{
 		"mission":   mission,
 		"conflicts": conflicts,
 	}
 	eventJSON, _ := json.Marshal(activationEvent)
-	ctx.GetStub().SetEvent(models.EventMissionActivated, eventJSON)
+	ctx.RaiseEvent(models.EventMissionActivated, eventJSON)
+	auditMission(ctx, models.EventMissionActivated, mission, map[string]interface{}{
+		"path":      mission.Path,
+		"nodes":     mission.Nodes,
+		"conflicts": len(conflicts),
+	})
+
+	// Escorts waiting for this mission follow its path
+	for _, memberID := range mission.ConvoyMembers {
+		member, err := c.GetMission(ctx, memberID)
+		if err != nil {
+			return err
+		}
+		if member.Status != models.MissionPending {
+			continue
+		}
+		if err := c.activateMission(ctx, member, steps); err != nil {
+			return fmt.Errorf("failed to activate convoy member %s: %v", memberID, err)
+		}
+	}
 
 	return nil
 }
 
 // CompleteMission marks a mission as completed and releases all segments
 func (c *MissionContract) CompleteMission(
-	ctx contractapi.TransactionContextInterface,
+	ctx RoutingContextInterface,
 	missionID string,
 ) error {
 	// Get mission
@@ -231,24 +313,22 @@ func (c *MissionContract) CompleteMission(
 		return err
 	}
 
-	// Verify mission is active
-	if mission.Status != models.MissionActive {
+	// Verify mission is underway
+	if !isMissionUnderway(mission.Status) {
 		return fmt.Errorf("mission %s is not active (current: %s)", missionID, mission.Status)
 	}
 
 	// Verify caller org matches mission org
-	clientIdentity := ctx.GetClientIdentity()
-	mspID, _ := clientIdentity.GetMSPID()
-	callerOrg := ""
-	switch mspID {
-	case "MedicalMSP":
-		callerOrg = "medical"
-	case "PoliceMSP":
-		callerOrg = "police"
-	}
-	if callerOrg != mission.OrgType {
+	callerOrg, err := resolveCallerOrg(ctx)
+	if err != nil {
+		return err
+	}
+	if callerOrg.OrgType != mission.OrgType {
 		return fmt.Errorf("cannot complete mission from different organization")
 	}
+	if err := requireVehicleAccess(ctx, mission.VehicleID); err != nil {
+		return err
+	}
 
 	// Release all segments in the path
 	segmentContract := &SegmentContract{}
@@ -259,10 +339,16 @@ func (c *MissionContract) CompleteMission(
 			fmt.Printf("Warning: failed to release segment %s: %v\n", segmentID, err)
 		}
 	}
+	if err := releaseNodes(ctx, mission); err != nil {
+		return err
+	}
 
 	// Update mission status
 	mission.Status = models.MissionCompleted
-	mission.CompletedAt = time.Now().Unix()
+	mission.CompletedAt, err = txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
 
 	// Store updated mission
 	missionJSON, err := json.Marshal(mission)
@@ -270,7 +356,7 @@ func (c *MissionContract) CompleteMission(
 		return fmt.Errorf("failed to marshal mission: %v", err)
 	}
 
-	err = ctx.GetStub().PutState(missionID, missionJSON)
+	err = putEntityState(ctx, missionObjectType, missionID, missionJSON)
 	if err != nil {
 		return fmt.Errorf("failed to write state: %v", err)
 	}
@@ -283,15 +369,16 @@ func (c *MissionContract) CompleteMission(
 		fmt.Printf("Warning: failed to update vehicle status: %v\n", err)
 	}
 
-	// Emit event
-	ctx.GetStub().SetEvent(models.EventMissionCompleted, missionJSON)
+	// Raise event
+	ctx.RaiseEvent(models.EventMissionCompleted, missionJSON)
+	auditMission(ctx, models.EventMissionCompleted, mission, nil)
 
-	return nil
+	return c.endConvoy(ctx, mission)
 }
 
 // AbortMission aborts an active or pending mission
 func (c *MissionContract) AbortMission(
-	ctx contractapi.TransactionContextInterface,
+	ctx RoutingContextInterface,
 	missionID string,
 	reason string,
 ) error {
@@ -302,26 +389,21 @@ func (c *MissionContract) AbortMission(
 	}
 
 	// Verify mission can be aborted
-	if mission.Status != models.MissionPending && mission.Status != models.MissionActive {
+	if mission.Status != models.MissionPending && !isMissionUnderway(mission.Status) {
 		return fmt.Errorf("mission %s cannot be aborted (current: %s)", missionID, mission.Status)
 	}
 
 	// Verify caller org matches mission org
-	clientIdentity := ctx.GetClientIdentity()
-	mspID, _ := clientIdentity.GetMSPID()
-	callerOrg := ""
-	switch mspID {
-	case "MedicalMSP":
-		callerOrg = "medical"
-	case "PoliceMSP":
-		callerOrg = "police"
-	}
-	if callerOrg != mission.OrgType {
+	callerOrg, err := resolveCallerOrg(ctx)
+	if err != nil {
+		return err
+	}
+	if callerOrg.OrgType != mission.OrgType {
 		return fmt.Errorf("cannot abort mission from different organization")
 	}
 
-	// If mission was active, release all segments
-	if mission.Status == models.MissionActive {
+	// If mission was underway, release all segments
+	if isMissionUnderway(mission.Status) {
 		segmentContract := &SegmentContract{}
 		for _, segmentID := range mission.Path {
 			err := segmentContract.ReleaseSegment(ctx, segmentID, mission.VehicleID)
@@ -329,6 +411,9 @@ func (c *MissionContract) AbortMission(
 				fmt.Printf("Warning: failed to release segment %s: %v\n", segmentID, err)
 			}
 		}
+		if err := releaseNodes(ctx, mission); err != nil {
+			return err
+		}
 
 		// Update vehicle status back to active
 		vehicleContract := &VehicleContract{}
@@ -340,7 +425,10 @@ func (c *MissionContract) AbortMission(
 
 	// Update mission status
 	mission.Status = models.MissionAborted
-	mission.CompletedAt = time.Now().Unix()
+	mission.CompletedAt, err = txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
 
 	// Store updated mission
 	missionJSON, err := json.Marshal(mission)
@@ -348,28 +436,29 @@ func (c *MissionContract) AbortMission(
 		return fmt.Errorf("failed to marshal mission: %v", err)
 	}
 
-	err = ctx.GetStub().PutState(missionID, missionJSON)
+	err = putEntityState(ctx, missionObjectType, missionID, missionJSON)
 	if err != nil {
 		return fmt.Errorf("failed to write state: %v", err)
 	}
 
-	// Emit event with reason
+	// Raise event with reason
 	abortEvent := map[string]interface{}{
 		"mission": mission,
 		"reason":  reason,
 	}
 	eventJSON, _ := json.Marshal(abortEvent)
-	ctx.GetStub().SetEvent(models.EventMissionAborted, eventJSON)
+	ctx.RaiseEvent(models.EventMissionAborted, eventJSON)
+	auditMission(ctx, models.EventMissionAborted, mission, map[string]interface{}{"reason": reason})
 
-	return nil
+	return c.endConvoy(ctx, mission)
 }
 
 // GetMission retrieves a mission by ID
 func (c *MissionContract) GetMission(
-	ctx contractapi.TransactionContextInterface,
+	ctx RoutingContextInterface,
 	missionID string,
 ) (*models.Mission, error) {
-	missionJSON, err := ctx.GetStub().GetState(missionID)
+	missionJSON, err := getEntityState(ctx, missionObjectType, missionID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read state: %v", err)
 	}
@@ -382,166 +471,147 @@ func (c *MissionContract) GetMission(
 	if err != nil {
 		return nil, fmt.Errorf("failed to unmarshal mission: %v", err)
 	}
+	if err := checkDocType(missionID, mission.DocType, models.DocTypeMission); err != nil {
+		return nil, err
+	}
 
 	return &mission, nil
 }
 
 // GetAllMissions retrieves all missions
 func (c *MissionContract) GetAllMissions(
-	ctx contractapi.TransactionContextInterface,
+	ctx RoutingContextInterface,
 ) ([]*models.Mission, error) {
-	queryString := `{"selector":{"docType":"mission"}}`
-
-	resultsIterator, err := ctx.GetStub().GetQueryResult(queryString)
+	missions, err := getAllEntities[models.Mission](ctx, missionObjectType)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query missions: %v", err)
 	}
-	defer resultsIterator.Close()
 
-	var missions []*models.Mission
-	for resultsIterator.HasNext() {
-		queryResult, err := resultsIterator.Next()
-		if err != nil {
-			return nil, err
-		}
+	return missions, nil
+}
 
-		var mission models.Mission
-		err = json.Unmarshal(queryResult.Value, &mission)
-		if err != nil {
-			return nil, err
-		}
-		missions = append(missions, &mission)
+// GetAllMissionsWithPagination retrieves one page of missions in ID order
+// bookmark is empty for the first page, then the bookmark of the previous page
+func (c *MissionContract) GetAllMissionsWithPagination(
+	ctx RoutingContextInterface,
+	pageSize int32,
+	bookmark string,
+) (*models.MissionPage, error) {
+	page, err := rangePage[models.Mission](ctx, missionObjectType, pageSize, bookmark)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query missions: %v", err)
 	}
 
-	return missions, nil
+	return &models.MissionPage{Records: page.records, Bookmark: page.bookmark, FetchedCount: page.fetchedCount}, nil
 }
 
 // GetActiveMissions retrieves all active missions
 func (c *MissionContract) GetActiveMissions(
-	ctx contractapi.TransactionContextInterface,
+	ctx RoutingContextInterface,
 ) ([]*models.Mission, error) {
-	queryString := fmt.Sprintf(`{"selector":{"docType":"mission","status":"%s"}}`, models.MissionActive)
-
-	resultsIterator, err := ctx.GetStub().GetQueryResult(queryString)
+	missions, err := queryIndex[models.Mission](ctx, missionStatusIndex, missionObjectType, models.MissionActive)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query missions: %v", err)
 	}
-	defer resultsIterator.Close()
-
-	var missions []*models.Mission
-	for resultsIterator.HasNext() {
-		queryResult, err := resultsIterator.Next()
-		if err != nil {
-			return nil, err
-		}
-
-		var mission models.Mission
-		err = json.Unmarshal(queryResult.Value, &mission)
-		if err != nil {
-			return nil, err
-		}
-		missions = append(missions, &mission)
-	}
 
 	return missions, nil
 }
 
 // GetMissionsByStatus retrieves missions by status
 func (c *MissionContract) GetMissionsByStatus(
-	ctx contractapi.TransactionContextInterface,
+	ctx RoutingContextInterface,
 	status string,
 ) ([]*models.Mission, error) {
-	queryString := fmt.Sprintf(`{"selector":{"docType":"mission","status":"%s"}}`, status)
+	if err := checkMissionStatus(status); err != nil {
+		return nil, err
+	}
 
-	resultsIterator, err := ctx.GetStub().GetQueryResult(queryString)
+	missions, err := queryIndex[models.Mission](ctx, missionStatusIndex, missionObjectType, status)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query missions: %v", err)
 	}
-	defer resultsIterator.Close()
 
-	var missions []*models.Mission
-	for resultsIterator.HasNext() {
-		queryResult, err := resultsIterator.Next()
-		if err != nil {
-			return nil, err
-		}
+	return missions, nil
+}
 
-		var mission models.Mission
-		err = json.Unmarshal(queryResult.Value, &mission)
-		if err != nil {
-			return nil, err
-		}
-		missions = append(missions, &mission)
+// GetMissionsByStatusWithPagination retrieves one page of missions with a status
+func (c *MissionContract) GetMissionsByStatusWithPagination(
+	ctx RoutingContextInterface,
+	status string,
+	pageSize int32,
+	bookmark string,
+) (*models.MissionPage, error) {
+	if err := checkMissionStatus(status); err != nil {
+		return nil, err
 	}
 
-	return missions, nil
+	page, err := queryIndexPage[models.Mission](ctx, missionStatusIndex, missionObjectType, []string{status}, pageSize, bookmark)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query missions: %v", err)
+	}
+
+	return &models.MissionPage{Records: page.records, Bookmark: page.bookmark, FetchedCount: page.fetchedCount}, nil
 }
 
 // GetMissionsByOrg retrieves missions for a specific organization
 func (c *MissionContract) GetMissionsByOrg(
-	ctx contractapi.TransactionContextInterface,
+	ctx RoutingContextInterface,
 	orgType string,
 ) ([]*models.Mission, error) {
-	queryString := fmt.Sprintf(`{"selector":{"docType":"mission","orgType":"%s"}}`, orgType)
+	if err := checkOrgType(ctx, orgType); err != nil {
+		return nil, err
+	}
 
-	resultsIterator, err := ctx.GetStub().GetQueryResult(queryString)
+	missions, err := queryIndex[models.Mission](ctx, missionOrgIndex, missionObjectType, orgType)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query missions: %v", err)
 	}
-	defer resultsIterator.Close()
-
-	var missions []*models.Mission
-	for resultsIterator.HasNext() {
-		queryResult, err := resultsIterator.Next()
-		if err != nil {
-			return nil, err
-		}
-
-		var mission models.Mission
-		err = json.Unmarshal(queryResult.Value, &mission)
-		if err != nil {
-			return nil, err
-		}
-		missions = append(missions, &mission)
-	}
 
 	return missions, nil
 }
 
-// GetVehicleActiveMission retrieves the active mission for a vehicle (if any)
-func (c *MissionContract) GetVehicleActiveMission(
-	ctx contractapi.TransactionContextInterface,
-	vehicleID string,
-) (*models.Mission, error) {
-	queryString := fmt.Sprintf(`{"selector":{"docType":"mission","vehicleId":"%s","status":"%s"}}`,
-		vehicleID, models.MissionActive)
+// GetMissionsByOrgWithPagination retrieves one page of an organization's missions
+func (c *MissionContract) GetMissionsByOrgWithPagination(
+	ctx RoutingContextInterface,
+	orgType string,
+	pageSize int32,
+	bookmark string,
+) (*models.MissionPage, error) {
+	if err := checkOrgType(ctx, orgType); err != nil {
+		return nil, err
+	}
 
-	resultsIterator, err := ctx.GetStub().GetQueryResult(queryString)
+	page, err := queryIndexPage[models.Mission](ctx, missionOrgIndex, missionObjectType, []string{orgType}, pageSize, bookmark)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query missions: %v", err)
 	}
-	defer resultsIterator.Close()
 
-	if resultsIterator.HasNext() {
-		queryResult, err := resultsIterator.Next()
-		if err != nil {
-			return nil, err
-		}
+	return &models.MissionPage{Records: page.records, Bookmark: page.bookmark, FetchedCount: page.fetchedCount}, nil
+}
 
-		var mission models.Mission
-		err = json.Unmarshal(queryResult.Value, &mission)
+// GetVehicleActiveMission retrieves the mission a vehicle is on (if any): active,
+// waiting for a reroute or stale after its lease ran out
+func (c *MissionContract) GetVehicleActiveMission(
+	ctx RoutingContextInterface,
+	vehicleID string,
+) (*models.Mission, error) {
+	for _, status := range []string{models.MissionActive, models.MissionNeedsReroute, models.MissionStale} {
+		missions, err := queryIndex[models.Mission](ctx, missionVehicleIndex, missionObjectType, vehicleID, status)
 		if err != nil {
-			return nil, err
+			return nil, fmt.Errorf("failed to query missions: %v", err)
+		}
+		if len(missions) > 0 {
+			return missions[0], nil
 		}
-		return &mission, nil
 	}
 
 	return nil, nil // No active mission found
 }
 
 // UpdateMissionPath updates the path for an active mission (for re-routing)
+// A convoy lead's escorts are unlinked, as they no longer follow its path
 func (c *MissionContract) UpdateMissionPath(
-	ctx contractapi.TransactionContextInterface,
+	ctx RoutingContextInterface,
 	missionID string,
 	newPathJSON string,
 ) error {
@@ -551,30 +621,28 @@ func (c *MissionContract) UpdateMissionPath(
 		return err
 	}
 
-	// Verify mission is active
-	if mission.Status != models.MissionActive {
+	// Verify mission is underway (a mission that lost segments is rerouted here)
+	if !isMissionUnderway(mission.Status) {
 		return fmt.Errorf("mission %s is not active (current: %s)", missionID, mission.Status)
 	}
 
 	// Verify caller org matches mission org
-	clientIdentity := ctx.GetClientIdentity()
-	mspID, _ := clientIdentity.GetMSPID()
-	callerOrg := ""
-	switch mspID {
-	case "MedicalMSP":
-		callerOrg = "medical"
-	case "PoliceMSP":
-		callerOrg = "police"
-	}
-	if callerOrg != mission.OrgType {
+	callerOrg, err := resolveCallerOrg(ctx)
+	if err != nil {
+		return err
+	}
+	if callerOrg.OrgType != mission.OrgType {
 		return fmt.Errorf("cannot update mission from different organization")
 	}
 
-	// Parse new path
-	var newPath []string
-	err = json.Unmarshal([]byte(newPathJSON), &newPath)
+	// Parse new path - a multi-stop mission gives one path per leg not yet driven
+	steps, err := parseMissionPath(mission, newPathJSON, rerouteStarts(mission))
 	if err != nil {
-		return fmt.Errorf("failed to parse path JSON: %v", err)
+		return err
+	}
+	newPath := []string{}
+	for _, step := range steps {
+		newPath = append(newPath, step.SegmentID)
 	}
 
 	// Release old segments that are not in new path
@@ -598,18 +666,61 @@ func (c *MissionContract) UpdateMissionPath(
 		}
 	}
 
-	// Reserve new segments
-	for _, seg := range newPath {
-		if !oldPathSet[seg] {
-			_, err := segmentContract.ReserveSegment(ctx, seg, mission.VehicleID, missionID, mission.PriorityLevel)
+	// Reserve new segments, and re-reserve kept ones whose ETA window was given
+	// A stale mission's leases ran out, so it re-reserves its whole path
+	wasStale := mission.Status == models.MissionStale
+	for _, step := range steps {
+		if !oldPathSet[step.SegmentID] || step.EnterAt != 0 || step.ExitAt != 0 || wasStale {
+			_, err := segmentContract.reserveSegment(
+				ctx,
+				step.SegmentID,
+				mission.VehicleID,
+				missionID,
+				mission.OrgType,
+				mission.PriorityLevel,
+				step.EnterAt,
+				step.ExitAt,
+				step.FromNode,
+				step.ToNode,
+				false,
+			)
 			if err != nil {
-				return fmt.Errorf("failed to reserve new segment %s: %v", seg, err)
+				return fmt.Errorf("failed to reserve new segment %s: %v", step.SegmentID, err)
 			}
 		}
 	}
 
-	// Update mission path
+	// Re-reserve the intersections along the new path, releasing the ones left behind
+	if _, err := c.reserveNodes(ctx, mission, mission.VehicleID, mission.PriorityLevel, steps); err != nil {
+		return err
+	}
+
+	// Update mission path - a rerouted mission holds its road again
+	// The vehicle keeps its position if it is still on a segment of the new path
+	currentIndex := -1
+	if mission.CurrentIndex >= 0 && mission.CurrentIndex < len(mission.Path) {
+		for i, seg := range newPath {
+			if seg == mission.Path[mission.CurrentIndex] {
+				currentIndex = i
+				break
+			}
+		}
+	}
 	mission.Path = newPath
+	mission.Steps = steps
+	mission.CurrentIndex = currentIndex
+	mission.Status = models.MissionActive
+	if err := c.unlinkEscorts(ctx, mission, fmt.Sprintf("convoy lead %s rerouted", missionID)); err != nil {
+		return err
+	}
+	if wasStale {
+		now, err := txTimestamp(ctx)
+		if err != nil {
+			return err
+		}
+		mission.StaleReason = ""
+		mission.LeaseExpiresAt = now + reservationLeaseSeconds
+	}
 
 	// Store updated mission
 	missionJSON, err := json.Marshal(mission)
@@ -617,20 +728,798 @@ func (c *MissionContract) UpdateMissionPath(
 		return fmt.Errorf("failed to marshal mission: %v", err)
 	}
 
-	err = ctx.GetStub().PutState(missionID, missionJSON)
+	err = putEntityState(ctx, missionObjectType, missionID, missionJSON)
 	if err != nil {
 		return fmt.Errorf("failed to write state: %v", err)
 	}
 
-	// Emit re-route event
+	// Raise re-route event
 	rerouteEvent := map[string]interface{}{
 		"type":      "MISSION_REROUTED",
 		"missionId": missionID,
 		"newPath":   newPath,
 	}
 	eventJSON, _ := json.Marshal(rerouteEvent)
-	ctx.GetStub().SetEvent(models.EventMissionRerouted, eventJSON)
+	ctx.RaiseEvent(models.EventMissionRerouted, eventJSON)
+	auditMission(ctx, models.EventMissionRerouted, mission, map[string]interface{}{"path": newPath})
+
+	return nil
+}
+
+// AdvanceMission records that the mission's vehicle entered a segment of its path
+// The segment is marked occupied and every earlier path segment still held by the
+// mission is released. Advancing to a segment at or behind the current position is rejected
+func (c *MissionContract) AdvanceMission(
+	ctx RoutingContextInterface,
+	missionID string,
+	segmentID string,
+) error {
+	// Get mission
+	mission, err := c.GetMission(ctx, missionID)
+	if err != nil {
+		return err
+	}
+
+	// Verify mission is underway
+	if !isMissionUnderway(mission.Status) {
+		return fmt.Errorf("mission %s is not active (current: %s)", missionID, mission.Status)
+	}
+
+	// Verify caller org matches mission org
+	callerOrg, err := resolveCallerOrg(ctx)
+	if err != nil {
+		return err
+	}
+	if callerOrg.OrgType != mission.OrgType {
+		return fmt.Errorf("cannot advance mission from different organization")
+	}
+	if err := requireVehicleAccess(ctx, mission.VehicleID); err != nil {
+		return err
+	}
+
+	// Locate the segment ahead of the current position
+	previousIndex := mission.CurrentIndex
+	if previousIndex < -1 {
+		previousIndex = -1
+	}
+	nextIndex := -1
+	for i := previousIndex + 1; i < len(mission.Path); i++ {
+		if mission.Path[i] == segmentID {
+			nextIndex = i
+			break
+		}
+	}
+	if nextIndex < 0 {
+		for i := 0; i <= previousIndex && i < len(mission.Path); i++ {
+			if mission.Path[i] == segmentID {
+				return fmt.Errorf("out-of-order advance: mission %s is already past segment %s", missionID, segmentID)
+			}
+		}
+		return fmt.Errorf("segment %s is not on the path of mission %s", segmentID, missionID)
+	}
+	if !onCurrentLeg(mission, segmentID) {
+		return fmt.Errorf("segment %s is not on the current leg of mission %s (reach waypoint %s first)",
+			segmentID, missionID, mission.Waypoints[mission.CurrentLeg].NodeID)
+	}
+
+	// Occupy the new segment
+	segmentContract := &SegmentContract{}
+	err = segmentContract.OccupySegment(ctx, segmentID, mission.VehicleID)
+	if err != nil {
+		return err
+	}
+
+	now, err := txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+
+	// Release the segments driven since the last advance
+	start := previousIndex
+	if start < 0 {
+		start = 0
+	}
+	for _, seg := range mission.Path[start:nextIndex] {
+		if seg == segmentID {
+			continue
+		}
+		segment, err := segmentContract.getSegment(ctx, seg)
+		if err != nil {
+			return err
+		}
+		if segment == nil {
+			continue
+		}
+		released, _, err := segmentContract.releaseReservations(ctx, segment, byMission(missionID), nil, now)
+		if err != nil {
+			return err
+		}
+		if len(released) == 0 {
+			continue
+		}
+		if err := segmentContract.putSegment(ctx, segment, models.EventSegmentReleased, missionID, mission.VehicleID); err != nil {
+			return err
+		}
+	}
+
+	// Only the intersections still ahead stay reserved (a mission stored without
+	// step endpoints keeps them until it ends)
+	var ahead map[string]bool
+	if len(mission.Steps) == len(mission.Path) {
+		ahead = stepNodes(mission.Steps[nextIndex:])
+	}
+
+	// Reload: occupying may have released expired reservations and updated the mission
+	mission, err = c.GetMission(ctx, missionID)
+	if err != nil {
+		return err
+	}
+	mission.CurrentIndex = nextIndex
+	releasedNodes := []string{}
+	if ahead != nil {
+		if releasedNodes, err = releaseNodesExcept(ctx, mission, ahead); err != nil {
+			return err
+		}
+	}
+
+	missionJSON, err := json.Marshal(mission)
+	if err != nil {
+		return fmt.Errorf("failed to marshal mission: %v", err)
+	}
+
+	err = putEntityState(ctx, missionObjectType, missionID, missionJSON)
+	if err != nil {
+		return fmt.Errorf("failed to write state: %v", err)
+	}
+
+	// Raise event
+	advanceEvent := map[string]interface{}{
+		"type":          models.EventMissionAdvanced,
+		"missionId":     missionID,
+		"vehicleId":     mission.VehicleID,
+		"segmentId":     segmentID,
+		"currentIndex":  nextIndex,
+		"released":      mission.Path[start:nextIndex],
+		"releasedNodes": releasedNodes,
+		"leg":           mission.CurrentLeg,
+	}
+	eventJSON, _ := json.Marshal(advanceEvent)
+	ctx.RaiseEvent(models.EventMissionAdvanced, eventJSON)
+	auditMission(ctx, models.EventMissionAdvanced, mission, map[string]interface{}{
+		"segmentId":    segmentID,
+		"currentIndex": nextIndex,
+	})
+
+	return nil
+}
+
+// GetEffectivePriority returns the priority a mission for a vehicle would get at a severity
+// Lets clients plan routes with the same policy CreateMission applies
+func (c *MissionContract) GetEffectivePriority(
+	ctx RoutingContextInterface,
+	vehicleID string,
+	severity string,
+) (int, error) {
+	callerOrg, err := resolveCallerOrg(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	vehicleContract := &VehicleContract{}
+	vehicle, err := vehicleContract.GetVehicle(ctx, vehicleID)
+	if err != nil {
+		return 0, err
+	}
+
+	return effectivePriority(callerOrg, vehicle.VehicleType, severity)
+}
+
+// UpdateMissionPriority escalates or de-escalates a mission to a new incident severity
+// The priority is recomputed from the policy and applied to every reservation the mission
+// still holds and to its queued requests, which move up or down their waitlists. Pending conflicts it was tied in go to whichever side is now stronger,
+// so an escalated mission takes the contested window and a de-escalated one gives it up;
+// segments it already lost are not reclaimed
+func (c *MissionContract) UpdateMissionPriority(
+	ctx RoutingContextInterface,
+	missionID string,
+	severity string,
+	reason string,
+) error {
+	if reason == "" {
+		return fmt.Errorf("a reason is required to change mission priority")
+	}
+
+	// Get mission
+	mission, err := c.GetMission(ctx, missionID)
+	if err != nil {
+		return err
+	}
+	if mission.Status != models.MissionPending && !isMissionUnderway(mission.Status) {
+		return fmt.Errorf("mission %s is not pending or active (current: %s)", missionID, mission.Status)
+	}
+
+	// Verify caller org matches mission org
+	callerOrg, err := resolveCallerOrg(ctx)
+	if err != nil {
+		return err
+	}
+	if callerOrg.OrgType != mission.OrgType {
+		return fmt.Errorf("cannot change priority of mission from different organization")
+	}
+
+	vehicleContract := &VehicleContract{}
+	vehicle, err := vehicleContract.GetVehicle(ctx, mission.VehicleID)
+	if err != nil {
+		return err
+	}
+	priorityLevel, err := effectivePriority(callerOrg, vehicle.VehicleType, severity)
+	if err != nil {
+		return err
+	}
+	if severity == mission.Severity && priorityLevel == mission.PriorityLevel {
+		return fmt.Errorf("mission %s already has severity %s", missionID, severity)
+	}
+
+	// Re-evaluate the held segments under the new priority
+	segmentContract := &SegmentContract{}
+	updated := []string{}
+	for _, segmentID := range mission.Path {
+		segment, err := segmentContract.getSegment(ctx, segmentID)
+		if err != nil {
+			return err
+		}
+		if segment == nil {
+			continue
+		}
+
+		held := false
+		for i := range segment.Reservations {
+			if segment.Reservations[i].MissionID == missionID {
+				segment.Reservations[i].PriorityLevel = priorityLevel
+				held = true
+			}
+		}
+		if !held {
+			continue
+		}
+		if _, err := segmentContract.writeSegment(ctx, segment); err != nil {
+			return err
+		}
+		updated = append(updated, segmentID)
+	}
+
+	// and the held intersections
+	updatedNodes, err := setNodePriority(ctx, mission, priorityLevel)
+	if err != nil {
+		return err
+	}
+
+	// Queued requests take their new place in the waitlists
+	queued, err := segmentContract.setQueuedPriority(ctx, mission, priorityLevel)
+	if err != nil {
+		return err
+	}
+
+	oldPriority := mission.PriorityLevel
+	oldSeverity := mission.Severity
+	mission.PriorityLevel = priorityLevel
+	mission.Severity = severity
+
+	missionJSON, err := json.Marshal(mission)
+	if err != nil {
+		return fmt.Errorf("failed to marshal mission: %v", err)
+	}
+
+	err = putEntityState(ctx, missionObjectType, missionID, missionJSON)
+	if err != nil {
+		return fmt.Errorf("failed to write state: %v", err)
+	}
+
+	// Pending conflicts the new priority no longer ties go to the stronger side
+	settled, err := c.settleBrokenTies(ctx, mission, callerOrg.MSPID)
+	if err != nil {
+		return err
+	}
+	if len(settled) > 0 {
+		// Losing a conflict flags the mission for reroute
+		if mission, err = c.GetMission(ctx, missionID); err != nil {
+			return err
+		}
+	}
+
+	// Raise event
+	priorityEvent := map[string]interface{}{
+		"type":        models.EventPriorityChanged,
+		"missionId":   missionID,
+		"vehicleId":   mission.VehicleID,
+		"oldPriority": oldPriority,
+		"newPriority": priorityLevel,
+		"oldSeverity": oldSeverity,
+		"newSeverity": severity,
+		"segments":    updated,
+		"nodes":       updatedNodes,
+		"queued":      queued,
+		"conflicts":   settled,
+	}
+	eventJSON, _ := json.Marshal(priorityEvent)
+	ctx.RaiseEvent(models.EventPriorityChanged, eventJSON)
+	auditMission(ctx, models.EventPriorityChanged, mission, map[string]interface{}{
+		"oldPriority": oldPriority,
+		"newPriority": priorityLevel,
+		"oldSeverity": oldSeverity,
+		"newSeverity": severity,
+		"reason":      reason,
+		"segments":    updated,
+		"nodes":       updatedNodes,
+		"queued":      queued,
+		"conflicts":   settled,
+	})
+
+	return nil
+}
+
+// settleBrokenTies resolves the pending conflicts of a mission whose priority changed
+// and no longer ties with the other party: the stronger side wins, as if the caller
+// had resolved the conflict. Returns the IDs of the settled conflicts
+func (c *MissionContract) settleBrokenTies(
+	ctx RoutingContextInterface,
+	mission *models.Mission,
+	resolvedBy string,
+) ([]string, error) {
+	conflicts, err := queryIndex[models.Conflict](ctx, conflictStatusIndex, conflictObjectType, models.ConflictPending)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query conflicts: %v", err)
+	}
+
+	segmentContract := &SegmentContract{}
+	settled := []string{}
+	for _, conflict := range conflicts {
+		switch mission.MissionID {
+		case conflict.Mission1ID:
+			conflict.Priority1 = mission.PriorityLevel
+		case conflict.Mission2ID:
+			conflict.Priority2 = mission.PriorityLevel
+		default:
+			continue
+		}
+		if conflict.Priority1 == conflict.Priority2 {
+			continue
+		}
+		resolution := models.ResolutionMission1Wins
+		if conflict.Priority2 < conflict.Priority1 {
+			resolution = models.ResolutionMission2Wins
+		}
+
+		mission1, err := conflictParty(ctx, conflict.Mission1ID, conflict.Vehicle1ID, conflict.OrgType1)
+		if err != nil {
+			return nil, err
+		}
+		mission2, err := conflictParty(ctx, conflict.Mission2ID, conflict.Vehicle2ID, conflict.OrgType2)
+		if err != nil {
+			return nil, err
+		}
+		if err := segmentContract.settleConflict(ctx, conflict, mission1, mission2, resolution, resolvedBy); err != nil {
+			return nil, fmt.Errorf("failed to settle conflict %s: %v", conflict.ConflictID, err)
+		}
+		settled = append(settled, conflict.ConflictID)
+	}
+
+	return settled, nil
+}
+
+// RenewLease extends the lease on every live reservation held by a mission
+// The backend calls it as a heartbeat while the mission is underway; reservations
+// whose lease already ran out are released and the mission is marked stale
+func (c *MissionContract) RenewLease(
+	ctx RoutingContextInterface,
+	missionID string,
+) error {
+	// Get mission
+	mission, err := c.GetMission(ctx, missionID)
+	if err != nil {
+		return err
+	}
+
+	// Verify mission is underway
+	if !isMissionUnderway(mission.Status) {
+		return fmt.Errorf("mission %s is not active (current: %s)", missionID, mission.Status)
+	}
+
+	// Verify caller org matches mission org
+	callerOrg, err := resolveCallerOrg(ctx)
+	if err != nil {
+		return err
+	}
+	if callerOrg.OrgType != mission.OrgType {
+		return fmt.Errorf("cannot renew lease for mission from different organization")
+	}
+	if err := requireVehicleAccess(ctx, mission.VehicleID); err != nil {
+		return err
+	}
+
+	now, err := txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+	leaseExpiresAt := now + reservationLeaseSeconds
+
+	segmentContract := &SegmentContract{}
+	for _, segmentID := range mission.Path {
+		segment, err := segmentContract.getSegment(ctx, segmentID)
+		if err != nil {
+			return err
+		}
+		if segment == nil {
+			continue
+		}
+
+		expired, err := segmentContract.expireReservations(ctx, segment, now)
+		if err != nil {
+			return err
+		}
+		i := findReservation(segment, byMission(missionID))
+		if i >= 0 {
+			segment.Reservations[i].LeaseExpiresAt = leaseExpiresAt
+		}
+		if i >= 0 || len(expired) > 0 {
+			if _, err := segmentContract.writeSegment(ctx, segment); err != nil {
+				return err
+			}
+		}
+	}
+	for _, nodeID := range mission.Nodes {
+		if err := renewNodeLease(ctx, nodeID, missionID, leaseExpiresAt, now); err != nil {
+			return err
+		}
+	}
+
+	// Reload: expiring reservations above may have marked the mission stale
+	mission, err = c.GetMission(ctx, missionID)
+	if err != nil {
+		return err
+	}
+	if mission.Status != models.MissionStale {
+		mission.LeaseExpiresAt = leaseExpiresAt
+	}
+
+	missionJSON, err := json.Marshal(mission)
+	if err != nil {
+		return fmt.Errorf("failed to marshal mission: %v", err)
+	}
+
+	err = putEntityState(ctx, missionObjectType, missionID, missionJSON)
+	if err != nil {
+		return fmt.Errorf("failed to write state: %v", err)
+	}
+
+	// Raise event
+	leaseEvent := map[string]interface{}{
+		"type":           models.EventLeaseRenewed,
+		"missionId":      missionID,
+		"status":         mission.Status,
+		"leaseExpiresAt": mission.LeaseExpiresAt,
+	}
+	eventJSON, _ := json.Marshal(leaseEvent)
+	ctx.RaiseEvent(models.EventLeaseRenewed, eventJSON)
+	auditMission(ctx, models.EventLeaseRenewed, mission, map[string]interface{}{"leaseExpiresAt": mission.LeaseExpiresAt})
+
+	return nil
+}
+
+// GetMissionHistory retrieves every committed version of a mission, oldest first
+// fromTime and toTime bound the transaction timestamp (inclusive); 0 leaves that side open
+func (c *MissionContract) GetMissionHistory(
+	ctx RoutingContextInterface,
+	missionID string,
+	fromTime int64,
+	toTime int64,
+) ([]*models.MissionVersion, error) {
+	versions, err := keyHistory(ctx, missionObjectType, missionID, fromTime, toTime)
+	if err != nil {
+		return nil, err
+	}
+
+	history := []*models.MissionVersion{}
+	for _, v := range versions {
+		version := &models.MissionVersion{
+			TxID:      v.txID,
+			Timestamp: v.timestamp,
+			IsDelete:  v.isDelete,
+		}
+		if !v.isDelete {
+			var mission models.Mission
+			err = json.Unmarshal(v.value, &mission)
+			if err != nil {
+				return nil, fmt.Errorf("failed to unmarshal mission version %s: %v", v.txID, err)
+			}
+			version.Mission = &mission
+		}
+		history = append(history, version)
+	}
+
+	return history, nil
+}
+
+// GetPreemptedSegments returns the segments a mission lost to higher priority missions
+func (c *MissionContract) GetPreemptedSegments(
+	ctx RoutingContextInterface,
+	missionID string,
+) ([]models.PreemptedSegment, error) {
+	mission, err := c.GetMission(ctx, missionID)
+	if err != nil {
+		return nil, err
+	}
+
+	if mission.PreemptedSegments == nil {
+		return []models.PreemptedSegment{}, nil
+	}
+	return mission.PreemptedSegments, nil
+}
+
+// parsePath accepts either a plain JSON array of segment IDs or an array of
+// {segmentId, fromNode, toNode, enterAt, exitAt} objects carrying per-segment
+// endpoints and ETA windows. Mission paths need the endpoints (see checkRoute)
+func parsePath(pathJSON string) ([]models.PathSegment, error) {
+	var segmentIDs []string
+	if err := json.Unmarshal([]byte(pathJSON), &segmentIDs); err == nil {
+		steps := []models.PathSegment{}
+		for _, segmentID := range segmentIDs {
+			steps = append(steps, models.PathSegment{SegmentID: segmentID})
+		}
+		return validatePath(steps)
+	}
+
+	var steps []models.PathSegment
+	if err := json.Unmarshal([]byte(pathJSON), &steps); err != nil {
+		return nil, fmt.Errorf("failed to parse path JSON: %v", err)
+	}
+	return validatePath(steps)
+}
+
+// validatePath rejects path steps without a segment ID
+func validatePath(steps []models.PathSegment) ([]models.PathSegment, error) {
+	for i, step := range steps {
+		if step.SegmentID == "" {
+			return nil, fmt.Errorf("path step %d has no segment ID", i)
+		}
+	}
+	return steps, nil
+}
+
+// rerouteStarts returns the nodes a new path for an underway mission may start from:
+// the start of the leg being driven, or the entry of the segment the vehicle is on
+func rerouteStarts(mission *models.Mission) []string {
+	starts := []string{legStart(mission)}
+	if len(mission.Steps) == len(mission.Path) && mission.CurrentIndex >= 0 && mission.CurrentIndex < len(mission.Steps) {
+		if from := mission.Steps[mission.CurrentIndex].FromNode; from != "" && from != starts[0] {
+			starts = append(starts, from)
+		}
+	}
+	return starts
+}
+
+// checkRoute rejects a path that does not drive from one of the start nodes to the
+// destination without gaps. Every step must give both of its endpoints
+func checkRoute(steps []models.PathSegment, starts []string, destination string) error {
+	if len(steps) == 0 {
+		return nil
+	}
+	for i, step := range steps {
+		if step.FromNode == "" || step.ToNode == "" {
+			return fmt.Errorf("path step %d (segment %s) needs both fromNode and toNode", i, step.SegmentID)
+		}
+		if i > 0 && step.FromNode != steps[i-1].ToNode {
+			return fmt.Errorf("path is not continuous: segment %s starts at %s, not %s", step.SegmentID, step.FromNode, steps[i-1].ToNode)
+		}
+	}
+
+	if starts != nil {
+		found := false
+		for _, start := range starts {
+			if steps[0].FromNode == start {
+				found = true
+			}
+		}
+		if !found {
+			return fmt.Errorf("path starts at %s, not %s", steps[0].FromNode, strings.Join(starts, " or "))
+		}
+	}
+	if last := steps[len(steps)-1]; last.ToNode != destination {
+		return fmt.Errorf("path ends at %s, not %s", last.ToNode, destination)
+	}
+	return nil
+}
+
+// isMissionUnderway reports whether a mission is on the road and may hold segments
+func isMissionUnderway(status string) bool {
+	return status == models.MissionActive ||
+		status == models.MissionNeedsReroute ||
+		status == models.MissionStale
+}
+
+// setMissionVehicleStatus moves the vehicle of a mission the caller was allowed to act on
+func setMissionVehicleStatus(ctx RoutingContextInterface, vehicleID string, status string) error {
+	vehicleContract := &VehicleContract{}
+	vehicle, err := vehicleContract.GetVehicle(ctx, vehicleID)
+	if err != nil {
+		return err
+	}
+	return vehicleContract.setVehicleStatus(ctx, vehicle, status)
+}
+
+// updateUnderwayMission applies a change to a mission that is still underway
+// and stores it. Missions that are unknown or no longer underway are left untouched,
+// since segments may be reserved directly under IDs that are not missions
+func (c *MissionContract) updateUnderwayMission(
+	ctx RoutingContextInterface,
+	missionID string,
+	update func(mission *models.Mission),
+) error {
+	missionJSON, err := getEntityState(ctx, missionObjectType, missionID)
+	if err != nil {
+		return fmt.Errorf("failed to read state: %v", err)
+	}
+	if missionJSON == nil {
+		return nil
+	}
+
+	var mission models.Mission
+	err = json.Unmarshal(missionJSON, &mission)
+	if err != nil {
+		return fmt.Errorf("failed to unmarshal mission: %v", err)
+	}
+	if err := checkDocType(missionID, mission.DocType, models.DocTypeMission); err != nil {
+		return err
+	}
+	if !isMissionUnderway(mission.Status) {
+		return nil
+	}
+
+	update(&mission)
+
+	missionJSON, err = json.Marshal(mission)
+	if err != nil {
+		return fmt.Errorf("failed to marshal mission: %v", err)
+	}
+
+	err = putEntityState(ctx, missionObjectType, missionID, missionJSON)
+	if err != nil {
+		return fmt.Errorf("failed to write state: %v", err)
+	}
 
 	return nil
 }
 
+// routeSlot returns where a step fits in a mission's path: the index of the step
+// itself when the mission already drives the segment that way (onRoute), or else the
+// index of the gap ahead of the vehicle it closes, such as one a preemption left.
+// The leg start and the destination bound the path. -1 if it connects to neither
+func routeSlot(mission *models.Mission, step models.PathSegment) (int, bool) {
+	steps := mission.Steps
+	if len(steps) != len(mission.Path) || step.FromNode == "" || step.ToNode == "" {
+		return -1, false
+	}
+	for i, s := range steps {
+		if s.SegmentID == step.SegmentID && s.FromNode == step.FromNode && s.ToNode == step.ToNode {
+			return i, true
+		}
+	}
+
+	for i := mission.CurrentIndex + 1; i <= len(steps); i++ {
+		prev := legStart(mission)
+		if i > 0 {
+			prev = steps[i-1].ToNode
+		}
+		next := mission.DestNode
+		if i < len(steps) {
+			next = steps[i].FromNode
+		}
+		if prev != next && step.FromNode == prev && step.ToNode == next {
+			return i, false
+		}
+	}
+	return -1, false
+}
+
+// insertStep puts a step into a mission's path at slot (see routeSlot), and into the
+// leg it continues on a multi-stop mission. A step already on the route takes the new window
+func insertStep(mission *models.Mission, slot int, onRoute bool, step models.PathSegment) {
+	if onRoute {
+		mission.Steps[slot].EnterAt = step.EnterAt
+		mission.Steps[slot].ExitAt = step.ExitAt
+		return
+	}
+
+	if len(mission.Waypoints) > 0 && len(mission.Path) > 0 {
+		// The step joins the leg of the one it follows (or precedes, at the start)
+		neighbour := mission.Path[0]
+		if slot > 0 {
+			neighbour = mission.Path[slot-1]
+		}
+	legs:
+		for i := range mission.Waypoints {
+			for _, seg := range mission.Waypoints[i].Path {
+				if seg == neighbour {
+					mission.Waypoints[i].Path = append(mission.Waypoints[i].Path, step.SegmentID)
+					break legs
+				}
+			}
+		}
+	}
+
+	mission.Path = append(mission.Path[:slot], append([]string{step.SegmentID}, mission.Path[slot:]...)...)
+	mission.Steps = append(mission.Steps[:slot], append([]models.PathSegment{step}, mission.Steps[slot:]...)...)
+}
+
+// removeFromPath drops a segment from a mission's path and steps, keeping CurrentIndex
+// pointing at the same position along the remaining path
+func removeFromPath(mission *models.Mission, segmentID string) {
+	hasSteps := len(mission.Steps) == len(mission.Path)
+	remaining := []string{}
+	steps := []models.PathSegment{}
+	currentIndex := mission.CurrentIndex
+	for i, seg := range mission.Path {
+		if seg != segmentID {
+			remaining = append(remaining, seg)
+			if hasSteps {
+				steps = append(steps, mission.Steps[i])
+			}
+		} else if i <= mission.CurrentIndex {
+			currentIndex--
+		}
+	}
+	mission.Path = remaining
+	mission.CurrentIndex = currentIndex
+	if hasSteps {
+		mission.Steps = steps
+	}
+}
+
+// removeNode drops an intersection from the nodes a mission holds
+func removeNode(mission *models.Mission, nodeID string) {
+	if nodeID == "" {
+		return
+	}
+	remaining := []string{}
+	for _, node := range mission.Nodes {
+		if node != nodeID {
+			remaining = append(remaining, node)
+		}
+	}
+	mission.Nodes = remaining
+}
+
+// markPreempted removes a segment (or intersection) from a mission's path, records
+// who took it and flags the mission for reroute, in the same transaction that took it
+// (a preemption or a conflict resolution the mission lost)
+func (c *MissionContract) markPreempted(
+	ctx RoutingContextInterface,
+	missionID string,
+	preemption models.PreemptedSegment,
+) error {
+	if missionID == preemption.ByMissionID {
+		return nil
+	}
+
+	return c.updateUnderwayMission(ctx, missionID, func(mission *models.Mission) {
+		removeFromPath(mission, preemption.SegmentID)
+		removeNode(mission, preemption.NodeID)
+		mission.PreemptedSegments = append(mission.PreemptedSegments, preemption)
+		mission.Status = models.MissionNeedsReroute
+	})
+}
+
+// markStale removes a segment whose lease expired from a mission's path and
+// flags the mission as stale with the reason
+func (c *MissionContract) markStale(
+	ctx RoutingContextInterface,
+	missionID string,
+	segmentID string,
+	reason string,
+) error {
+	return c.updateUnderwayMission(ctx, missionID, func(mission *models.Mission) {
+		removeFromPath(mission, segmentID)
+		mission.Status = models.MissionStale
+		mission.StaleReason = reason
+	})
+}
@@ -0,0 +1,130 @@
+package contracts
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/emergency-routing/chaincode/routing/models"
+)
+
+// tiedMissions starts two medical missions of the same priority over S1,
+// leaving M2 in conflict with M1 on the segment and its intersections
+func tiedMissions(t *testing.T) *ledger {
+	l := newLedger(t)
+	l.registerVehicle(medicalDispatcher, "AMB-1", "medical", "ambulance", 2)
+	l.registerVehicle(medicalDispatcher, "AMB-2", "medical", "ambulance", 2)
+	l.startMission(medicalDispatcher, "M1", "AMB-1", "A", "B", "high", `[{"segmentId":"S1","fromNode":"A","toNode":"B"}]`)
+	l.startMission(medicalDispatcher, "M2", "AMB-2", "A", "B", "high", `[{"segmentId":"S1","fromNode":"A","toNode":"B"}]`)
+	if len(l.pendingConflicts()) == 0 {
+		t.Fatal("expected M2 to be in conflict with M1")
+	}
+	return l
+}
+
+func TestUpdateMissionPrioritySettlesBrokenTies(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		missionID string
+		severity  string
+	}{
+		{"escalating the challenger", "M2", models.SeverityCritical},
+		{"de-escalating the holder", "M1", models.SeverityLow},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			l := tiedMissions(t)
+			l.mustInvoke(medicalDispatcher, "MissionContract:UpdateMissionPriority", tc.missionID, tc.severity, "incident reassessed")
+
+			if pending := l.pendingConflicts(); len(pending) != 0 {
+				t.Fatalf("%d conflicts still pending", len(pending))
+			}
+			if holders := l.segment("S1").Reservations; len(holders) != 1 || holders[0].MissionID != "M2" {
+				t.Fatalf("S1 should be held by M2, got %+v", holders)
+			}
+			if status := l.mission("M1").Status; status != models.MissionNeedsReroute {
+				t.Fatalf("M1 is %s, want %s", status, models.MissionNeedsReroute)
+			}
+			if status := l.mission("M2").Status; status != models.MissionActive {
+				t.Fatalf("M2 is %s, want %s", status, models.MissionActive)
+			}
+		})
+	}
+}
+
+func TestUpdateMissionPriorityKeepsTies(t *testing.T) {
+	l := tiedMissions(t)
+	pending := len(l.pendingConflicts())
+
+	// Escalating M1 breaks the tie in M1's favour; M2 is flagged
+	l.mustInvoke(medicalDispatcher, "MissionContract:UpdateMissionPriority", "M1", models.SeverityCritical, "incident reassessed")
+	if left := len(l.pendingConflicts()); left != 0 {
+		t.Fatalf("%d of %d conflicts still pending", left, pending)
+	}
+	if holders := l.segment("S1").Reservations; len(holders) != 1 || holders[0].MissionID != "M1" || holders[0].PriorityLevel != 1 {
+		t.Fatalf("S1 should be held by M1 at priority 1, got %+v", holders)
+	}
+	if status := l.mission("M2").Status; status != models.MissionNeedsReroute {
+		t.Fatalf("M2 is %s, want %s", status, models.MissionNeedsReroute)
+	}
+}
+
+func TestHandoffMovesQueuedRequests(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		path    string
+		waiting []string
+	}{
+		// The new vehicle starts at B: S1 still closes the gap from the origin
+		{"gap still open", `[{"segmentId":"S2","enterAt":%d,"exitAt":%d,"fromNode":"B","toNode":"C"}]`, []string{"POL-2"}},
+		{"gap closed", `[{"segmentId":"S9","enterAt":%d,"exitAt":%d,"fromNode":"A","toNode":"C"}]`, []string{}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			l := newLedger(t)
+			l.registerVehicle(policeDispatcher, "POL-1", "police", "patrol_car", 3)
+			l.registerVehicle(policeDispatcher, "POL-2", "police", "patrol_car", 3)
+			l.registerVehicle(medicalDispatcher, "AMB-1", "medical", "ambulance", 1)
+			start := l.now
+			l.startMission(policeDispatcher, "P1", "POL-1", "A", "C", "low",
+				`[{"segmentId":"S1","fromNode":"A","toNode":"B"},{"segmentId":"S2","fromNode":"B","toNode":"C"}]`)
+			l.startMission(medicalDispatcher, "M1", "AMB-1", "A", "B", "critical",
+				fmt.Sprintf(`[{"segmentId":"S1","enterAt":%d,"exitAt":%d,"fromNode":"A","toNode":"B"}]`, start+1000, start+1060))
+
+			// P1 lost S1 to M1 and waits for it
+			priority := fmt.Sprint(l.mission("P1").PriorityLevel)
+			l.mustInvoke(policeDispatcher, "SegmentContract:QueueSegment", "S1", "POL-1", "P1", priority, "0", "0", "A", "B")
+
+			l.mustInvoke(policeDispatcher, "MissionContract:HandoffMission", "P1", "POL-2", fmt.Sprintf(tc.path, start+2000, start+2060))
+
+			waiting := []string{}
+			for _, r := range l.segment("S1").Waitlist {
+				waiting = append(waiting, r.VehicleID)
+			}
+			if fmt.Sprint(waiting) != fmt.Sprint(tc.waiting) {
+				t.Fatalf("S1 waitlist holds %v, want %v", waiting, tc.waiting)
+			}
+		})
+	}
+}
+
+func TestHandoffRechecksTheLanesItKeeps(t *testing.T) {
+	l := newLedger(t)
+	l.registerVehicle(policeDispatcher, "POL-1", "police", "patrol_car", 3)
+	l.registerVehicle(medicalDispatcher, "AMB-1", "medical", "ambulance", 1)
+	l.registerVehicle(medicalDispatcher, "AMB-2", "medical", "ambulance", 1)
+	l.mustInvoke(trafficAuthority, "SegmentContract:SetSegmentCapacity", "S1", "2")
+	l.startMission(policeDispatcher, "P1", "POL-1", "A", "B", "low", `[{"segmentId":"S1","fromNode":"A","toNode":"B"}]`)
+	l.startMission(medicalDispatcher, "M1", "AMB-1", "A", "B", "high", `[{"segmentId":"S1","fromNode":"A","toNode":"B"}]`)
+
+	// Two vehicles now share a single lane until one of them gives way
+	l.mustInvoke(trafficAuthority, "SegmentContract:SetSegmentCapacity", "S1", "1")
+	l.mustInvoke(medicalDispatcher, "MissionContract:HandoffMission", "M1", "AMB-2", `[{"segmentId":"S1","fromNode":"A","toNode":"B"}]`)
+
+	if holders := l.segment("S1").Reservations; len(holders) != 1 || holders[0].VehicleID != "AMB-2" {
+		t.Fatalf("S1 should be held by AMB-2 alone, got %+v", holders)
+	}
+	if status := l.mission("P1").Status; status != models.MissionNeedsReroute {
+		t.Fatalf("P1 is %s, want %s", status, models.MissionNeedsReroute)
+	}
+	if handoffs := l.mission("M1").Handoffs; len(handoffs) != 1 || len(handoffs[0].KeptSegments) != 0 {
+		t.Fatalf("S1 was settled anew, not kept: %+v", handoffs)
+	}
+}
@@ -0,0 +1,830 @@
+package contracts
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/emergency-routing/chaincode/routing/models"
+)
+
+// nodeWindow is an intersection a path crosses, the window the vehicle holds it and
+// the lane it crosses it by: the segment it arrives on (leaves on, for the first node)
+// and the node it enters that segment from
+type nodeWindow struct {
+	nodeID    string
+	enterAt   int64
+	exitAt    int64
+	via       string
+	direction string
+}
+
+// GetNode retrieves an intersection by ID, with expired reservations shown as free
+// Returns nil if no path has crossed the node yet
+func (c *SegmentContract) GetNode(
+	ctx RoutingContextInterface,
+	nodeID string,
+) (*models.Node, error) {
+	node, err := getNode(ctx, nodeID)
+	if err != nil || node == nil {
+		return node, err
+	}
+
+	now, err := txTimestamp(ctx)
+	if err != nil {
+		return nil, err
+	}
+	removeNodeReservations(node, expiredAt(now))
+	refreshNodeStatus(node)
+
+	return node, nil
+}
+
+// getNode retrieves a node as stored, including expired reservations
+// Returns nil if node doesn't exist
+func getNode(
+	ctx RoutingContextInterface,
+	nodeID string,
+) (*models.Node, error) {
+	nodeJSON, err := getEntityState(ctx, nodeObjectType, nodeID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read state: %v", err)
+	}
+	if nodeJSON == nil {
+		return nil, nil
+	}
+
+	var node models.Node
+	err = json.Unmarshal(nodeJSON, &node)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal node: %v", err)
+	}
+	if err := checkDocType(nodeID, node.DocType, models.DocTypeNode); err != nil {
+		return nil, err
+	}
+	if node.Reservations == nil {
+		node.Reservations = []models.Reservation{}
+	}
+
+	return &node, nil
+}
+
+// writeNode refreshes the status of a node and stores it
+func writeNode(
+	ctx RoutingContextInterface,
+	node *models.Node,
+) ([]byte, error) {
+	refreshNodeStatus(node)
+
+	nodeJSON, err := json.Marshal(node)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal node: %v", err)
+	}
+
+	err = putEntityState(ctx, nodeObjectType, node.NodeID, nodeJSON)
+	if err != nil {
+		return nil, fmt.Errorf("failed to write state: %v", err)
+	}
+
+	return nodeJSON, nil
+}
+
+// refreshNodeStatus keeps reservations ordered by enterAt and sets the node status
+func refreshNodeStatus(node *models.Node) {
+	sort.SliceStable(node.Reservations, func(i, j int) bool {
+		return node.Reservations[i].EnterAt < node.Reservations[j].EnterAt
+	})
+
+	node.Status = models.StatusFree
+	if len(node.Reservations) > 0 {
+		node.Status = models.StatusReserved
+	}
+}
+
+// removeNodeReservations drops every reservation on a node matching the predicate
+// Returns the removed reservations
+func removeNodeReservations(node *models.Node, match func(models.Reservation) bool) []models.Reservation {
+	kept, removed := splitReservations(node.Reservations, match)
+	node.Reservations = kept
+	return removed
+}
+
+// reserveNode reserves an intersection window on behalf of orgType, crossed by the
+// lane via and direction give (see nodeWindow)
+// Competing windows are settled as in ReserveSegment: a higher priority request
+// preempts them, the same priority creates a conflict and a lower priority is denied.
+// Vehicles in the same lane only compete once its segment's lanes are taken (see nodeContenders).
+// Expired node reservations are dropped silently; their segments mark the mission stale
+func (c *SegmentContract) reserveNode(
+	ctx RoutingContextInterface,
+	nodeID string,
+	vehicleID string,
+	missionID string,
+	orgType string,
+	priorityLevel int,
+	enterAt int64,
+	exitAt int64,
+	via string,
+	direction string,
+) (*models.Conflict, error) {
+	node, err := getNode(ctx, nodeID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Lazy initialization: create node if it doesn't exist
+	if node == nil {
+		node = &models.Node{
+			DocType:      models.DocTypeNode,
+			NodeID:       nodeID,
+			Status:       models.StatusFree,
+			Reservations: []models.Reservation{},
+		}
+	}
+
+	now, err := txTimestamp(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	enterAt, exitAt, err = normalizeWindow(enterAt, exitAt, now)
+	if err != nil {
+		return nil, err
+	}
+
+	reservation := models.Reservation{
+		MissionID:     missionID,
+		VehicleID:     vehicleID,
+		OrgType:       orgType,
+		PriorityLevel: priorityLevel,
+		Status:        models.StatusReserved,
+		EnterAt:       enterAt,
+		ExitAt:        exitAt,
+		ReservedAt:    now,
+
+		LeaseExpiresAt: now + reservationLeaseSeconds,
+		Direction:      direction,
+		Via:            via,
+	}
+
+	// A mission re-reserving a node replaces its own window, expired ones no longer compete
+	removeNodeReservations(node, byMission(missionID))
+	expired := removeNodeReservations(node, expiredAt(now))
+
+	// Check if the window is already taken - the mission's own convoy shares it
+	_, overlapping := splitReservations(node.Reservations, inWindow(enterAt, exitAt))
+	overlapping, err = outsideConvoy(ctx, missionID, overlapping)
+	if err != nil {
+		return nil, err
+	}
+	overlapping, err = nodeContenders(ctx, overlapping, via, direction)
+	if err != nil {
+		return nil, err
+	}
+	if len(overlapping) > 0 {
+		// The strongest overlapping reservation decides the outcome
+		strongest := overlapping[0]
+		for _, r := range overlapping[1:] {
+			if r.PriorityLevel < strongest.PriorityLevel {
+				strongest = r
+			}
+		}
+
+		if priorityLevel < strongest.PriorityLevel {
+			// Higher priority (lower number) - preempt every overlapping reservation
+			for _, victim := range overlapping {
+				removeNodeReservations(node, byMission(victim.MissionID))
+			}
+			node.Reservations = append(node.Reservations, reservation)
+
+			if _, err := writeNode(ctx, node); err != nil {
+				return nil, err
+			}
+
+			missionContract := &MissionContract{}
+			for _, victim := range overlapping {
+				// Tell the losing mission it no longer holds the intersection
+				err = missionContract.markPreempted(ctx, victim.MissionID, models.PreemptedSegment{
+					NodeID:        nodeID,
+					ByMissionID:   missionID,
+					ByVehicleID:   vehicleID,
+					PriorityLevel: priorityLevel,
+					PreemptedAt:   now,
+				})
+				if err != nil {
+					return nil, err
+				}
+
+				// Raise preemption event
+				preemptionEvent := map[string]interface{}{
+					"type":          models.EventPreemptionTriggered,
+					"nodeId":        nodeID,
+					"preemptedBy":   vehicleID,
+					"preemptedFrom": victim.VehicleID,
+					"oldMissionId":  victim.MissionID,
+					"newMissionId":  missionID,
+					"newPriority":   priorityLevel,
+					"enterAt":       enterAt,
+					"exitAt":        exitAt,
+				}
+				eventJSON, _ := json.Marshal(preemptionEvent)
+				ctx.RaiseEvent(models.EventPreemptionTriggered, eventJSON)
+				ctx.Audit(models.AuditEvent{
+					EventType: models.EventPreemptionTriggered,
+					MissionID: victim.MissionID,
+					VehicleID: victim.VehicleID,
+					Details: map[string]interface{}{
+						"nodeId":               nodeID,
+						"preemptedByMissionId": missionID,
+						"preemptedByVehicleId": vehicleID,
+						"priorityLevel":        priorityLevel,
+					},
+				})
+			}
+			ctx.Audit(models.AuditEvent{
+				EventType: models.EventNodeReserved,
+				MissionID: missionID,
+				VehicleID: vehicleID,
+				Details: map[string]interface{}{
+					"nodeId":    nodeID,
+					"enterAt":   enterAt,
+					"exitAt":    exitAt,
+					"preempted": len(overlapping),
+				},
+			})
+
+			return nil, nil
+
+		} else if priorityLevel == strongest.PriorityLevel {
+			// Same priority - create conflict for negotiation
+			conflict := &models.Conflict{
+				DocType:    models.DocTypeConflict,
+				ConflictID: txScopedID(ctx, "CONFLICT", nodeID),
+				NodeID:     nodeID,
+				Mission1ID: strongest.MissionID,
+				Mission2ID: missionID,
+				Priority1:  strongest.PriorityLevel,
+				Priority2:  priorityLevel,
+				Status:     models.ConflictPending,
+				CreatedAt:  now,
+				EnterAt:    enterAt,
+				ExitAt:     exitAt,
+				Direction:  direction,
+				Via:        via,
+
+				Vehicle1ID: strongest.VehicleID,
+				Vehicle2ID: vehicleID,
+				OrgType1:   strongest.OrgType,
+				OrgType2:   orgType,
+			}
+
+			// Store conflict
+			conflictJSON, err := json.Marshal(conflict)
+			if err != nil {
+				return nil, fmt.Errorf("failed to marshal conflict: %v", err)
+			}
+			err = putEntityState(ctx, conflictObjectType, conflict.ConflictID, conflictJSON)
+			if err != nil {
+				return nil, fmt.Errorf("failed to write state: %v", err)
+			}
+
+			// Raise conflict event
+			ctx.RaiseEvent(models.EventConflictDetected, conflictJSON)
+			ctx.Audit(models.AuditEvent{
+				EventType: models.EventConflictDetected,
+				MissionID: missionID,
+				VehicleID: vehicleID,
+				Details: map[string]interface{}{
+					"conflictId":        conflict.ConflictID,
+					"conflictMissionId": conflict.Mission1ID,
+					"nodeId":            nodeID,
+				},
+			})
+
+			// Persist the release of any expired reservations found on the way
+			if len(expired) > 0 {
+				if _, err := writeNode(ctx, node); err != nil {
+					return nil, err
+				}
+			}
+
+			return conflict, nil
+
+		} else {
+			// Lower priority - deny reservation
+			return nil, fmt.Errorf("intersection %s is reserved by higher priority vehicle", nodeID)
+		}
+	}
+
+	// Window is free - reserve it
+	node.Reservations = append(node.Reservations, reservation)
+
+	nodeJSON, err := writeNode(ctx, node)
+	if err != nil {
+		return nil, err
+	}
+	ctx.RaiseEvent(models.EventNodeReserved, nodeJSON)
+	ctx.Audit(models.AuditEvent{
+		EventType: models.EventNodeReserved,
+		MissionID: missionID,
+		VehicleID: vehicleID,
+		Details: map[string]interface{}{
+			"nodeId":  nodeID,
+			"enterAt": enterAt,
+			"exitAt":  exitAt,
+		},
+	})
+
+	return nil, nil
+}
+
+// nodeContenders returns the overlapping reservations on an intersection that a window
+// crossing it by the lane via and direction give must displace: every one crossing its
+// path, plus those in the same lane once the lane's segment has no free lane left
+func nodeContenders(
+	ctx RoutingContextInterface,
+	overlapping []models.Reservation,
+	via string,
+	direction string,
+) ([]models.Reservation, error) {
+	if via == "" {
+		return overlapping, nil
+	}
+	segment, err := (&SegmentContract{}).getSegment(ctx, via)
+	if err != nil {
+		return nil, err
+	}
+	capacity := 1
+	if segment != nil {
+		capacity = segmentCapacity(segment)
+	}
+
+	crossing, sameLane := splitReservations(overlapping, func(r models.Reservation) bool {
+		return r.Via == via && r.Direction == direction
+	})
+	return append(crossing, contenders(sameLane, capacity)...), nil
+}
+
+// releaseNode drops a mission's reservation on an intersection, if it holds one
+func releaseNode(
+	ctx RoutingContextInterface,
+	nodeID string,
+	missionID string,
+	vehicleID string,
+) error {
+	node, err := getNode(ctx, nodeID)
+	if err != nil {
+		return err
+	}
+	if node == nil || len(removeNodeReservations(node, byMission(missionID))) == 0 {
+		return nil
+	}
+
+	nodeJSON, err := writeNode(ctx, node)
+	if err != nil {
+		return err
+	}
+	ctx.RaiseEvent(models.EventNodeReleased, nodeJSON)
+	ctx.Audit(models.AuditEvent{
+		EventType: models.EventNodeReleased,
+		MissionID: missionID,
+		VehicleID: vehicleID,
+		Details:   map[string]interface{}{"nodeId": nodeID},
+	})
+
+	// Queued requests may have been waiting for the intersection rather than their segment
+	return (&SegmentContract{}).grantQueuedOn(ctx, nodeID)
+}
+
+// expireNodeReservations drops the expired reservations on an intersection, up to
+// what match allows, marks their missions stale and raises an event for each
+// The node is stored and its freed windows granted to the waitlists queued on it
+func expireNodeReservations(
+	ctx RoutingContextInterface,
+	node *models.Node,
+	match func(models.Reservation) bool,
+) ([]models.Reservation, error) {
+	expired := removeNodeReservations(node, match)
+	if len(expired) == 0 {
+		return nil, nil
+	}
+
+	missionContract := &MissionContract{}
+	for _, r := range expired {
+		reason := fmt.Sprintf("lease on node %s expired at %d without renewal", node.NodeID, r.LeaseExpiresAt)
+		err := missionContract.updateUnderwayMission(ctx, r.MissionID, func(mission *models.Mission) {
+			removeNode(mission, node.NodeID)
+			mission.Status = models.MissionStale
+			mission.StaleReason = reason
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		expiryEvent := map[string]interface{}{
+			"type":           models.EventReservationExpired,
+			"nodeId":         node.NodeID,
+			"missionId":      r.MissionID,
+			"vehicleId":      r.VehicleID,
+			"leaseExpiresAt": r.LeaseExpiresAt,
+			"reason":         reason,
+		}
+		eventJSON, _ := json.Marshal(expiryEvent)
+		ctx.RaiseEvent(models.EventReservationExpired, eventJSON)
+		ctx.Audit(models.AuditEvent{
+			EventType: models.EventReservationExpired,
+			MissionID: r.MissionID,
+			VehicleID: r.VehicleID,
+			Details: map[string]interface{}{
+				"nodeId":         node.NodeID,
+				"leaseExpiresAt": r.LeaseExpiresAt,
+			},
+		})
+	}
+
+	nodeJSON, err := writeNode(ctx, node)
+	if err != nil {
+		return nil, err
+	}
+	ctx.RaiseEvent(models.EventNodeReleased, nodeJSON)
+
+	return expired, (&SegmentContract{}).grantQueuedOn(ctx, node.NodeID)
+}
+
+// waitOnNode notes that a segment's waitlist has a request waiting for an intersection,
+// so that releasing the intersection retries it (see grantQueuedOn)
+func waitOnNode(ctx RoutingContextInterface, nodeID string, segmentID string) error {
+	if nodeID == "" {
+		return nil
+	}
+	node, err := getNode(ctx, nodeID)
+	if err != nil {
+		return err
+	}
+	if node == nil {
+		node = &models.Node{
+			DocType:      models.DocTypeNode,
+			NodeID:       nodeID,
+			Status:       models.StatusFree,
+			Reservations: []models.Reservation{},
+		}
+	}
+	for _, queued := range node.Queued {
+		if queued == segmentID {
+			return nil
+		}
+	}
+	node.Queued = append(node.Queued, segmentID)
+
+	_, err = writeNode(ctx, node)
+	return err
+}
+
+// nodesFree reports whether a mission can take intersection windows without
+// displacing anyone: no live reservation outside its convoy competes for them
+// (see nodeContenders)
+func nodesFree(ctx RoutingContextInterface, missionID string, windows []nodeWindow, now int64) (bool, error) {
+	for _, w := range windows {
+		node, err := getNode(ctx, w.nodeID)
+		if err != nil {
+			return false, err
+		}
+		if node == nil {
+			continue
+		}
+
+		live, _ := splitReservations(node.Reservations, expiredAt(now))
+		others, _ := splitReservations(live, byMission(missionID))
+		_, overlapping := splitReservations(others, inWindow(w.enterAt, w.exitAt))
+		overlapping, err = outsideConvoy(ctx, missionID, overlapping)
+		if err != nil {
+			return false, err
+		}
+		overlapping, err = nodeContenders(ctx, overlapping, w.via, w.direction)
+		if err != nil {
+			return false, err
+		}
+		if len(overlapping) > 0 {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// slotNodes returns the windows on the intersections at the ends of a step inserted
+// into a mission's path at slot: its entry is held from the step before it, its exit
+// until the step after it (see pathNodes)
+func slotNodes(mission *models.Mission, slot int, step models.PathSegment) ([]nodeWindow, error) {
+	local := []models.PathSegment{}
+	if slot > 0 {
+		local = append(local, mission.Steps[slot-1])
+	}
+	local = append(local, step)
+	if slot < len(mission.Steps) {
+		local = append(local, mission.Steps[slot])
+	}
+
+	windows, err := pathNodes(local)
+	if err != nil {
+		return nil, err
+	}
+	ends := []nodeWindow{}
+	for _, w := range windows {
+		if w.nodeID == step.FromNode || w.nodeID == step.ToNode {
+			ends = append(ends, w)
+		}
+	}
+	return ends, nil
+}
+
+// reserveNodes reserves the intersections along a path for a mission and releases
+// the ones it held that the path no longer crosses. mission.Nodes is updated;
+// the caller stores the mission
+func (c *MissionContract) reserveNodes(
+	ctx RoutingContextInterface,
+	mission *models.Mission,
+	vehicleID string,
+	priorityLevel int,
+	steps []models.PathSegment,
+) ([]*models.Conflict, error) {
+	windows, err := pathNodes(steps)
+	if err != nil {
+		return nil, err
+	}
+
+	segmentContract := &SegmentContract{}
+	conflicts := []*models.Conflict{}
+	nodes := []string{}
+	crossed := make(map[string]bool)
+	for _, w := range windows {
+		conflict, err := segmentContract.reserveNode(
+			ctx,
+			w.nodeID,
+			vehicleID,
+			mission.MissionID,
+			mission.OrgType,
+			priorityLevel,
+			w.enterAt,
+			w.exitAt,
+			w.via,
+			w.direction,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to reserve intersection %s: %v", w.nodeID, err)
+		}
+		if conflict != nil {
+			conflicts = append(conflicts, conflict)
+		}
+		nodes = append(nodes, w.nodeID)
+		crossed[w.nodeID] = true
+	}
+
+	if _, err := releaseNodesExcept(ctx, mission, crossed); err != nil {
+		return nil, err
+	}
+	mission.Nodes = nodes
+
+	return conflicts, nil
+}
+
+// releaseNodes drops every intersection reservation held by a mission
+func releaseNodes(ctx RoutingContextInterface, mission *models.Mission) error {
+	for _, nodeID := range mission.Nodes {
+		if err := releaseNode(ctx, nodeID, mission.MissionID, mission.VehicleID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// releaseNodesExcept releases the intersections a mission holds that are not in keep
+// and drops them from mission.Nodes; the caller stores the mission. Returns the released nodes
+func releaseNodesExcept(ctx RoutingContextInterface, mission *models.Mission, keep map[string]bool) ([]string, error) {
+	kept := []string{}
+	released := []string{}
+	for _, nodeID := range mission.Nodes {
+		if keep[nodeID] {
+			kept = append(kept, nodeID)
+			continue
+		}
+		if err := releaseNode(ctx, nodeID, mission.MissionID, mission.VehicleID); err != nil {
+			return nil, err
+		}
+		released = append(released, nodeID)
+	}
+	mission.Nodes = kept
+	return released, nil
+}
+
+// stepNodes returns the endpoints of path steps
+func stepNodes(steps []models.PathSegment) map[string]bool {
+	nodes := make(map[string]bool)
+	for _, step := range steps {
+		nodes[step.FromNode] = true
+		nodes[step.ToNode] = true
+	}
+	return nodes
+}
+
+// setNodePriority applies a new priority to a mission's reservations on the
+// intersections it holds. Returns the nodes updated
+func setNodePriority(ctx RoutingContextInterface, mission *models.Mission, priorityLevel int) ([]string, error) {
+	updated := []string{}
+	for _, nodeID := range mission.Nodes {
+		node, err := getNode(ctx, nodeID)
+		if err != nil {
+			return nil, err
+		}
+		if node == nil {
+			continue
+		}
+
+		held := false
+		for i := range node.Reservations {
+			if node.Reservations[i].MissionID == mission.MissionID {
+				node.Reservations[i].PriorityLevel = priorityLevel
+				held = true
+			}
+		}
+		if !held {
+			continue
+		}
+		if _, err := writeNode(ctx, node); err != nil {
+			return nil, err
+		}
+		updated = append(updated, nodeID)
+	}
+	return updated, nil
+}
+
+// renewNodeLease extends the lease of a mission's reservation on an intersection
+func renewNodeLease(
+	ctx RoutingContextInterface,
+	nodeID string,
+	missionID string,
+	leaseExpiresAt int64,
+	now int64,
+) error {
+	node, err := getNode(ctx, nodeID)
+	if err != nil || node == nil {
+		return err
+	}
+
+	expired := removeNodeReservations(node, expiredAt(now))
+	renewed := false
+	for i := range node.Reservations {
+		if node.Reservations[i].MissionID == missionID {
+			node.Reservations[i].LeaseExpiresAt = leaseExpiresAt
+			renewed = true
+		}
+	}
+	if !renewed && len(expired) == 0 {
+		return nil
+	}
+
+	_, err = writeNode(ctx, node)
+	return err
+}
+
+// pathNodes lists the intersections a path crosses, from the start of its first
+// segment to the end of its last one, each with the window the vehicle holds it:
+// from entering the segment leading to the node until leaving the one after it.
+// Every step must give both endpoints and start where the previous one ended;
+// a node crossed twice is held for both passes
+func pathNodes(steps []models.PathSegment) ([]nodeWindow, error) {
+	windows := []nodeWindow{}
+	index := make(map[string]int)
+	add := func(nodeID string, enterAt int64, exitAt int64, via models.PathSegment) {
+		i, seen := index[nodeID]
+		if !seen {
+			index[nodeID] = len(windows)
+			windows = append(windows, nodeWindow{nodeID: nodeID, enterAt: enterAt, exitAt: exitAt, via: via.SegmentID, direction: via.FromNode})
+			return
+		}
+		// Widen the window to cover both passes, keeping the first lane
+		if enterAt < windows[i].enterAt {
+			windows[i].enterAt = enterAt
+		}
+		if windows[i].exitAt != 0 && (exitAt == 0 || exitAt > windows[i].exitAt) {
+			windows[i].exitAt = exitAt
+		}
+	}
+
+	for i, step := range steps {
+		if step.FromNode == "" || step.ToNode == "" {
+			return nil, fmt.Errorf("segment %s needs both fromNode and toNode", step.SegmentID)
+		}
+		if i == 0 {
+			add(step.FromNode, step.EnterAt, step.ExitAt, step)
+		} else if step.FromNode != steps[i-1].ToNode {
+			return nil, fmt.Errorf("path is not continuous: segment %s starts at %s, not %s", step.SegmentID, step.FromNode, steps[i-1].ToNode)
+		}
+
+		exitAt := step.ExitAt
+		if i+1 < len(steps) {
+			exitAt = steps[i+1].ExitAt
+		}
+		add(step.ToNode, step.EnterAt, exitAt, step)
+	}
+
+	return windows, nil
+}
+
+// enforceNodeResolution applies a conflict resolution to the contested intersection
+// (see ResolveConflict) and flags the losing mission(s) for reroute
+func (c *SegmentContract) enforceNodeResolution(
+	ctx RoutingContextInterface,
+	conflict *models.Conflict,
+	mission1 *models.Mission,
+	mission2 *models.Mission,
+	resolution string,
+	now int64,
+) error {
+	node, err := getNode(ctx, conflict.NodeID)
+	if err != nil {
+		return err
+	}
+	if node == nil {
+		return fmt.Errorf("intersection %s does not exist", conflict.NodeID)
+	}
+	removeNodeReservations(node, expiredAt(now))
+
+	missionContract := &MissionContract{}
+	switch resolution {
+	case models.ResolutionMission1Wins:
+		return missionContract.markPreempted(ctx, mission2.MissionID, models.PreemptedSegment{
+			NodeID:        conflict.NodeID,
+			ByMissionID:   mission1.MissionID,
+			ByVehicleID:   mission1.VehicleID,
+			PriorityLevel: conflict.Priority1,
+			PreemptedAt:   now,
+		})
+
+	case models.ResolutionMission2Wins:
+		enterAt, exitAt, err := normalizeWindow(conflict.EnterAt, conflict.ExitAt, now)
+		if err != nil {
+			return err
+		}
+		removeNodeReservations(node, func(r models.Reservation) bool {
+			return r.MissionID == mission1.MissionID && windowsOverlap(r.EnterAt, r.ExitAt, enterAt, exitAt)
+		})
+		removeNodeReservations(node, byMission(mission2.MissionID))
+		_, overlapping := splitReservations(node.Reservations, inWindow(enterAt, exitAt))
+		overlapping, err = nodeContenders(ctx, overlapping, conflict.Via, conflict.Direction)
+		if err != nil {
+			return err
+		}
+		if len(overlapping) > 0 {
+			return fmt.Errorf("intersection %s window is no longer available to mission %s", conflict.NodeID, mission2.MissionID)
+		}
+		node.Reservations = append(node.Reservations, models.Reservation{
+			MissionID:     mission2.MissionID,
+			VehicleID:     mission2.VehicleID,
+			OrgType:       mission2.OrgType,
+			PriorityLevel: conflict.Priority2,
+			Status:        models.StatusReserved,
+			EnterAt:       enterAt,
+			ExitAt:        exitAt,
+			ReservedAt:    now,
+
+			LeaseExpiresAt: now + reservationLeaseSeconds,
+			Direction:      conflict.Direction,
+			Via:            conflict.Via,
+		})
+		nodeJSON, err := writeNode(ctx, node)
+		if err != nil {
+			return err
+		}
+		ctx.RaiseEvent(models.EventNodeReserved, nodeJSON)
+
+		return missionContract.markPreempted(ctx, mission1.MissionID, models.PreemptedSegment{
+			NodeID:        conflict.NodeID,
+			ByMissionID:   mission2.MissionID,
+			ByVehicleID:   mission2.VehicleID,
+			PriorityLevel: conflict.Priority2,
+			PreemptedAt:   now,
+		})
+
+	case models.ResolutionBothReroute:
+		removeNodeReservations(node, byMission(mission1.MissionID))
+		removeNodeReservations(node, byMission(mission2.MissionID))
+		nodeJSON, err := writeNode(ctx, node)
+		if err != nil {
+			return err
+		}
+		ctx.RaiseEvent(models.EventNodeReleased, nodeJSON)
+
+		for _, missionID := range []string{mission1.MissionID, mission2.MissionID} {
+			err = missionContract.markPreempted(ctx, missionID, models.PreemptedSegment{
+				NodeID:      conflict.NodeID,
+				PreemptedAt: now,
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return c.grantQueuedOn(ctx, conflict.NodeID)
+	}
+
+	return nil
+}
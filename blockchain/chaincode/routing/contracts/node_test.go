@@ -0,0 +1,222 @@
+package contracts
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/emergency-routing/chaincode/routing/models"
+)
+
+// holders lists the missions holding an intersection
+func (l *ledger) holders(nodeID string) []string {
+	l.t.Helper()
+
+	missions := []string{}
+	for _, reservation := range l.node(nodeID).Reservations {
+		missions = append(missions, reservation.MissionID)
+	}
+	return missions
+}
+
+func TestActivateMissionRejectsBrokenPaths(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		path string
+		want string
+	}{
+		{"no endpoints", `["S1","S2"]`, "needs both fromNode and toNode"},
+		{"wrong origin", `[{"segmentId":"S1","fromNode":"X","toNode":"B"},{"segmentId":"S2","fromNode":"B","toNode":"C"}]`, "path starts at X, not A"},
+		{"wrong destination", `[{"segmentId":"S1","fromNode":"A","toNode":"B"}]`, "path ends at B, not C"},
+		{"gap", `[{"segmentId":"S1","fromNode":"A","toNode":"B"},{"segmentId":"S2","fromNode":"X","toNode":"C"}]`, "path is not continuous"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			l := newLedger(t)
+			l.registerVehicle(medicalDispatcher, "AMB-1", "medical", "ambulance", 2)
+			l.mustInvoke(medicalDispatcher, "MissionContract:CreateMission", "M1", "AMB-1", "A", "C", "high", "")
+			l.mustFail(medicalDispatcher, tc.want, "MissionContract:ActivateMission", "M1", tc.path)
+		})
+	}
+}
+
+func TestAdvanceMissionReleasesNodesBehind(t *testing.T) {
+	l := newLedger(t)
+	l.registerVehicle(medicalDispatcher, "AMB-1", "medical", "ambulance", 2)
+	l.startMission(medicalDispatcher, "M1", "AMB-1", "A", "D", "high",
+		`[{"segmentId":"S1","fromNode":"A","toNode":"B"},{"segmentId":"S2","fromNode":"B","toNode":"C"},{"segmentId":"S3","fromNode":"C","toNode":"D"}]`)
+
+	l.mustInvoke(driver("MedicalMSP", "AMB-1"), "MissionContract:AdvanceMission", "M1", "S2")
+
+	if holders := l.holders("A"); len(holders) != 0 {
+		t.Fatalf("A is behind M1 but held by %v", holders)
+	}
+	for _, nodeID := range []string{"B", "C", "D"} {
+		if holders := l.holders(nodeID); len(holders) != 1 || holders[0] != "M1" {
+			t.Fatalf("%s is ahead of M1 but held by %v", nodeID, holders)
+		}
+	}
+	if nodes := l.mission("M1").Nodes; len(nodes) != 3 {
+		t.Fatalf("M1 should hold B, C and D, got %v", nodes)
+	}
+}
+
+func TestReachWaypointReleasesLegNodes(t *testing.T) {
+	l := newLedger(t)
+	l.registerVehicle(medicalDispatcher, "AMB-1", "medical", "ambulance", 2)
+	l.mustInvoke(medicalDispatcher, "MissionContract:CreateMultiStopMission", "M1", "AMB-1", "A", `["B","C"]`, "high", "")
+	l.mustInvoke(medicalDispatcher, "MissionContract:ActivateMission", "M1",
+		`[[{"segmentId":"S1","fromNode":"A","toNode":"B"}],[{"segmentId":"S2","fromNode":"B","toNode":"C"}]]`)
+
+	l.mustInvoke(driver("MedicalMSP", "AMB-1"), "MissionContract:ReachWaypoint", "M1", "B")
+
+	if holders := l.holders("A"); len(holders) != 0 {
+		t.Fatalf("A is on the finished leg but held by %v", holders)
+	}
+	for _, nodeID := range []string{"B", "C"} {
+		if holders := l.holders(nodeID); len(holders) != 1 || holders[0] != "M1" {
+			t.Fatalf("%s is on the next leg but held by %v", nodeID, holders)
+		}
+	}
+}
+
+func TestUpdateMissionPriorityUpdatesNodes(t *testing.T) {
+	l := newLedger(t)
+	l.registerVehicle(medicalDispatcher, "AMB-1", "medical", "ambulance", 2)
+	l.startMission(medicalDispatcher, "M1", "AMB-1", "A", "B", "high", `[{"segmentId":"S1","fromNode":"A","toNode":"B"}]`)
+
+	l.mustInvoke(medicalDispatcher, "MissionContract:UpdateMissionPriority", "M1", models.SeverityCritical, "incident reassessed")
+
+	priority := l.mission("M1").PriorityLevel
+	for _, nodeID := range []string{"A", "B"} {
+		reservations := l.node(nodeID).Reservations
+		if len(reservations) != 1 || reservations[0].PriorityLevel != priority {
+			t.Fatalf("%s should be held by M1 at priority %d, got %+v", nodeID, priority, reservations)
+		}
+	}
+}
+
+func TestConvoyEscortFollowsLeadSteps(t *testing.T) {
+	l := newLedger(t)
+	l.registerVehicle(medicalDispatcher, "AMB-1", "medical", "ambulance", 2)
+	l.registerVehicle(medicalDispatcher, "AMB-2", "medical", "ambulance", 2)
+	l.startMission(medicalDispatcher, "M1", "AMB-1", "A", "C", "high",
+		`[{"segmentId":"S1","fromNode":"A","toNode":"B"},{"segmentId":"S2","fromNode":"B","toNode":"C"}]`)
+	l.mustInvoke(medicalDispatcher, "MissionContract:CreateMission", "M2", "AMB-2", "A", "C", "high", "")
+
+	l.mustInvoke(medicalDispatcher, "MissionContract:ProposeConvoy", "M2", "M1")
+
+	escort := l.mission("M2")
+	if escort.Status != models.MissionActive {
+		t.Fatalf("M2 is %s, want %s", escort.Status, models.MissionActive)
+	}
+	if len(escort.Steps) != 2 || escort.Steps[1].FromNode != "B" || escort.Steps[1].ToNode != "C" {
+		t.Fatalf("M2 should follow M1's steps, got %+v", escort.Steps)
+	}
+	for _, nodeID := range []string{"A", "B", "C"} {
+		if holders := l.holders(nodeID); len(holders) != 2 {
+			t.Fatalf("%s should be held by both convoy missions, got %v", nodeID, holders)
+		}
+	}
+
+	// Completing the lead closes the escort and frees its intersections too
+	l.mustInvoke(medicalDispatcher, "MissionContract:CompleteMission", "M1")
+	for _, nodeID := range []string{"A", "B", "C"} {
+		if holders := l.holders(nodeID); len(holders) != 0 {
+			t.Fatalf("%s still held by %v after the convoy ended", nodeID, holders)
+		}
+	}
+}
+
+func TestLeadRouteChangeUnlinksEscorts(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		change func(l *ledger)
+	}{
+		{"reroute", func(l *ledger) {
+			l.mustInvoke(medicalDispatcher, "MissionContract:UpdateMissionPath", "M1",
+				`[{"segmentId":"S1","fromNode":"A","toNode":"B"},{"segmentId":"S9","fromNode":"B","toNode":"C"}]`)
+		}},
+		{"handoff", func(l *ledger) {
+			l.mustInvoke(medicalDispatcher, "MissionContract:HandoffMission", "M1", "AMB-3", `[{"segmentId":"S2","fromNode":"B","toNode":"C"}]`)
+		}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			l := newLedger(t)
+			l.registerVehicle(medicalDispatcher, "AMB-1", "medical", "ambulance", 2)
+			l.registerVehicle(medicalDispatcher, "AMB-2", "medical", "ambulance", 2)
+			l.registerVehicle(medicalDispatcher, "AMB-3", "medical", "ambulance", 2)
+			l.startMission(medicalDispatcher, "M1", "AMB-1", "A", "C", "high",
+				`[{"segmentId":"S1","fromNode":"A","toNode":"B"},{"segmentId":"S2","fromNode":"B","toNode":"C"}]`)
+			l.mustInvoke(medicalDispatcher, "MissionContract:CreateMission", "M2", "AMB-2", "A", "C", "high", "")
+			l.mustInvoke(medicalDispatcher, "MissionContract:ProposeConvoy", "M2", "M1")
+
+			tc.change(l)
+
+			if !strings.Contains(string(l.stub.event), models.EventConvoyUnlinked) {
+				t.Fatalf("no %s event raised: %s", models.EventConvoyUnlinked, l.stub.event)
+			}
+			if members := l.mission("M1").ConvoyMembers; len(members) != 0 {
+				t.Fatalf("M1 still leads %v", members)
+			}
+			escort := l.mission("M2")
+			if escort.Convoy != nil || escort.Status != models.MissionActive {
+				t.Fatalf("M2 should go on alone, got %s with %+v", escort.Status, escort.Convoy)
+			}
+		})
+	}
+}
+
+func TestSameLaneSharesNodesUpToCapacity(t *testing.T) {
+	l := newLedger(t)
+	l.mustInvoke(trafficAuthority, "SegmentContract:SetSegmentCapacity", "S1", "2")
+	l.registerVehicle(medicalDispatcher, "AMB-1", "medical", "ambulance", 2)
+	l.registerVehicle(medicalDispatcher, "AMB-2", "medical", "ambulance", 2)
+	l.startMission(medicalDispatcher, "M1", "AMB-1", "A", "B", "high", `[{"segmentId":"S1","fromNode":"A","toNode":"B"}]`)
+	l.startMission(medicalDispatcher, "M2", "AMB-2", "A", "B", "critical", `[{"segmentId":"S1","fromNode":"A","toNode":"B"}]`)
+
+	m1 := l.mission("M1")
+	if m1.Status != models.MissionActive || len(m1.PreemptedSegments) != 0 {
+		t.Fatalf("M1 fits in S1's second lane but is %s, preempted on %+v", m1.Status, m1.PreemptedSegments)
+	}
+	for _, nodeID := range []string{"A", "B"} {
+		if holders := l.holders(nodeID); len(holders) != 2 {
+			t.Fatalf("%s should be shared by both missions in S1's lanes, got %v", nodeID, holders)
+		}
+	}
+
+	// A third vehicle in the same lane still has to displace the weakest
+	l.registerVehicle(medicalDispatcher, "AMB-3", "medical", "ambulance", 2)
+	l.startMission(medicalDispatcher, "M3", "AMB-3", "A", "B", "critical", `[{"segmentId":"S1","fromNode":"A","toNode":"B"}]`)
+	if status := l.mission("M1").Status; status != models.MissionNeedsReroute {
+		t.Fatalf("M1 is the weakest of three in two lanes but is %s", status)
+	}
+}
+
+func TestSweepReleasesExpiredNodes(t *testing.T) {
+	l := newLedger(t)
+	l.registerVehicle(medicalDispatcher, "AMB-1", "medical", "ambulance", 2)
+	l.startMission(medicalDispatcher, "M1", "AMB-1", "A", "B", "high", `[{"segmentId":"S1","fromNode":"A","toNode":"B"}]`)
+	l.now += reservationLeaseSeconds + 1
+
+	// S1, then A and B
+	if got := l.mustInvoke(medicalDispatcher, "SegmentContract:SweepExpiredReservations", "10"); got != "3" {
+		t.Fatalf("sweep released %s reservations, want 3", got)
+	}
+	for _, nodeID := range []string{"A", "B"} {
+		if holders := l.holders(nodeID); len(holders) != 0 {
+			t.Fatalf("%s is still held by %v after its lease ran out", nodeID, holders)
+		}
+	}
+	if mission := l.mission("M1"); mission.Status != models.MissionStale || len(mission.Nodes) != 0 {
+		t.Fatalf("M1 should be stale without nodes, got %s holding %v", mission.Status, mission.Nodes)
+	}
+
+	// A stale mission still ties up its vehicle
+	var active models.Mission
+	if err := json.Unmarshal([]byte(l.mustInvoke(medicalDispatcher, "MissionContract:GetVehicleActiveMission", "AMB-1")), &active); err != nil {
+		t.Fatalf("failed to decode the active mission: %v", err)
+	}
+	if active.MissionID != "M1" {
+		t.Fatalf("AMB-1 should still be on M1, got %q", active.MissionID)
+	}
+}
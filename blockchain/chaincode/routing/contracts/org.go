@@ -0,0 +1,356 @@
+package contracts
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/emergency-routing/chaincode/routing/models"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// OrgContract manages the on-ledger organization registry
+type OrgContract struct {
+	contractapi.Contract
+}
+
+// NewOrgContract returns an OrgContract using the routing context
+func NewOrgContract() *OrgContract {
+	return &OrgContract{Contract: newRoutingContract("OrgContract")}
+}
+
+// defaultOrganizations is the registry seeded when InitOrgRegistry gets no orgs
+// It matches the two organizations of the original network
+func defaultOrganizations() []models.Organization {
+	return []models.Organization{
+		{
+			MSPID:               "MedicalMSP",
+			OrgType:             "medical",
+			AllowedVehicleTypes: []string{"ambulance", "paramedic_unit", "air_ambulance", "mobile_clinic"},
+			MaxPriorityLevel:    1,
+			Enabled:             true,
+			Admin:               true,
+		},
+		{
+			MSPID:               "PoliceMSP",
+			OrgType:             "police",
+			AllowedVehicleTypes: []string{"patrol", "patrol_car", "motorcycle", "suv", "tactical_vehicle", "k9_unit"},
+			MaxPriorityLevel:    1,
+			Enabled:             true,
+			Admin:               true,
+		},
+	}
+}
+
+// InitOrgRegistry bootstraps the registry. It can only run once, on an empty registry
+// orgsJSON is a JSON array of organizations; an empty string seeds the defaults
+// The caller must be an enabled admin org of the new registry so it cannot lock itself out
+func (c *OrgContract) InitOrgRegistry(
+	ctx RoutingContextInterface,
+	orgsJSON string,
+) error {
+	existing, err := c.GetAllOrganizations(ctx)
+	if err != nil {
+		return err
+	}
+	if len(existing) > 0 {
+		return fmt.Errorf("organization registry is already initialized")
+	}
+
+	orgs := defaultOrganizations()
+	if orgsJSON != "" {
+		orgs = nil
+		if err := json.Unmarshal([]byte(orgsJSON), &orgs); err != nil {
+			return fmt.Errorf("invalid organizations JSON: %v", err)
+		}
+	}
+	if len(orgs) == 0 {
+		return fmt.Errorf("at least one organization is required")
+	}
+
+	mspID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return fmt.Errorf("failed to get MSP ID: %v", err)
+	}
+
+	seen := map[string]bool{}
+	callerIsAdmin := false
+	for i := range orgs {
+		if err := validateOrganization(&orgs[i]); err != nil {
+			return err
+		}
+		if seen[orgs[i].MSPID] {
+			return fmt.Errorf("duplicate organization %s", orgs[i].MSPID)
+		}
+		seen[orgs[i].MSPID] = true
+		if orgs[i].MSPID == mspID && orgs[i].Admin && orgs[i].Enabled {
+			callerIsAdmin = true
+		}
+	}
+	if !callerIsAdmin {
+		return fmt.Errorf("access denied: %s must be an enabled admin organization of the new registry", mspID)
+	}
+
+	for i := range orgs {
+		if err := c.putOrganization(ctx, &orgs[i], mspID, models.EventOrgRegistered); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// RegisterOrganization adds a new organization to the registry (admin only)
+func (c *OrgContract) RegisterOrganization(
+	ctx RoutingContextInterface,
+	orgJSON string,
+) error {
+	admin, err := requireRegistryAdmin(ctx)
+	if err != nil {
+		return err
+	}
+
+	var org models.Organization
+	if err := json.Unmarshal([]byte(orgJSON), &org); err != nil {
+		return fmt.Errorf("invalid organization JSON: %v", err)
+	}
+	if err := validateOrganization(&org); err != nil {
+		return err
+	}
+
+	existing, err := getOrganization(ctx, org.MSPID)
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		return fmt.Errorf("organization %s already exists", org.MSPID)
+	}
+
+	return c.putOrganization(ctx, &org, admin.MSPID, models.EventOrgRegistered)
+}
+
+// UpdateOrganization replaces an existing organization entry (admin only)
+// An admin org cannot disable itself or drop its own admin flag
+func (c *OrgContract) UpdateOrganization(
+	ctx RoutingContextInterface,
+	orgJSON string,
+) error {
+	admin, err := requireRegistryAdmin(ctx)
+	if err != nil {
+		return err
+	}
+
+	var org models.Organization
+	if err := json.Unmarshal([]byte(orgJSON), &org); err != nil {
+		return fmt.Errorf("invalid organization JSON: %v", err)
+	}
+	if err := validateOrganization(&org); err != nil {
+		return err
+	}
+
+	existing, err := getOrganization(ctx, org.MSPID)
+	if err != nil {
+		return err
+	}
+	if existing == nil {
+		return fmt.Errorf("organization %s does not exist", org.MSPID)
+	}
+	if org.MSPID == admin.MSPID && (!org.Enabled || !org.Admin) {
+		return fmt.Errorf("organization %s cannot revoke its own admin access", org.MSPID)
+	}
+
+	return c.putOrganization(ctx, &org, admin.MSPID, models.EventOrgUpdated)
+}
+
+// SetOrganizationEnabled enables or disables an organization (admin only)
+func (c *OrgContract) SetOrganizationEnabled(
+	ctx RoutingContextInterface,
+	mspID string,
+	enabled bool,
+) error {
+	admin, err := requireRegistryAdmin(ctx)
+	if err != nil {
+		return err
+	}
+
+	org, err := c.GetOrganization(ctx, mspID)
+	if err != nil {
+		return err
+	}
+	if mspID == admin.MSPID && !enabled {
+		return fmt.Errorf("organization %s cannot revoke its own admin access", mspID)
+	}
+
+	org.Enabled = enabled
+	return c.putOrganization(ctx, org, admin.MSPID, models.EventOrgUpdated)
+}
+
+// GetOrganization retrieves a registry entry by MSP ID
+func (c *OrgContract) GetOrganization(
+	ctx RoutingContextInterface,
+	mspID string,
+) (*models.Organization, error) {
+	org, err := getOrganization(ctx, mspID)
+	if err != nil {
+		return nil, err
+	}
+	if org == nil {
+		return nil, fmt.Errorf("organization %s does not exist", mspID)
+	}
+	return org, nil
+}
+
+// GetAllOrganizations retrieves every registry entry
+// Uses the composite key namespace rather than a rich query so it works on LevelDB too
+func (c *OrgContract) GetAllOrganizations(
+	ctx RoutingContextInterface,
+) ([]*models.Organization, error) {
+	return getAllOrganizations(ctx)
+}
+
+// putOrganization stamps, stores and announces a registry entry
+func (c *OrgContract) putOrganization(
+	ctx RoutingContextInterface,
+	org *models.Organization,
+	updatedBy string,
+	eventType string,
+) error {
+	now, err := txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+	org.DocType = models.DocTypeOrg
+	org.UpdatedBy = updatedBy
+	org.UpdatedAt = now
+
+	orgJSON, err := json.Marshal(org)
+	if err != nil {
+		return fmt.Errorf("failed to marshal organization: %v", err)
+	}
+
+	err = putEntityState(ctx, orgObjectType, org.MSPID, orgJSON)
+	if err != nil {
+		return fmt.Errorf("failed to write state: %v", err)
+	}
+
+	ctx.RaiseEvent(eventType, orgJSON)
+	ctx.Audit(models.AuditEvent{
+		EventType:  eventType,
+		EntityType: models.DocTypeOrg,
+		EntityID:   org.MSPID,
+		Details: map[string]interface{}{
+			"mspId":   org.MSPID,
+			"orgType": org.OrgType,
+			"enabled": org.Enabled,
+			"admin":   org.Admin,
+		},
+	})
+
+	return nil
+}
+
+// validateOrganization checks a registry entry supplied by a caller
+func validateOrganization(org *models.Organization) error {
+	if org.MSPID == "" {
+		return fmt.Errorf("organization MSP ID cannot be empty")
+	}
+	if org.OrgType == "" {
+		return fmt.Errorf("organization %s must have an org type", org.MSPID)
+	}
+	if org.MaxPriorityLevel < 1 || org.MaxPriorityLevel > 5 {
+		return fmt.Errorf("organization %s max priority level must be between 1 and 5", org.MSPID)
+	}
+	if org.AllowedVehicleTypes == nil {
+		org.AllowedVehicleTypes = []string{}
+	}
+	return nil
+}
+
+// getAllOrganizations reads every registry entry
+func getAllOrganizations(ctx RoutingContextInterface) ([]*models.Organization, error) {
+	orgs, err := getAllEntities[models.Organization](ctx, orgObjectType)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query organizations: %v", err)
+	}
+
+	return orgs, nil
+}
+
+// getOrganization reads a registry entry (nil if absent)
+func getOrganization(ctx RoutingContextInterface, mspID string) (*models.Organization, error) {
+	orgJSON, err := getEntityState(ctx, orgObjectType, mspID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read state: %v", err)
+	}
+	if orgJSON == nil {
+		return nil, nil
+	}
+
+	var org models.Organization
+	err = json.Unmarshal(orgJSON, &org)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal organization: %v", err)
+	}
+	if err := checkDocType(mspID, org.DocType, models.DocTypeOrg); err != nil {
+		return nil, err
+	}
+
+	return &org, nil
+}
+
+// resolveCallerOrg maps the caller's MSP ID to its registry entry
+// This is the only place callers are mapped to an org; disabled orgs are rejected
+func resolveCallerOrg(ctx RoutingContextInterface) (*models.Organization, error) {
+	mspID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get MSP ID: %v", err)
+	}
+
+	org, err := getOrganization(ctx, mspID)
+	if err != nil {
+		return nil, err
+	}
+	if org == nil {
+		return nil, fmt.Errorf("unknown organization: %s", mspID)
+	}
+	if !org.Enabled {
+		return nil, fmt.Errorf("organization %s is disabled", mspID)
+	}
+
+	return org, nil
+}
+
+// requireRegistryAdmin resolves the caller and requires it to be a registry admin
+func requireRegistryAdmin(ctx RoutingContextInterface) (*models.Organization, error) {
+	org, err := resolveCallerOrg(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !org.Admin {
+		return nil, fmt.Errorf("access denied: %s is not a registry admin", org.MSPID)
+	}
+	return org, nil
+}
+
+// checkPriorityAllowed rejects a priority level above the org's maximum
+func checkPriorityAllowed(org *models.Organization, priorityLevel int) error {
+	if priorityLevel < org.MaxPriorityLevel {
+		return fmt.Errorf("priority level %d exceeds the maximum allowed for %s (%d)", priorityLevel, org.MSPID, org.MaxPriorityLevel)
+	}
+	return nil
+}
+
+// checkVehicleAllowed checks a vehicle type and priority level against the org's limits
+func checkVehicleAllowed(org *models.Organization, vehicleType string, priorityLevel int) error {
+	if err := checkPriorityAllowed(org, priorityLevel); err != nil {
+		return err
+	}
+	if vehicleType == "" || len(org.AllowedVehicleTypes) == 0 {
+		return nil
+	}
+	for _, allowed := range org.AllowedVehicleTypes {
+		if allowed == vehicleType {
+			return nil
+		}
+	}
+	return fmt.Errorf("vehicle type %s is not allowed for %s", vehicleType, org.MSPID)
+}
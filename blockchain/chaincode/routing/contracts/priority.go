@@ -0,0 +1,60 @@
+package contracts
+
+import (
+	"fmt"
+
+	"github.com/emergency-routing/chaincode/routing/models"
+)
+
+// defaultPriorityPolicy maps an incident severity to a reservation priority (1 = highest)
+// for vehicle types without their own entry in priorityPolicy
+var defaultPriorityPolicy = map[string]int{
+	models.SeverityCritical: 1,
+	models.SeverityHigh:     2,
+	models.SeverityMedium:   3,
+	models.SeverityLow:      5,
+}
+
+// priorityPolicy holds the vehicle types whose priority differs from the default
+// Support units never reach the top level, even on a critical incident
+var priorityPolicy = map[string]map[string]int{
+	"mobile_clinic": {
+		models.SeverityCritical: 2,
+		models.SeverityHigh:     3,
+		models.SeverityMedium:   4,
+		models.SeverityLow:      5,
+	},
+	"k9_unit": {
+		models.SeverityCritical: 2,
+		models.SeverityHigh:     3,
+		models.SeverityMedium:   4,
+		models.SeverityLow:      5,
+	},
+}
+
+// effectivePriority returns the reservation priority of a mission from the policy table
+// The result is capped at the org's maximum priority rather than rejected
+func effectivePriority(org *models.Organization, vehicleType string, severity string) (int, error) {
+	if err := checkSeverity(severity); err != nil {
+		return 0, err
+	}
+
+	levels, ok := priorityPolicy[vehicleType]
+	if !ok {
+		levels = defaultPriorityPolicy
+	}
+	priority := levels[severity]
+	if priority < org.MaxPriorityLevel {
+		priority = org.MaxPriorityLevel
+	}
+	return priority, nil
+}
+
+// checkSeverity rejects anything but a known incident severity
+func checkSeverity(severity string) error {
+	switch severity {
+	case models.SeverityCritical, models.SeverityHigh, models.SeverityMedium, models.SeverityLow:
+		return nil
+	}
+	return fmt.Errorf("invalid severity: %s", severity)
+}
@@ -0,0 +1,85 @@
+package contracts
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+)
+
+// maxPageSize caps the page size of paginated queries
+const maxPageSize = 1000
+
+// resultPage is one page of decoded query results
+type resultPage[T any] struct {
+	records      []*T
+	bookmark     string
+	fetchedCount int32
+}
+
+// decodeResults reads every document from a query iterator and closes it
+// Returns an empty (not nil) slice when there are no results
+func decodeResults[T any](resultsIterator shim.StateQueryIteratorInterface) ([]*T, error) {
+	defer resultsIterator.Close()
+
+	results := []*T{}
+	for resultsIterator.HasNext() {
+		queryResult, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		var result T
+		err = json.Unmarshal(queryResult.Value, &result)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, &result)
+	}
+
+	return results, nil
+}
+
+// getAllEntities reads every document of an entity namespace in ID order
+func getAllEntities[T any](ctx RoutingContextInterface, objectType string) ([]*T, error) {
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(objectType, []string{})
+	if err != nil {
+		return nil, err
+	}
+	return decodeResults[T](resultsIterator)
+}
+
+// rangePage reads one page of an entity's composite key namespace in ID order
+func rangePage[T any](
+	ctx RoutingContextInterface,
+	objectType string,
+	pageSize int32,
+	bookmark string,
+) (*resultPage[T], error) {
+	if err := checkPageSize(pageSize); err != nil {
+		return nil, err
+	}
+
+	resultsIterator, metadata, err := ctx.GetStub().GetStateByPartialCompositeKeyWithPagination(objectType, []string{}, pageSize, bookmark)
+	if err != nil {
+		return nil, err
+	}
+	records, err := decodeResults[T](resultsIterator)
+	if err != nil {
+		return nil, err
+	}
+
+	return &resultPage[T]{
+		records:      records,
+		bookmark:     metadata.GetBookmark(),
+		fetchedCount: metadata.GetFetchedRecordsCount(),
+	}, nil
+}
+
+// checkPageSize rejects page sizes outside 1..maxPageSize
+func checkPageSize(pageSize int32) error {
+	if pageSize < 1 || pageSize > maxPageSize {
+		return fmt.Errorf("page size must be between 1 and %d", maxPageSize)
+	}
+	return nil
+}
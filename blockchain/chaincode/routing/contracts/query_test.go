@@ -0,0 +1,132 @@
+package contracts
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/emergency-routing/chaincode/routing/models"
+)
+
+// injected are filter values crafted to widen a query if they were spliced into one
+var injected = []string{
+	`active","$or":[{}],"status":"`,
+	`{"$ne":""}`,
+	`{"$regex":".*"}`,
+	"reserved\x00",
+	"",
+}
+
+func TestListQueriesRejectInjectedFilters(t *testing.T) {
+	l := newLedger(t)
+
+	for _, fn := range []string{
+		"MissionContract:GetMissionsByStatus",
+		"SegmentContract:GetSegmentsByStatus",
+	} {
+		for _, value := range injected {
+			l.mustFail(medicalDispatcher, "invalid", fn, value)
+		}
+	}
+	for _, fn := range []string{
+		"MissionContract:GetMissionsByOrg",
+		"VehicleContract:GetVehiclesByOrg",
+	} {
+		for _, value := range injected {
+			l.mustFail(medicalDispatcher, "invalid org type", fn, value)
+		}
+	}
+
+	l.mustInvoke(medicalDispatcher, "MissionContract:GetMissionsByStatus", "active")
+	l.mustInvoke(medicalDispatcher, "SegmentContract:GetSegmentsByStatus", "reserved")
+	l.mustInvoke(medicalDispatcher, "MissionContract:GetMissionsByOrg", "police")
+	l.mustInvoke(medicalDispatcher, "VehicleContract:GetVehiclesByOrg", "medical")
+}
+
+func TestAuditFiltersMatchLiterally(t *testing.T) {
+	l := newLedger(t)
+	l.registerVehicle(medicalDispatcher, "AMB-1", "medical", "ambulance", 2)
+	l.startMission(medicalDispatcher, "M1", "AMB-1", "A", "B", "high", `[{"segmentId":"S1","fromNode":"A","toNode":"B"}]`)
+
+	for _, value := range []string{
+		`{"$gt":null}`,
+		`M1","missionId":{"$regex":".*`,
+		`M1"}],"$or":[{"docType":"audit`,
+		"M",
+	} {
+		for _, filters := range [][4]string{
+			{value, "", "", ""},
+			{"", value, "", ""},
+			{"", "", value, ""},
+			{"", "", "", value},
+		} {
+			if entries := l.auditTrail(filters[0], filters[1], filters[2], filters[3], 0, 0); len(entries) != 0 {
+				t.Fatalf("filter %q matched %d entries", value, len(entries))
+			}
+		}
+	}
+
+	// Composite key attributes cannot carry the key separator
+	l.mustFail(medicalDispatcher, "failed to read audit trail", "AuditContract:GetAuditTrail", "M1\x00", "", "", "", "0", "0")
+}
+
+func TestPaginationFollowsBookmarks(t *testing.T) {
+	l := newLedger(t)
+	for i := 1; i <= 3; i++ {
+		l.registerVehicle(medicalDispatcher, fmt.Sprintf("AMB-%d", i), "medical", "ambulance", 2)
+	}
+	for i := 1; i <= 2; i++ {
+		l.registerVehicle(policeDispatcher, fmt.Sprintf("POL-%d", i), "police", "patrol_car", 3)
+	}
+
+	for _, tc := range []struct {
+		fn    string
+		args  []string
+		pages [][]string
+	}{
+		{"VehicleContract:GetAllVehiclesWithPagination", nil, [][]string{{"AMB-1", "AMB-2"}, {"AMB-3", "POL-1"}, {"POL-2"}}},
+		{"VehicleContract:GetVehiclesByOrgWithPagination", []string{"medical"}, [][]string{{"AMB-1", "AMB-2"}, {"AMB-3"}}},
+	} {
+		bookmark := ""
+		for i, want := range tc.pages {
+			var page models.VehiclePage
+			args := append(append([]string{}, tc.args...), "2", bookmark)
+			if err := json.Unmarshal([]byte(l.mustInvoke(medicalDispatcher, tc.fn, args...)), &page); err != nil {
+				t.Fatalf("%s: failed to decode page %d: %v", tc.fn, i, err)
+			}
+			got := []string{}
+			for _, vehicle := range page.Records {
+				got = append(got, vehicle.VehicleID)
+			}
+			if fmt.Sprint(got) != fmt.Sprint(want) || page.FetchedCount != int32(len(want)) {
+				t.Fatalf("%s: page %d holds %v (fetched %d), want %v", tc.fn, i, got, page.FetchedCount, want)
+			}
+			if last := i == len(tc.pages)-1; last != (page.Bookmark == "") {
+				t.Fatalf("%s: page %d returned bookmark %q", tc.fn, i, page.Bookmark)
+			}
+			bookmark = page.Bookmark
+		}
+	}
+}
+
+func TestPageSizeBounds(t *testing.T) {
+	l := newLedger(t)
+
+	for _, call := range [][]string{
+		{"VehicleContract:GetAllVehiclesWithPagination"},
+		{"VehicleContract:GetVehiclesByOrgWithPagination", "medical"},
+		{"SegmentContract:GetAllSegmentsWithPagination"},
+		{"SegmentContract:GetSegmentsByStatusWithPagination", models.StatusFree},
+		{"MissionContract:GetAllMissionsWithPagination"},
+		{"MissionContract:GetMissionsByStatusWithPagination", models.MissionActive},
+		{"MissionContract:GetMissionsByOrgWithPagination", "medical"},
+	} {
+		fn, args := call[0], call[1:]
+		for _, pageSize := range []string{"0", "-1", fmt.Sprint(maxPageSize + 1)} {
+			l.mustFail(medicalDispatcher, "page size must be between 1 and 1000", fn, append(append([]string{}, args...), pageSize, "")...)
+		}
+		for _, pageSize := range []string{"1", fmt.Sprint(maxPageSize)} {
+			l.mustInvoke(medicalDispatcher, fn, append(append([]string{}, args...), pageSize, "")...)
+		}
+	}
+}
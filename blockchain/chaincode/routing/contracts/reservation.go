@@ -0,0 +1,203 @@
+package contracts
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/emergency-routing/chaincode/routing/models"
+)
+
+// reservationLeaseSeconds is how long a reservation stays valid without a
+// RenewLease heartbeat (or an OccupySegment) from the mission holding it
+const reservationLeaseSeconds = 300
+
+// windowsOverlap reports whether two [enterAt, exitAt] windows intersect
+// An exitAt of 0 means the window is open-ended. Touching windows do not overlap.
+func windowsOverlap(enter1 int64, exit1 int64, enter2 int64, exit2 int64) bool {
+	return (exit2 == 0 || enter1 < exit2) && (exit1 == 0 || enter2 < exit1)
+}
+
+// normalizeWindow fills in a zero enterAt with the transaction time and validates the window
+func normalizeWindow(enterAt int64, exitAt int64, now int64) (int64, int64, error) {
+	if enterAt < 0 || exitAt < 0 {
+		return 0, 0, fmt.Errorf("reservation window cannot be negative")
+	}
+	if enterAt == 0 {
+		enterAt = now
+	}
+	if exitAt != 0 && exitAt <= enterAt {
+		return 0, 0, fmt.Errorf("reservation window must end after it starts (enterAt=%d, exitAt=%d)", enterAt, exitAt)
+	}
+	return enterAt, exitAt, nil
+}
+
+// overlappingReservations returns the reservations on a segment that intersect a window
+func overlappingReservations(segment *models.Segment, enterAt int64, exitAt int64) []models.Reservation {
+	_, overlapping := splitReservations(segment.Reservations, inWindow(enterAt, exitAt))
+	return overlapping
+}
+
+// sameDirection matches reservations travelling the given way; a reservation
+// without a direction, or a request without one, competes with both directions
+func sameDirection(direction string) func(models.Reservation) bool {
+	return func(r models.Reservation) bool {
+		return direction == "" || r.Direction == "" || r.Direction == direction
+	}
+}
+
+// segmentCapacity returns how many reservations per direction may overlap on a segment
+func segmentCapacity(segment *models.Segment) int {
+	if segment.Capacity < 1 {
+		return 1
+	}
+	return segment.Capacity
+}
+
+// contenders returns the overlapping reservations that must give way for one more
+// window to fit in capacity lanes, weakest first. None while a lane is still free
+func contenders(overlapping []models.Reservation, capacity int) []models.Reservation {
+	if len(overlapping) < capacity {
+		return nil
+	}
+	weakestFirst := append([]models.Reservation{}, overlapping...)
+	sort.SliceStable(weakestFirst, func(i, j int) bool {
+		return weakestFirst[i].PriorityLevel > weakestFirst[j].PriorityLevel
+	})
+	return weakestFirst[:len(weakestFirst)-capacity+1]
+}
+
+// findReservation returns the index of the first reservation matching the predicate, or -1
+func findReservation(segment *models.Segment, match func(models.Reservation) bool) int {
+	for i, r := range segment.Reservations {
+		if match(r) {
+			return i
+		}
+	}
+	return -1
+}
+
+// removeReservations drops every reservation matching the predicate
+// Returns the removed reservations
+func removeReservations(segment *models.Segment, match func(models.Reservation) bool) []models.Reservation {
+	kept, removed := splitReservations(segment.Reservations, match)
+	segment.Reservations = kept
+	return removed
+}
+
+// splitReservations separates the reservations matching the predicate from the others
+func splitReservations(reservations []models.Reservation, match func(models.Reservation) bool) ([]models.Reservation, []models.Reservation) {
+	kept := []models.Reservation{}
+	matched := []models.Reservation{}
+	for _, r := range reservations {
+		if match(r) {
+			matched = append(matched, r)
+		} else {
+			kept = append(kept, r)
+		}
+	}
+	return kept, matched
+}
+
+// inWindow matches reservations whose window intersects [enterAt, exitAt]
+func inWindow(enterAt int64, exitAt int64) func(models.Reservation) bool {
+	return func(r models.Reservation) bool { return windowsOverlap(r.EnterAt, r.ExitAt, enterAt, exitAt) }
+}
+
+// atMost limits a predicate to its first n matches
+func atMost(n int, match func(models.Reservation) bool) func(models.Reservation) bool {
+	return func(r models.Reservation) bool {
+		if n <= 0 || !match(r) {
+			return false
+		}
+		n--
+		return true
+	}
+}
+
+// expiredAt matches reservations whose lease ran out before now
+// Reservations without a lease (written before leases existed) never expire
+func expiredAt(now int64) func(models.Reservation) bool {
+	return func(r models.Reservation) bool { return r.LeaseExpiresAt != 0 && r.LeaseExpiresAt <= now }
+}
+
+// pruneExpired drops expired reservations from a segment that is only being read,
+// so read paths report them as free before the sweep has released them
+func pruneExpired(segment *models.Segment, now int64) {
+	removeReservations(segment, expiredAt(now))
+	liftEndedBlockage(segment, now)
+	refreshSummary(segment, now)
+}
+
+// byMission matches reservations held by a mission
+func byMission(missionID string) func(models.Reservation) bool {
+	return func(r models.Reservation) bool { return r.MissionID == missionID }
+}
+
+// byVehicle matches reservations held by a vehicle
+func byVehicle(vehicleID string) func(models.Reservation) bool {
+	return func(r models.Reservation) bool { return r.VehicleID == vehicleID }
+}
+
+// refreshSummary keeps reservations ordered by enterAt and mirrors the current one
+// (the occupied window if any, else the earliest) into the flat segment fields
+// A segment reads "blocked" whatever its reservations while a closure is in effect,
+// not before a scheduled closure starts
+func refreshSummary(segment *models.Segment, now int64) {
+	sort.SliceStable(segment.Reservations, func(i, j int) bool {
+		return segment.Reservations[i].EnterAt < segment.Reservations[j].EnterAt
+	})
+
+	if len(segment.Reservations) == 0 {
+		segment.Status = models.StatusFree
+		segment.ReservedBy = ""
+		segment.MissionID = ""
+		segment.OrgType = ""
+		segment.PriorityLevel = 0
+		segment.ReservedAt = 0
+		segment.Holders = nil
+	} else {
+		current := segment.Reservations[0]
+		if i := findReservation(segment, func(r models.Reservation) bool { return r.Status == models.StatusOccupied }); i >= 0 {
+			current = segment.Reservations[i]
+		}
+		segment.Status = current.Status
+		segment.ReservedBy = current.VehicleID
+		segment.MissionID = current.MissionID
+		segment.OrgType = current.OrgType
+		segment.PriorityLevel = current.PriorityLevel
+		segment.ReservedAt = current.ReservedAt
+
+		// Vehicles sharing the segment with the current one, in either lane
+		segment.Holders = []string{}
+		for _, r := range segment.Reservations {
+			if windowsOverlap(r.EnterAt, r.ExitAt, current.EnterAt, current.ExitAt) {
+				segment.Holders = append(segment.Holders, r.VehicleID)
+			}
+		}
+	}
+
+	if closureActive(segment.Blockage, now) {
+		segment.Status = models.StatusBlocked
+	}
+}
+
+// upgradeLegacySegment converts a segment written before reservation windows
+// existed into a single open-ended reservation
+func upgradeLegacySegment(segment *models.Segment) {
+	if segment.Reservations != nil {
+		return
+	}
+	segment.Reservations = []models.Reservation{}
+	if segment.Status != models.StatusFree && segment.MissionID != "" {
+		segment.Reservations = append(segment.Reservations, models.Reservation{
+			MissionID:     segment.MissionID,
+			VehicleID:     segment.ReservedBy,
+			OrgType:       segment.OrgType,
+			PriorityLevel: segment.PriorityLevel,
+			Status:        segment.Status,
+			EnterAt:       segment.ReservedAt,
+			ExitAt:        0,
+			ReservedAt:    segment.ReservedAt,
+		})
+	}
+}
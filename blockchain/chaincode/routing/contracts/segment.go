@@ -3,7 +3,6 @@ package contracts
 import (
 	"encoding/json"
 	"fmt"
-	"time"
 
 	"github.com/emergency-routing/chaincode/routing/models"
 	"github.com/hyperledger/fabric-contract-api-go/contractapi"
@@ -19,7 +18,7 @@ type SegmentContract struct {
 // Map topology is stored in PostgreSQL, not in the blockchain
 // The blockchain only stores reservation state (status, reservedBy, missionId, etc.)
 func (c *SegmentContract) InitSegments(
-	ctx contractapi.TransactionContextInterface,
+	ctx RoutingContextInterface,
 ) error {
 	// No-op: segments are created on-demand when reserved
 	// Map data (fromNode, toNode, geometry) is stored in PostgreSQL
@@ -27,13 +26,33 @@ func (c *SegmentContract) InitSegments(
 	return nil
 }
 
-// GetSegment retrieves a segment by ID
+// GetSegment retrieves a segment by ID, with expired reservations shown as free
 // Returns nil if segment doesn't exist (for lazy initialization)
 func (c *SegmentContract) GetSegment(
-	ctx contractapi.TransactionContextInterface,
+	ctx RoutingContextInterface,
 	segmentID string,
 ) (*models.Segment, error) {
-	segmentJSON, err := ctx.GetStub().GetState(segmentID)
+	segment, err := c.getSegment(ctx, segmentID)
+	if err != nil || segment == nil {
+		return segment, err
+	}
+
+	now, err := txTimestamp(ctx)
+	if err != nil {
+		return nil, err
+	}
+	pruneExpired(segment, now)
+
+	return segment, nil
+}
+
+// getSegment retrieves a segment as stored, including expired reservations
+// Returns nil if segment doesn't exist
+func (c *SegmentContract) getSegment(
+	ctx RoutingContextInterface,
+	segmentID string,
+) (*models.Segment, error) {
+	segmentJSON, err := getEntityState(ctx, segmentObjectType, segmentID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read state: %v", err)
 	}
@@ -47,6 +66,10 @@ func (c *SegmentContract) GetSegment(
 	if err != nil {
 		return nil, fmt.Errorf("failed to unmarshal segment: %v", err)
 	}
+	if err := checkDocType(segmentID, segment.DocType, models.DocTypeSegment); err != nil {
+		return nil, err
+	}
+	upgradeLegacySegment(&segment)
 
 	return &segment, nil
 }
@@ -54,7 +77,7 @@ func (c *SegmentContract) GetSegment(
 // createFreeSegment creates a new free segment (lazy initialization)
 func (c *SegmentContract) createFreeSegment(segmentID string) *models.Segment {
 	return &models.Segment{
-		DocType:       "segment",
+		DocType:       models.DocTypeSegment,
 		SegmentID:     segmentID,
 		FromNode:      "", // Not stored in blockchain - map topology is in database
 		ToNode:        "", // Not stored in blockchain - map topology is in database
@@ -64,286 +87,556 @@ func (c *SegmentContract) createFreeSegment(segmentID string) *models.Segment {
 		OrgType:       "",
 		PriorityLevel: 0,
 		ReservedAt:    0,
+		Reservations:  []models.Reservation{},
 	}
 }
 
 // GetAllSegments retrieves all segments
 func (c *SegmentContract) GetAllSegments(
-	ctx contractapi.TransactionContextInterface,
+	ctx RoutingContextInterface,
 ) ([]*models.Segment, error) {
-	queryString := `{"selector":{"docType":"segment"}}`
-
-	resultsIterator, err := ctx.GetStub().GetQueryResult(queryString)
+	segments, err := getAllEntities[models.Segment](ctx, segmentObjectType)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query segments: %v", err)
 	}
-	defer resultsIterator.Close()
 
-	var segments []*models.Segment
-	for resultsIterator.HasNext() {
-		queryResult, err := resultsIterator.Next()
-		if err != nil {
-			return nil, err
-		}
+	return currentSegments(ctx, segments, "")
+}
 
-		var segment models.Segment
-		err = json.Unmarshal(queryResult.Value, &segment)
-		if err != nil {
-			return nil, err
-		}
-		segments = append(segments, &segment)
+// GetAllSegmentsWithPagination retrieves one page of segments in ID order
+// bookmark is empty for the first page, then the bookmark of the previous page
+func (c *SegmentContract) GetAllSegmentsWithPagination(
+	ctx RoutingContextInterface,
+	pageSize int32,
+	bookmark string,
+) (*models.SegmentPage, error) {
+	page, err := rangePage[models.Segment](ctx, segmentObjectType, pageSize, bookmark)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query segments: %v", err)
+	}
+
+	segments, err := currentSegments(ctx, page.records, "")
+	if err != nil {
+		return nil, err
 	}
 
-	return segments, nil
+	return &models.SegmentPage{Records: segments, Bookmark: page.bookmark, FetchedCount: page.fetchedCount}, nil
 }
 
-// ReserveSegment reserves a segment for a vehicle/mission
+// ReserveSegment reserves a segment for a vehicle/mission during [enterAt, exitAt]
 // Creates the segment if it doesn't exist (lazy initialization)
-// Returns a conflict if the segment is already reserved by same priority
+// Only reservations whose windows overlap the requested one in the same direction
+// compete with it, and only once the segment's capacity in that direction is used up:
+// then a request stronger than the weakest holders preempts them, the same priority
+// creates a conflict and a lower priority request is denied. Expired reservations are
+// released first. fromNode is the node the vehicle enters from ("" = either direction).
+// A window inside a road closure (see BlockSegment) is refused outright
+// enterAt 0 means "from now", exitAt 0 means the window is open-ended
+// The reservation holds a lease that must be renewed with RenewLease
+// The mission must be underway, belong to the caller's org and use the vehicle, and
+// the priority can be no higher than the mission's own (see checkReservationRequest)
 // NOTE: Map topology (fromNode, toNode) is NOT stored in blockchain - only reservation state
 func (c *SegmentContract) ReserveSegment(
-	ctx contractapi.TransactionContextInterface,
+	ctx RoutingContextInterface,
+	segmentID string,
+	vehicleID string,
+	missionID string,
+	priorityLevel int,
+	enterAt int64,
+	exitAt int64,
+	fromNode string,
+) (*models.Conflict, error) {
+	mission, err := checkReservationRequest(ctx, missionID, vehicleID, priorityLevel)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.reserveSegment(ctx, segmentID, vehicleID, missionID, mission.OrgType, priorityLevel, enterAt, exitAt, fromNode, "", false)
+}
+
+// checkReservationRequest validates a reservation requested directly by a dispatcher
+// The priority must be a valid level the caller's org may use, and no higher than
+// the mission's, which must be underway, belong to the caller's org and use the vehicle
+func checkReservationRequest(
+	ctx RoutingContextInterface,
+	missionID string,
+	vehicleID string,
+	priorityLevel int,
+) (*models.Mission, error) {
+	if priorityLevel < 1 || priorityLevel > 5 {
+		return nil, fmt.Errorf("priority level must be between 1 and 5")
+	}
+	callerOrg, err := resolveCallerOrg(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkPriorityAllowed(callerOrg, priorityLevel); err != nil {
+		return nil, err
+	}
+
+	mission, err := (&MissionContract{}).GetMission(ctx, missionID)
+	if err != nil {
+		return nil, err
+	}
+	if mission.OrgType != callerOrg.OrgType {
+		return nil, fmt.Errorf("access denied: mission %s belongs to another organization", missionID)
+	}
+	if !isMissionUnderway(mission.Status) {
+		return nil, fmt.Errorf("mission %s is not active (current: %s)", missionID, mission.Status)
+	}
+	if mission.VehicleID != vehicleID {
+		return nil, fmt.Errorf("mission %s is assigned to vehicle %s, not %s", missionID, mission.VehicleID, vehicleID)
+	}
+	if priorityLevel < mission.PriorityLevel {
+		return nil, fmt.Errorf("priority level %d exceeds mission %s priority (%d)", priorityLevel, missionID, mission.PriorityLevel)
+	}
+
+	return mission, nil
+}
+
+// reserveSegment reserves a segment window on behalf of orgType (see ReserveSegment)
+// Members of the same convoy never compete with each other for a window
+// With queue set, a denied request joins the segment's waitlist (see QueueSegment)
+func (c *SegmentContract) reserveSegment(
+	ctx RoutingContextInterface,
 	segmentID string,
 	vehicleID string,
 	missionID string,
+	orgType string,
 	priorityLevel int,
+	enterAt int64,
+	exitAt int64,
+	direction string,
+	toNode string,
+	queue bool,
 ) (*models.Conflict, error) {
 	// Get segment (or nil if it doesn't exist)
-	segment, err := c.GetSegment(ctx, segmentID)
+	segment, err := c.getSegment(ctx, segmentID)
 	if err != nil {
 		return nil, err
 	}
-	
+
 	// Lazy initialization: create segment if it doesn't exist
 	if segment == nil {
 		segment = c.createFreeSegment(segmentID)
 	}
 
-	// Get caller org
-	clientIdentity := ctx.GetClientIdentity()
-	mspID, _ := clientIdentity.GetMSPID()
-	orgType := ""
-	switch mspID {
-	case "MedicalMSP":
-		orgType = "medical"
-	case "PoliceMSP":
-		orgType = "police"
-	default:
-		return nil, fmt.Errorf("unknown organization: %s", mspID)
-	}
-
-	// Check if segment is already reserved
-	if segment.Status != models.StatusFree {
-		// Check priority
-		if priorityLevel < segment.PriorityLevel {
-			// Higher priority (lower number) - preempt existing reservation
-			// Release the segment from existing reservation
-			oldVehicle := segment.ReservedBy
-			oldMission := segment.MissionID
-
-			// Reserve for new vehicle
-			segment.Status = models.StatusReserved
-			segment.ReservedBy = vehicleID
-			segment.MissionID = missionID
-			segment.OrgType = orgType
-			segment.PriorityLevel = priorityLevel
-			segment.ReservedAt = time.Now().Unix()
-
-			segmentJSON, _ := json.Marshal(segment)
-			ctx.GetStub().PutState(segmentID, segmentJSON)
-
-			// Emit preemption event
-			preemptionEvent := map[string]interface{}{
-				"type":           models.EventPreemptionTriggered,
-				"segmentId":      segmentID,
-				"preemptedBy":    vehicleID,
-				"preemptedFrom":  oldVehicle,
-				"oldMissionId":   oldMission,
-				"newMissionId":   missionID,
-				"newPriority":    priorityLevel,
+	now, err := txTimestamp(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	enterAt, exitAt, err = normalizeWindow(enterAt, exitAt, now)
+	if err != nil {
+		return nil, err
+	}
+
+	// Closed roads cannot be reserved, whatever the priority
+	liftEndedBlockage(segment, now)
+	if err := checkOpen(segment, enterAt, exitAt); err != nil {
+		return nil, err
+	}
+
+	reservation := models.Reservation{
+		MissionID:     missionID,
+		VehicleID:     vehicleID,
+		OrgType:       orgType,
+		PriorityLevel: priorityLevel,
+		Status:        models.StatusReserved,
+		EnterAt:       enterAt,
+		ExitAt:        exitAt,
+		ReservedAt:    now,
+
+		LeaseExpiresAt: now + reservationLeaseSeconds,
+		Direction:      direction,
+		ToNode:         toNode,
+	}
+
+	// A mission re-reserving a segment replaces its own window (or queued request)
+	// instead of competing with it. The old one stays until the request settles: it is
+	// replaced once the new window is reserved or queued, and kept through a conflict
+	replaceOwn := func() {
+		removeReservations(segment, byMission(missionID))
+		removeQueued(segment, byMission(missionID))
+	}
+
+	// Expired reservations no longer compete - the windows they free go to the waitlist first
+	expired, err := c.expireReservations(ctx, segment, now)
+	if err != nil {
+		return nil, err
+	}
+
+	// Check if the window is already taken in this direction - the mission's own convoy shares it
+	_, sameWay := splitReservations(overlappingReservations(segment, enterAt, exitAt), sameDirection(direction))
+	sameWay, _ = splitReservations(sameWay, byMission(missionID))
+	overlapping, err := outsideConvoy(ctx, missionID, sameWay)
+	if err != nil {
+		return nil, err
+	}
+
+	// With every lane taken, the weakest holders must give way for one to free up
+	overlapping = contenders(overlapping, segmentCapacity(segment))
+	if len(overlapping) > 0 {
+		// The strongest of them decides the outcome
+		strongest := overlapping[len(overlapping)-1]
+
+		if priorityLevel < strongest.PriorityLevel {
+			// Higher priority (lower number) - preempt every overlapping reservation
+			for _, victim := range overlapping {
+				removeReservations(segment, byMission(victim.MissionID))
+			}
+			replaceOwn()
+			segment.Reservations = append(segment.Reservations, reservation)
+
+			if _, err := c.writeSegment(ctx, segment); err != nil {
+				return nil, err
+			}
+
+			missionContract := &MissionContract{}
+			for _, victim := range overlapping {
+				// Tell the losing mission it no longer holds the segment
+				err = missionContract.markPreempted(ctx, victim.MissionID, models.PreemptedSegment{
+					SegmentID:     segmentID,
+					ByMissionID:   missionID,
+					ByVehicleID:   vehicleID,
+					PriorityLevel: priorityLevel,
+					PreemptedAt:   now,
+				})
+				if err != nil {
+					return nil, err
+				}
+
+				// Raise preemption event
+				preemptionEvent := map[string]interface{}{
+					"type":          models.EventPreemptionTriggered,
+					"segmentId":     segmentID,
+					"preemptedBy":   vehicleID,
+					"preemptedFrom": victim.VehicleID,
+					"oldMissionId":  victim.MissionID,
+					"newMissionId":  missionID,
+					"newPriority":   priorityLevel,
+					"enterAt":       enterAt,
+					"exitAt":        exitAt,
+				}
+				eventJSON, _ := json.Marshal(preemptionEvent)
+				ctx.RaiseEvent(models.EventPreemptionTriggered, eventJSON)
+				ctx.Audit(models.AuditEvent{
+					EventType: models.EventPreemptionTriggered,
+					MissionID: victim.MissionID,
+					VehicleID: victim.VehicleID,
+					SegmentID: segmentID,
+					Details: map[string]interface{}{
+						"preemptedByMissionId": missionID,
+						"preemptedByVehicleId": vehicleID,
+						"priorityLevel":        priorityLevel,
+					},
+				})
 			}
-			eventJSON, _ := json.Marshal(preemptionEvent)
-			ctx.GetStub().SetEvent(models.EventPreemptionTriggered, eventJSON)
+			ctx.Audit(models.AuditEvent{
+				EventType: models.EventSegmentReserved,
+				MissionID: missionID,
+				VehicleID: vehicleID,
+				SegmentID: segmentID,
+				Details: map[string]interface{}{
+					"enterAt":   enterAt,
+					"exitAt":    exitAt,
+					"preempted": len(overlapping),
+				},
+			})
 
 			return nil, nil
 
-		} else if priorityLevel == segment.PriorityLevel {
+		} else if priorityLevel == strongest.PriorityLevel {
 			// Same priority - create conflict for negotiation
 			conflict := &models.Conflict{
-				DocType:    "conflict",
-				ConflictID: fmt.Sprintf("CONFLICT-%s-%d", segmentID, time.Now().Unix()),
+				DocType:    models.DocTypeConflict,
+				ConflictID: txScopedID(ctx, "CONFLICT", segmentID),
 				SegmentID:  segmentID,
-				Mission1ID: segment.MissionID,
+				Mission1ID: strongest.MissionID,
 				Mission2ID: missionID,
-				Priority1:  segment.PriorityLevel,
+				Priority1:  strongest.PriorityLevel,
 				Priority2:  priorityLevel,
 				Status:     models.ConflictPending,
-				CreatedAt:  time.Now().Unix(),
+				CreatedAt:  now,
+				EnterAt:    enterAt,
+				ExitAt:     exitAt,
+				Direction:  direction,
+
+				Vehicle1ID: strongest.VehicleID,
+				Vehicle2ID: vehicleID,
+				OrgType1:   strongest.OrgType,
+				OrgType2:   orgType,
 			}
 
 			// Store conflict
-			conflictJSON, _ := json.Marshal(conflict)
-			ctx.GetStub().PutState(conflict.ConflictID, conflictJSON)
+			conflictJSON, err := json.Marshal(conflict)
+			if err != nil {
+				return nil, fmt.Errorf("failed to marshal conflict: %v", err)
+			}
+			err = putEntityState(ctx, conflictObjectType, conflict.ConflictID, conflictJSON)
+			if err != nil {
+				return nil, fmt.Errorf("failed to write state: %v", err)
+			}
+
+			// Raise conflict event
+			ctx.RaiseEvent(models.EventConflictDetected, conflictJSON)
+			ctx.Audit(models.AuditEvent{
+				EventType: models.EventConflictDetected,
+				MissionID: missionID,
+				VehicleID: vehicleID,
+				SegmentID: segmentID,
+				Details: map[string]interface{}{
+					"conflictId":        conflict.ConflictID,
+					"conflictMissionId": conflict.Mission1ID,
+				},
+			})
 
-			// Emit conflict event
-			ctx.GetStub().SetEvent(models.EventConflictDetected, conflictJSON)
+			// The mission keeps its old window; persist the release of any expired
+			// reservations found on the way
+			if len(expired) > 0 {
+				if _, err := c.writeSegment(ctx, segment); err != nil {
+					return nil, err
+				}
+			}
 
 			return conflict, nil
 
+		} else if queue {
+			// Lower priority - wait for the window on the segment's waitlist
+			replaceOwn()
+			return nil, c.enqueue(ctx, segment, reservation)
+
 		} else {
 			// Lower priority - deny reservation
 			return nil, fmt.Errorf("segment %s is reserved by higher priority vehicle", segmentID)
 		}
 	}
 
-	// Segment is free - reserve it
-	segment.Status = models.StatusReserved
-	segment.ReservedBy = vehicleID
-	segment.MissionID = missionID
-	segment.OrgType = orgType
-	segment.PriorityLevel = priorityLevel
-	segment.ReservedAt = time.Now().Unix()
+	// Window is free - reserve it
+	replaceOwn()
+	segment.Reservations = append(segment.Reservations, reservation)
 
-	segmentJSON, err := json.Marshal(segment)
-	if err != nil {
-		return nil, fmt.Errorf("failed to marshal segment: %v", err)
-	}
-
-	err = ctx.GetStub().PutState(segmentID, segmentJSON)
-	if err != nil {
-		return nil, fmt.Errorf("failed to write state: %v", err)
+	if err := c.putSegment(ctx, segment, models.EventSegmentReserved, missionID, vehicleID); err != nil {
+		return nil, err
 	}
 
-	// Emit event
-	ctx.GetStub().SetEvent(models.EventSegmentReserved, segmentJSON)
-
 	return nil, nil
 }
 
-// ReleaseSegment releases a segment reservation
+// ReleaseSegment releases a vehicle's reservation on a segment, or withdraws its
+// queued request. The freed window is granted to the waitlist in the same transaction
 func (c *SegmentContract) ReleaseSegment(
-	ctx contractapi.TransactionContextInterface,
+	ctx RoutingContextInterface,
 	segmentID string,
 	vehicleID string,
 ) error {
-	segment, err := c.GetSegment(ctx, segmentID)
+	// Drivers may only release segments for their own vehicle
+	if err := requireVehicleAccess(ctx, vehicleID); err != nil {
+		return err
+	}
+
+	segment, err := c.getSegment(ctx, segmentID)
 	if err != nil {
 		return err
 	}
-	
+
 	// If segment doesn't exist, nothing to release
 	if segment == nil {
 		return fmt.Errorf("segment %s does not exist (cannot release)", segmentID)
 	}
 
-	// Verify the vehicle holds the reservation
-	if segment.ReservedBy != vehicleID {
-		return fmt.Errorf("segment %s is not reserved by vehicle %s", segmentID, vehicleID)
-	}
-
-	// Release segment
-	segment.Status = models.StatusFree
-	segment.ReservedBy = ""
-	segment.MissionID = ""
-	segment.OrgType = ""
-	segment.PriorityLevel = 0
-	segment.ReservedAt = 0
-
-	segmentJSON, err := json.Marshal(segment)
+	now, err := txTimestamp(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to marshal segment: %v", err)
+		return err
 	}
 
-	err = ctx.GetStub().PutState(segmentID, segmentJSON)
+	// Release the vehicle's reservation
+	released, _, err := c.releaseReservations(ctx, segment, byVehicle(vehicleID), nil, now)
 	if err != nil {
-		return fmt.Errorf("failed to write state: %v", err)
+		return err
+	}
+	removed := append(released, removeQueued(segment, byVehicle(vehicleID))...)
+	if len(removed) == 0 {
+		return fmt.Errorf("segment %s is not reserved by vehicle %s", segmentID, vehicleID)
 	}
 
-	// Emit event
-	ctx.GetStub().SetEvent(models.EventSegmentReleased, segmentJSON)
-
-	return nil
+	return c.putSegment(ctx, segment, models.EventSegmentReleased, removed[0].MissionID, vehicleID)
 }
 
 // OccupySegment marks a segment as occupied (vehicle is currently on it)
 func (c *SegmentContract) OccupySegment(
-	ctx contractapi.TransactionContextInterface,
+	ctx RoutingContextInterface,
 	segmentID string,
 	vehicleID string,
 ) error {
-	segment, err := c.GetSegment(ctx, segmentID)
+	// Drivers may only occupy segments for their own vehicle
+	if err := requireVehicleAccess(ctx, vehicleID); err != nil {
+		return err
+	}
+
+	segment, err := c.getSegment(ctx, segmentID)
 	if err != nil {
 		return err
 	}
-	
+
 	// If segment doesn't exist, cannot occupy
 	if segment == nil {
 		return fmt.Errorf("segment %s does not exist (cannot occupy)", segmentID)
 	}
 
-	// Verify the vehicle holds the reservation
-	if segment.ReservedBy != vehicleID {
+	// Verify the vehicle holds a reservation
+	i := findReservation(segment, byVehicle(vehicleID))
+	if i < 0 {
 		return fmt.Errorf("segment %s is not reserved by vehicle %s", segmentID, vehicleID)
 	}
 
-	// Mark as occupied
-	segment.Status = models.StatusOccupied
-
-	segmentJSON, err := json.Marshal(segment)
+	now, err := txTimestamp(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to marshal segment: %v", err)
+		return err
+	}
+	if expiredAt(now)(segment.Reservations[i]) {
+		return fmt.Errorf("reservation of vehicle %s on segment %s has expired", vehicleID, segmentID)
 	}
 
-	err = ctx.GetStub().PutState(segmentID, segmentJSON)
+	// Mark as occupied - a vehicle on the segment is proof of life, so renew the lease
+	segment.Reservations[i].Status = models.StatusOccupied
+	segment.Reservations[i].LeaseExpiresAt = now + reservationLeaseSeconds
+
+	return c.putSegment(ctx, segment, models.EventSegmentOccupied, segment.Reservations[i].MissionID, vehicleID)
+}
+
+// SetSegmentCapacity sets how many vehicles may hold a segment at once in each
+// direction (e.g., one per lane of a wide avenue). Existing reservations are kept
+// when capacity is lowered; new ones wait for a lane to free up. Lanes opened by
+// a higher capacity are granted to the waitlist
+func (c *SegmentContract) SetSegmentCapacity(
+	ctx RoutingContextInterface,
+	segmentID string,
+	capacity int,
+) error {
+	if capacity < 1 {
+		return fmt.Errorf("capacity must be at least 1")
+	}
+
+	segment, err := c.getSegment(ctx, segmentID)
 	if err != nil {
-		return fmt.Errorf("failed to write state: %v", err)
+		return err
+	}
+	if segment == nil {
+		segment = c.createFreeSegment(segmentID)
 	}
 
-	// Emit event
-	ctx.GetStub().SetEvent(models.EventSegmentOccupied, segmentJSON)
+	segment.Capacity = capacity
 
-	return nil
+	now, err := txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+	if err := c.grantWaitlist(ctx, segment, now); err != nil {
+		return err
+	}
+
+	return c.putSegment(ctx, segment, models.EventCapacityChanged, "", "")
 }
 
 // GetSegmentsByStatus retrieves segments with a specific status
 func (c *SegmentContract) GetSegmentsByStatus(
-	ctx contractapi.TransactionContextInterface,
+	ctx RoutingContextInterface,
 	status string,
 ) ([]*models.Segment, error) {
-	queryString := fmt.Sprintf(`{"selector":{"docType":"segment","status":"%s"}}`, status)
+	if err := checkSegmentStatus(status); err != nil {
+		return nil, err
+	}
 
-	resultsIterator, err := ctx.GetStub().GetQueryResult(queryString)
+	index, attributes := segmentStatusSource(status)
+	segments, err := queryIndex[models.Segment](ctx, index, segmentObjectType, attributes...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query segments: %v", err)
 	}
-	defer resultsIterator.Close()
 
-	var segments []*models.Segment
-	for resultsIterator.HasNext() {
-		queryResult, err := resultsIterator.Next()
-		if err != nil {
-			return nil, err
-		}
+	return currentSegments(ctx, segments, status)
+}
 
-		var segment models.Segment
-		err = json.Unmarshal(queryResult.Value, &segment)
-		if err != nil {
-			return nil, err
+// GetSegmentsByStatusWithPagination retrieves one page of segments with a specific status
+// A page can hold fewer records than were fetched when expired reservations changed a status
+func (c *SegmentContract) GetSegmentsByStatusWithPagination(
+	ctx RoutingContextInterface,
+	status string,
+	pageSize int32,
+	bookmark string,
+) (*models.SegmentPage, error) {
+	if err := checkSegmentStatus(status); err != nil {
+		return nil, err
+	}
+
+	index, attributes := segmentStatusSource(status)
+	page, err := queryIndexPage[models.Segment](ctx, index, segmentObjectType, attributes, pageSize, bookmark)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query segments: %v", err)
+	}
+
+	segments, err := currentSegments(ctx, page.records, status)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.SegmentPage{Records: segments, Bookmark: page.bookmark, FetchedCount: page.fetchedCount}, nil
+}
+
+// segmentStatusSource returns the index listing the segments that may have a status
+// Blocked segments are read from the closure index, which also holds closures that
+// started after the segment was last written
+func segmentStatusSource(status string) (string, []string) {
+	if status == models.StatusBlocked {
+		return segmentClosureIndex, []string{}
+	}
+	return segmentStatusIndex, []string{status}
+}
+
+// currentSegments upgrades legacy documents and drops expired reservations from queried segments
+// Expired reservations read as free, so a non-empty status drops segments that no longer match
+func currentSegments(ctx RoutingContextInterface, segments []*models.Segment, status string) ([]*models.Segment, error) {
+	now, err := txTimestamp(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	current := []*models.Segment{}
+	for _, segment := range segments {
+		upgradeLegacySegment(segment)
+		pruneExpired(segment, now)
+		if status != "" && segment.Status != status {
+			continue
 		}
-		segments = append(segments, &segment)
+		current = append(current, segment)
 	}
 
-	return segments, nil
+	return current, nil
 }
 
-// ResolveConflict resolves a pending conflict
+// ResolveConflict resolves a pending conflict and enforces the outcome on the ledger,
+// on the contested segment or intersection
+// mission1_wins: the holder keeps the segment, mission 2 drops it and must reroute
+// mission2_wins: the segment is handed to mission 2, mission 1 drops it and must reroute
+// both_reroute: the segment is released and both missions must reroute
+// Only an organization that owns one of the two missions may resolve
 func (c *SegmentContract) ResolveConflict(
-	ctx contractapi.TransactionContextInterface,
+	ctx RoutingContextInterface,
 	conflictID string,
 	resolution string, // "mission1_wins", "mission2_wins", "both_reroute"
 ) error {
+	// Validate resolution
+	validResolutions := map[string]bool{
+		models.ResolutionMission1Wins: true,
+		models.ResolutionMission2Wins: true,
+		models.ResolutionBothReroute:  true,
+	}
+	if !validResolutions[resolution] {
+		return fmt.Errorf("invalid resolution: %s", resolution)
+	}
+
 	// Get conflict
-	conflictJSON, err := ctx.GetStub().GetState(conflictID)
+	conflictJSON, err := getEntityState(ctx, conflictObjectType, conflictID)
 	if err != nil {
 		return fmt.Errorf("failed to read conflict: %v", err)
 	}
@@ -356,57 +649,478 @@ func (c *SegmentContract) ResolveConflict(
 	if err != nil {
 		return fmt.Errorf("failed to unmarshal conflict: %v", err)
 	}
+	if err := checkDocType(conflictID, conflict.DocType, models.DocTypeConflict); err != nil {
+		return err
+	}
 
 	if conflict.Status != models.ConflictPending {
 		return fmt.Errorf("conflict %s is already resolved", conflictID)
 	}
 
-	// Get caller identity
-	clientIdentity := ctx.GetClientIdentity()
-	mspID, _ := clientIdentity.GetMSPID()
+	// Load both parties
+	mission1, err := conflictParty(ctx, conflict.Mission1ID, conflict.Vehicle1ID, conflict.OrgType1)
+	if err != nil {
+		return err
+	}
+	mission2, err := conflictParty(ctx, conflict.Mission2ID, conflict.Vehicle2ID, conflict.OrgType2)
+	if err != nil {
+		return err
+	}
+
+	// Get caller identity and verify it is a party to the conflict
+	callerOrg, err := resolveCallerOrg(ctx)
+	if err != nil {
+		return err
+	}
+	if callerOrg.OrgType != mission1.OrgType && callerOrg.OrgType != mission2.OrgType {
+		return fmt.Errorf("access denied: %s is not a party to conflict %s", callerOrg.MSPID, conflictID)
+	}
+
+	return c.settleConflict(ctx, &conflict, mission1, mission2, resolution, callerOrg.MSPID)
+}
+
+// settleConflict enforces a resolution on a pending conflict between two parties
+// and records who settled it
+func (c *SegmentContract) settleConflict(
+	ctx RoutingContextInterface,
+	conflict *models.Conflict,
+	mission1 *models.Mission,
+	mission2 *models.Mission,
+	resolution string,
+	resolvedBy string,
+) error {
+	now, err := txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+
+	// Intersection conflicts are enforced on the node, segment conflicts on the segment
+	if conflict.NodeID != "" {
+		err = c.enforceNodeResolution(ctx, conflict, mission1, mission2, resolution, now)
+	} else {
+		err = c.enforceSegmentResolution(ctx, conflict, mission1, mission2, resolution, now)
+	}
+	if err != nil {
+		return err
+	}
 
 	// Update conflict
 	conflict.Status = models.ConflictResolved
 	conflict.Resolution = resolution
-	conflict.ResolvedBy = mspID
-	conflict.ResolvedAt = time.Now().Unix()
+	conflict.ResolvedBy = resolvedBy
+	conflict.ResolvedAt = now
 
-	conflictJSON, _ = json.Marshal(conflict)
-	ctx.GetStub().PutState(conflictID, conflictJSON)
+	conflictJSON, err := json.Marshal(conflict)
+	if err != nil {
+		return fmt.Errorf("failed to marshal conflict: %v", err)
+	}
+	err = putEntityState(ctx, conflictObjectType, conflict.ConflictID, conflictJSON)
+	if err != nil {
+		return fmt.Errorf("failed to write conflict: %v", err)
+	}
 
-	// Emit event
-	ctx.GetStub().SetEvent(models.EventConflictResolved, conflictJSON)
+	// Raise event - the resolution is audited on both missions' trails
+	ctx.RaiseEvent(models.EventConflictResolved, conflictJSON)
+	for _, mission := range []*models.Mission{mission1, mission2} {
+		ctx.Audit(models.AuditEvent{
+			EventType: models.EventConflictResolved,
+			MissionID: mission.MissionID,
+			VehicleID: mission.VehicleID,
+			SegmentID: conflict.SegmentID,
+			Details: map[string]interface{}{
+				"conflictId": conflict.ConflictID,
+				"resolution": resolution,
+			},
+		})
+	}
 
 	return nil
 }
 
-// GetPendingConflicts retrieves all pending conflicts
-func (c *SegmentContract) GetPendingConflicts(
-	ctx contractapi.TransactionContextInterface,
-) ([]*models.Conflict, error) {
-	queryString := fmt.Sprintf(`{"selector":{"docType":"conflict","status":"%s"}}`, models.ConflictPending)
+// conflictParty loads a mission named in a conflict. Segments may be reserved under
+// IDs that are not missions, so an unknown ID stands for itself, with the vehicle
+// and org recorded on the conflict
+func conflictParty(ctx RoutingContextInterface, missionID string, vehicleID string, orgType string) (*models.Mission, error) {
+	missionJSON, err := getEntityState(ctx, missionObjectType, missionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read state: %v", err)
+	}
+	if missionJSON == nil {
+		return &models.Mission{
+			MissionID: missionID,
+			VehicleID: vehicleID,
+			OrgType:   orgType,
+		}, nil
+	}
+
+	var mission models.Mission
+	if err := json.Unmarshal(missionJSON, &mission); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal mission: %v", err)
+	}
+	return &mission, nil
+}
 
-	resultsIterator, err := ctx.GetStub().GetQueryResult(queryString)
+// enforceSegmentResolution applies a conflict resolution to the contested segment
+// (see ResolveConflict) and flags the losing mission(s) for reroute
+func (c *SegmentContract) enforceSegmentResolution(
+	ctx RoutingContextInterface,
+	conflict *models.Conflict,
+	mission1 *models.Mission,
+	mission2 *models.Mission,
+	resolution string,
+	now int64,
+) error {
+	segment, err := c.getSegment(ctx, conflict.SegmentID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to query conflicts: %v", err)
+		return err
+	}
+	if segment == nil {
+		return fmt.Errorf("segment %s does not exist", conflict.SegmentID)
+	}
+	expired, err := c.expireReservations(ctx, segment, now)
+	if err != nil {
+		return err
 	}
-	defer resultsIterator.Close()
 
-	var conflicts []*models.Conflict
-	for resultsIterator.HasNext() {
-		queryResult, err := resultsIterator.Next()
+	// Enforce the resolution on the segment and the losing mission(s)
+	missionContract := &MissionContract{}
+	switch resolution {
+	case models.ResolutionMission1Wins:
+		// Mission 2 loses the segment, including any window it kept through the conflict
+		removed, _, err := c.releaseReservations(ctx, segment, byMission(mission2.MissionID), nil, now)
 		if err != nil {
-			return nil, err
+			return err
+		}
+		if len(removed) > 0 || len(expired) > 0 {
+			if err := c.putSegment(ctx, segment, models.EventSegmentReleased, "", ""); err != nil {
+				return err
+			}
+		}
+		err = missionContract.markPreempted(ctx, mission2.MissionID, models.PreemptedSegment{
+			SegmentID:     conflict.SegmentID,
+			ByMissionID:   mission1.MissionID,
+			ByVehicleID:   mission1.VehicleID,
+			PriorityLevel: conflict.Priority1,
+			PreemptedAt:   now,
+		})
+		if err != nil {
+			return err
+		}
+
+	case models.ResolutionMission2Wins:
+		enterAt, exitAt, err := normalizeWindow(conflict.EnterAt, conflict.ExitAt, now)
+		if err != nil {
+			return err
+		}
+		liftEndedBlockage(segment, now)
+		if err := checkOpen(segment, enterAt, exitAt); err != nil {
+			return err
+		}
+		removeReservations(segment, func(r models.Reservation) bool {
+			return r.MissionID == mission1.MissionID && windowsOverlap(r.EnterAt, r.ExitAt, enterAt, exitAt)
+		})
+		removeReservations(segment, byMission(mission2.MissionID))
+		_, sameWay := splitReservations(overlappingReservations(segment, enterAt, exitAt), sameDirection(conflict.Direction))
+		if len(contenders(sameWay, segmentCapacity(segment))) > 0 {
+			return fmt.Errorf("segment %s window is no longer available to mission %s", conflict.SegmentID, mission2.MissionID)
+		}
+		segment.Reservations = append(segment.Reservations, models.Reservation{
+			MissionID:     mission2.MissionID,
+			VehicleID:     mission2.VehicleID,
+			OrgType:       mission2.OrgType,
+			PriorityLevel: conflict.Priority2,
+			Status:        models.StatusReserved,
+			EnterAt:       enterAt,
+			ExitAt:        exitAt,
+			ReservedAt:    now,
+
+			LeaseExpiresAt: now + reservationLeaseSeconds,
+			Direction:      conflict.Direction,
+		})
+		if err := c.putSegment(ctx, segment, models.EventSegmentReserved, mission2.MissionID, mission2.VehicleID); err != nil {
+			return err
+		}
+
+		err = missionContract.markPreempted(ctx, mission1.MissionID, models.PreemptedSegment{
+			SegmentID:     conflict.SegmentID,
+			ByMissionID:   mission2.MissionID,
+			ByVehicleID:   mission2.VehicleID,
+			PriorityLevel: conflict.Priority2,
+			PreemptedAt:   now,
+		})
+		if err != nil {
+			return err
+		}
+
+	case models.ResolutionBothReroute:
+		removed, _, err := c.releaseReservations(ctx, segment, func(r models.Reservation) bool {
+			return r.MissionID == mission1.MissionID || r.MissionID == mission2.MissionID
+		}, nil, now)
+		if err != nil {
+			return err
 		}
+		if len(removed) > 0 || len(expired) > 0 {
+			if err := c.putSegment(ctx, segment, models.EventSegmentReleased, "", ""); err != nil {
+				return err
+			}
+		}
+
+		for _, missionID := range []string{mission1.MissionID, mission2.MissionID} {
+			err = missionContract.markPreempted(ctx, missionID, models.PreemptedSegment{
+				SegmentID:   conflict.SegmentID,
+				PreemptedAt: now,
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// expireReservations releases the reservations on a segment whose lease ran out,
+// marks their missions stale, raises an event for each and grants the freed windows
+// to the waitlist (see releaseReservations). The caller writes the segment
+func (c *SegmentContract) expireReservations(
+	ctx RoutingContextInterface,
+	segment *models.Segment,
+	now int64,
+) ([]models.Reservation, error) {
+	_, expired, err := c.releaseReservations(ctx, segment, nil, expiredAt(now), now)
+	return expired, err
+}
+
+// expireMatching drops the expired reservations matching the predicate, marks their
+// missions stale and raises an event for each. Only releaseReservations calls it,
+// so the freed windows are granted to the waitlist
+func (c *SegmentContract) expireMatching(
+	ctx RoutingContextInterface,
+	segment *models.Segment,
+	match func(models.Reservation) bool,
+) ([]models.Reservation, error) {
+	expired := removeReservations(segment, match)
 
-		var conflict models.Conflict
-		err = json.Unmarshal(queryResult.Value, &conflict)
+	missionContract := &MissionContract{}
+	for _, r := range expired {
+		reason := fmt.Sprintf("lease on segment %s expired at %d without renewal", segment.SegmentID, r.LeaseExpiresAt)
+		err := missionContract.markStale(ctx, r.MissionID, segment.SegmentID, reason)
 		if err != nil {
 			return nil, err
 		}
-		conflicts = append(conflicts, &conflict)
+
+		expiryEvent := map[string]interface{}{
+			"type":           models.EventReservationExpired,
+			"segmentId":      segment.SegmentID,
+			"missionId":      r.MissionID,
+			"vehicleId":      r.VehicleID,
+			"leaseExpiresAt": r.LeaseExpiresAt,
+			"reason":         reason,
+		}
+		eventJSON, _ := json.Marshal(expiryEvent)
+		ctx.RaiseEvent(models.EventReservationExpired, eventJSON)
+		ctx.Audit(models.AuditEvent{
+			EventType: models.EventReservationExpired,
+			MissionID: r.MissionID,
+			VehicleID: r.VehicleID,
+			SegmentID: segment.SegmentID,
+			Details: map[string]interface{}{
+				"leaseExpiresAt": r.LeaseExpiresAt,
+			},
+		})
 	}
 
-	return conflicts, nil
+	return expired, nil
+}
+
+// SweepExpiredReservations releases segment and intersection reservations whose lease
+// ran out, marks their missions stale and grants the freed windows to the waitlist. At most
+// maxItems reservations are released per call, stopping partway through a segment or node if
+// needed, so the transaction stays small; call again until it returns 0
+// Closures whose end time has passed are lifted on the way, and segments whose
+// scheduled closure has started are stored as blocked
+func (c *SegmentContract) SweepExpiredReservations(
+	ctx RoutingContextInterface,
+	maxItems int,
+) (int, error) {
+	if maxItems < 1 {
+		return 0, fmt.Errorf("maxItems must be at least 1")
+	}
+
+	now, err := txTimestamp(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	// Segments holding reservations, then every closure (current or scheduled)
+	sources := []struct {
+		index      string
+		attributes []string
+	}{
+		{segmentStatusIndex, []string{models.StatusReserved}},
+		{segmentStatusIndex, []string{models.StatusOccupied}},
+		{segmentClosureIndex, nil},
+	}
+
+	released := 0
+	for _, source := range sources {
+		segments, err := queryIndex[models.Segment](ctx, source.index, segmentObjectType, source.attributes...)
+		if err != nil {
+			return 0, fmt.Errorf("failed to query segments: %v", err)
+		}
+
+		for _, segment := range segments {
+			if released >= maxItems {
+				return released, nil
+			}
+			upgradeLegacySegment(segment)
+			started := closureActive(segment.Blockage, now) && segment.Status != models.StatusBlocked
+			lifted := liftEndedBlockage(segment, now)
+
+			_, expired, err := c.releaseReservations(ctx, segment, nil, atMost(maxItems-released, expiredAt(now)), now)
+			if err != nil {
+				return 0, err
+			}
+			if len(expired) == 0 && !lifted && !started {
+				continue
+			}
+			if lifted && len(expired) == 0 {
+				// The reopened road's windows go to the waitlist
+				if err := c.grantWaitlist(ctx, segment, now); err != nil {
+					return 0, err
+				}
+			}
+
+			eventType := models.EventSegmentReleased
+			if len(expired) == 0 {
+				eventType = models.EventSegmentUnblocked
+				if !lifted {
+					eventType = models.EventSegmentBlocked
+				}
+			}
+			if err := c.putSegment(ctx, segment, eventType, "", ""); err != nil {
+				return 0, err
+			}
+			released += len(expired)
+		}
+	}
+
+	nodes, err := queryIndex[models.Node](ctx, nodeStatusIndex, nodeObjectType, models.StatusReserved)
+	if err != nil {
+		return 0, fmt.Errorf("failed to query nodes: %v", err)
+	}
+	for _, listed := range nodes {
+		if released >= maxItems {
+			return released, nil
+		}
+		// Granting a waitlist may have reserved the node since it was listed
+		node, err := getNode(ctx, listed.NodeID)
+		if err != nil {
+			return 0, err
+		}
+		expired, err := expireNodeReservations(ctx, node, atMost(maxItems-released, expiredAt(now)))
+		if err != nil {
+			return 0, err
+		}
+		released += len(expired)
+	}
+
+	return released, nil
+}
+
+// writeSegment refreshes the flat summary fields and stores a segment
+func (c *SegmentContract) writeSegment(
+	ctx RoutingContextInterface,
+	segment *models.Segment,
+) ([]byte, error) {
+	now, err := txTimestamp(ctx)
+	if err != nil {
+		return nil, err
+	}
+	refreshSummary(segment, now)
+
+	segmentJSON, err := json.Marshal(segment)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal segment: %v", err)
+	}
+
+	err = putEntityState(ctx, segmentObjectType, segment.SegmentID, segmentJSON)
+	if err != nil {
+		return nil, fmt.Errorf("failed to write state: %v", err)
+	}
+
+	return segmentJSON, nil
+}
+
+// putSegment stores a segment, raises the given event with its new state and
+// audits the change against the mission and vehicle that caused it
+func (c *SegmentContract) putSegment(
+	ctx RoutingContextInterface,
+	segment *models.Segment,
+	eventType string,
+	missionID string,
+	vehicleID string,
+) error {
+	segmentJSON, err := c.writeSegment(ctx, segment)
+	if err != nil {
+		return err
+	}
+
+	ctx.RaiseEvent(eventType, segmentJSON)
+	ctx.Audit(models.AuditEvent{
+		EventType: eventType,
+		MissionID: missionID,
+		VehicleID: vehicleID,
+		SegmentID: segment.SegmentID,
+		Details:   map[string]interface{}{"status": segment.Status},
+	})
+
+	return nil
 }
 
+// GetSegmentHistory retrieves every committed version of a segment, oldest first
+// fromTime and toTime bound the transaction timestamp (inclusive); 0 leaves that side open
+func (c *SegmentContract) GetSegmentHistory(
+	ctx RoutingContextInterface,
+	segmentID string,
+	fromTime int64,
+	toTime int64,
+) ([]*models.SegmentVersion, error) {
+	versions, err := keyHistory(ctx, segmentObjectType, segmentID, fromTime, toTime)
+	if err != nil {
+		return nil, err
+	}
+
+	history := []*models.SegmentVersion{}
+	for _, v := range versions {
+		version := &models.SegmentVersion{
+			TxID:      v.txID,
+			Timestamp: v.timestamp,
+			IsDelete:  v.isDelete,
+		}
+		if !v.isDelete {
+			var segment models.Segment
+			err = json.Unmarshal(v.value, &segment)
+			if err != nil {
+				return nil, fmt.Errorf("failed to unmarshal segment version %s: %v", v.txID, err)
+			}
+			upgradeLegacySegment(&segment)
+			version.Segment = &segment
+		}
+		history = append(history, version)
+	}
+
+	return history, nil
+}
+
+// GetPendingConflicts retrieves all pending conflicts
+func (c *SegmentContract) GetPendingConflicts(
+	ctx RoutingContextInterface,
+) ([]*models.Conflict, error) {
+	conflicts, err := queryIndex[models.Conflict](ctx, conflictStatusIndex, conflictObjectType, models.ConflictPending)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query conflicts: %v", err)
+	}
+
+	return conflicts, nil
+}
@@ -0,0 +1,245 @@
+package contracts
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/emergency-routing/chaincode/routing/models"
+)
+
+// seedDirectReservations leaves S1 held by a reservation that belongs to no mission,
+// as written before reservations had to name one
+func seedDirectReservations(l *ledger, windows ...[2]int64) {
+	segment := models.Segment{SegmentID: "S1"}
+	for _, w := range windows {
+		segment.Reservations = append(segment.Reservations, models.Reservation{
+			MissionID:      "DIRECT-1",
+			VehicleID:      "AMB-9",
+			OrgType:        "medical",
+			PriorityLevel:  2,
+			Status:         models.StatusReserved,
+			EnterAt:        w[0],
+			ExitAt:         w[1],
+			ReservedAt:     l.now,
+			LeaseExpiresAt: l.now + reservationLeaseSeconds,
+		})
+	}
+	l.seedSegment(segment)
+}
+
+func TestResolveConflictWithDirectReservation(t *testing.T) {
+	for _, resolution := range []string{models.ResolutionMission1Wins, models.ResolutionMission2Wins, models.ResolutionBothReroute} {
+		t.Run(resolution, func(t *testing.T) {
+			l := newLedger(t)
+			seedDirectReservations(l, [2]int64{l.now, 0})
+			l.registerVehicle(medicalDispatcher, "AMB-1", "medical", "ambulance", 2)
+			l.startMission(medicalDispatcher, "M1", "AMB-1", "A", "B", "high", `[{"segmentId":"S1","fromNode":"A","toNode":"B"}]`)
+
+			conflicts := l.pendingConflicts()
+			if len(conflicts) != 1 || conflicts[0].Mission1ID != "DIRECT-1" {
+				t.Fatalf("want one conflict with DIRECT-1, got %+v", conflicts)
+			}
+			l.mustInvoke(medicalDispatcher, "SegmentContract:ResolveConflict", conflicts[0].ConflictID, resolution)
+
+			holders := map[string]bool{}
+			for _, r := range l.segment("S1").Reservations {
+				holders[r.MissionID] = true
+			}
+			want := map[string]map[string]bool{
+				models.ResolutionMission1Wins: {"DIRECT-1": true},
+				models.ResolutionMission2Wins: {"M1": true},
+				models.ResolutionBothReroute:  {},
+			}[resolution]
+			if fmt.Sprint(holders) != fmt.Sprint(want) {
+				t.Fatalf("S1 held by %v, want %v", holders, want)
+			}
+			if len(l.pendingConflicts()) != 0 {
+				t.Fatal("conflict is still pending")
+			}
+		})
+	}
+}
+
+func TestMission2WinsTakesOnlyTheContestedWindow(t *testing.T) {
+	l := newLedger(t)
+	start := l.now + 60
+	seedDirectReservations(l, [2]int64{start, start + 60}, [2]int64{start + 600, start + 660})
+	l.registerVehicle(medicalDispatcher, "AMB-1", "medical", "ambulance", 2)
+	l.startMission(medicalDispatcher, "M1", "AMB-1", "A", "B", "high",
+		fmt.Sprintf(`[{"segmentId":"S1","enterAt":%d,"exitAt":%d,"fromNode":"A","toNode":"B"}]`, start, start+60))
+
+	conflicts := l.pendingConflicts()
+	if len(conflicts) != 1 {
+		t.Fatalf("want one conflict, got %d", len(conflicts))
+	}
+	l.mustInvoke(medicalDispatcher, "SegmentContract:ResolveConflict", conflicts[0].ConflictID, models.ResolutionMission2Wins)
+
+	kept := map[string]int64{}
+	for _, r := range l.segment("S1").Reservations {
+		kept[r.MissionID] = r.EnterAt
+	}
+	if kept["M1"] != start {
+		t.Fatalf("M1 did not get its window: %v", kept)
+	}
+	if kept["DIRECT-1"] != start+600 {
+		t.Fatalf("DIRECT-1 lost its later, uncontested window: %v", kept)
+	}
+}
+
+func TestConflictKeepsTheMissionsOldWindow(t *testing.T) {
+	l := newLedger(t)
+	start := l.now + 60
+	seedDirectReservations(l, [2]int64{start + 600, start + 660})
+	l.registerVehicle(medicalDispatcher, "AMB-1", "medical", "ambulance", 2)
+	l.startMission(medicalDispatcher, "M1", "AMB-1", "A", "B", "high",
+		fmt.Sprintf(`[{"segmentId":"S1","enterAt":%d,"exitAt":%d,"fromNode":"A","toNode":"B"}]`, start, start+60))
+
+	// An expired reservation makes the conflicting request write the segment
+	segment := l.segment("S1")
+	segment.Reservations = append(segment.Reservations, models.Reservation{
+		MissionID:      "GONE-1",
+		VehicleID:      "AMB-8",
+		OrgType:        "medical",
+		PriorityLevel:  2,
+		Status:         models.StatusReserved,
+		EnterAt:        start + 1000,
+		ExitAt:         start + 1060,
+		LeaseExpiresAt: l.now - 1,
+	})
+	l.seedSegment(segment)
+
+	priority := fmt.Sprint(l.mission("M1").PriorityLevel)
+	l.mustInvoke(medicalDispatcher, "SegmentContract:ReserveSegment", "S1", "AMB-1", "M1", priority,
+		fmt.Sprint(start+600), fmt.Sprint(start+660), "A")
+	if len(l.pendingConflicts()) != 1 {
+		t.Fatal("moving M1's window onto DIRECT-1's should open a conflict")
+	}
+
+	kept := map[string]int64{}
+	for _, r := range l.segment("S1").Reservations {
+		kept[r.MissionID] = r.EnterAt
+	}
+	if kept["M1"] != start {
+		t.Fatalf("M1 should keep its old window while the conflict is open, S1 holds %v", kept)
+	}
+	if _, ok := kept["GONE-1"]; ok {
+		t.Fatalf("the expired reservation should have been released, S1 holds %v", kept)
+	}
+
+	// Losing the conflict loses the segment, old window included
+	l.mustInvoke(medicalDispatcher, "SegmentContract:ResolveConflict", l.pendingConflicts()[0].ConflictID, models.ResolutionMission1Wins)
+	for _, r := range l.segment("S1").Reservations {
+		if r.MissionID == "M1" {
+			t.Fatalf("M1 lost S1 but still holds %+v", r)
+		}
+	}
+}
+
+func TestPreemptionFlagsTheVictim(t *testing.T) {
+	l := newLedger(t)
+	l.registerVehicle(policeDispatcher, "POL-1", "police", "patrol_car", 3)
+	l.registerVehicle(medicalDispatcher, "AMB-1", "medical", "ambulance", 1)
+	l.startMission(policeDispatcher, "P1", "POL-1", "A", "B", "low", `[{"segmentId":"S1","fromNode":"A","toNode":"B"}]`)
+	l.now += 30
+	l.startMission(medicalDispatcher, "M1", "AMB-1", "A", "B", "critical", `[{"segmentId":"S1","fromNode":"A","toNode":"B"}]`)
+
+	if holders := l.segment("S1").Reservations; len(holders) != 1 || holders[0].MissionID != "M1" {
+		t.Fatalf("S1 should be held by M1 alone, got %+v", holders)
+	}
+	if status := l.mission("P1").Status; status != models.MissionNeedsReroute {
+		t.Fatalf("P1 is %s, want %s", status, models.MissionNeedsReroute)
+	}
+
+	var preempted []models.PreemptedSegment
+	if err := json.Unmarshal([]byte(l.mustInvoke(policeDispatcher, "MissionContract:GetPreemptedSegments", "P1")), &preempted); err != nil {
+		t.Fatalf("failed to decode preempted segments: %v", err)
+	}
+	var lost *models.PreemptedSegment
+	for i := range preempted {
+		if preempted[i].SegmentID == "S1" {
+			lost = &preempted[i]
+		}
+	}
+	if lost == nil {
+		t.Fatalf("S1 missing from P1's preempted segments %+v", preempted)
+	}
+	want := models.PreemptedSegment{
+		SegmentID:     "S1",
+		ByMissionID:   "M1",
+		ByVehicleID:   "AMB-1",
+		PriorityLevel: l.mission("M1").PriorityLevel,
+		PreemptedAt:   l.now,
+	}
+	if *lost != want {
+		t.Fatalf("P1 lost S1 as %+v, want %+v", *lost, want)
+	}
+}
+
+func TestSweepStopsPartwayThroughSegment(t *testing.T) {
+	l := newLedger(t)
+	segment := models.Segment{SegmentID: "S1"}
+	for i := 0; i < 3; i++ {
+		segment.Reservations = append(segment.Reservations, models.Reservation{
+			MissionID:      fmt.Sprintf("DIRECT-%d", i),
+			VehicleID:      fmt.Sprintf("AMB-%d", i),
+			OrgType:        "medical",
+			PriorityLevel:  3,
+			Status:         models.StatusReserved,
+			EnterAt:        l.now + int64(i)*100,
+			ExitAt:         l.now + int64(i)*100 + 60,
+			ReservedAt:     l.now,
+			LeaseExpiresAt: l.now + 10,
+		})
+	}
+	l.seedSegment(segment)
+	l.now += 20
+
+	for _, want := range []string{"2", "1", "0"} {
+		if got := l.mustInvoke(medicalDispatcher, "SegmentContract:SweepExpiredReservations", "2"); got != want {
+			t.Fatalf("sweep released %s reservations, want %s", got, want)
+		}
+	}
+	if left := l.segment("S1").Reservations; len(left) != 0 {
+		t.Fatalf("S1 still holds %d expired reservations", len(left))
+	}
+}
+
+func TestReserveSegmentChecksMissionAndPriority(t *testing.T) {
+	l := newLedger(t)
+	l.registerVehicle(medicalDispatcher, "AMB-1", "medical", "ambulance", 1)
+	l.registerVehicle(policeDispatcher, "POL-1", "police", "patrol_car", 3)
+	l.registerVehicle(policeDispatcher, "POL-2", "police", "patrol_car", 3)
+	l.startMission(medicalDispatcher, "M1", "AMB-1", "A", "B", "critical", `[{"segmentId":"S1","fromNode":"A","toNode":"B"}]`)
+	l.startMission(policeDispatcher, "P1", "POL-1", "C", "D", "low", `[{"segmentId":"S9","fromNode":"C","toNode":"D"}]`)
+	l.mustInvoke(policeDispatcher, "MissionContract:CreateMission", "P2", "POL-2", "C", "D", "low", "")
+
+	for _, request := range []struct {
+		fn    string
+		nodes []string
+	}{
+		{"SegmentContract:ReserveSegment", []string{""}},
+		{"SegmentContract:QueueSegment", []string{"A", "B"}},
+	} {
+		for _, tc := range []struct {
+			vehicleID, missionID, priority, want string
+		}{
+			{"POL-1", "FAKE", "-3", "between 1 and 5"},
+			{"POL-1", "P1", "0", "between 1 and 5"},
+			{"POL-1", "P1", "6", "between 1 and 5"},
+			{"POL-1", "FAKE", "3", "does not exist"},
+			{"AMB-1", "M1", "1", "belongs to another organization"},
+			{"POL-2", "P2", "5", "is not active"},
+			{"AMB-1", "P1", "5", "is assigned to vehicle POL-1"},
+			{"POL-1", "P1", "1", "exceeds mission P1 priority"},
+		} {
+			args := append([]string{"S1", tc.vehicleID, tc.missionID, tc.priority, "0", "0"}, request.nodes...)
+			l.mustFail(policeDispatcher, tc.want, request.fn, args...)
+		}
+	}
+
+	if holders := l.segment("S1").Reservations; len(holders) != 1 || holders[0].MissionID != "M1" {
+		t.Fatalf("S1 should still be held by M1 alone, got %+v", holders)
+	}
+	l.mustInvoke(policeDispatcher, "SegmentContract:ReserveSegment", "S8", "POL-1", "P1", "5", "0", "0", "")
+}
@@ -0,0 +1,63 @@
+package contracts
+
+import (
+	"fmt"
+
+	"github.com/emergency-routing/chaincode/routing/models"
+)
+
+// couchIndex is a CouchDB index declared in META-INF/statedb/couchdb/indexes
+// The peer creates the indexes when the chaincode is installed; this table must match those files
+// The chaincode itself runs no rich queries (lists use the composite key indexes in
+// indexes.go), so these serve clients that query the state database directly: the
+// backend's Mango queries (backend/src/services/couchdb) and audit reporting
+type couchIndex struct {
+	name   string   // Index name; its design document is name + "Doc"
+	fields []string // Indexed fields, all of which must appear in a selector using it
+}
+
+var couchIndexes = []couchIndex{
+	{name: "indexDocType", fields: []string{"docType"}},
+	{name: "indexStatus", fields: []string{"docType", "status"}},
+	{name: "indexOrgType", fields: []string{"docType", "orgType"}},
+	{name: "indexVehicleStatus", fields: []string{"docType", "vehicleId", "status"}},
+	{name: "indexMission", fields: []string{"docType", "missionId"}},
+	{name: "indexVehicle", fields: []string{"docType", "vehicleId"}},
+	{name: "indexSegment", fields: []string{"docType", "segmentId"}},
+	{name: "indexActor", fields: []string{"docType", "actorId"}},
+	{name: "indexTimestamp", fields: []string{"docType", "timestamp"}},
+}
+
+// checkSegmentStatus rejects anything but a known segment status
+func checkSegmentStatus(status string) error {
+	switch status {
+	case models.StatusFree, models.StatusReserved, models.StatusOccupied, models.StatusBlocked:
+		return nil
+	}
+	return fmt.Errorf("invalid segment status: %s", status)
+}
+
+// checkMissionStatus rejects anything but a known mission status
+func checkMissionStatus(status string) error {
+	switch status {
+	case models.MissionPending, models.MissionActive, models.MissionNeedsReroute,
+		models.MissionStale, models.MissionCompleted, models.MissionAborted:
+		return nil
+	}
+	return fmt.Errorf("invalid mission status: %s", status)
+}
+
+// checkOrgType rejects an org type that no organization in the registry uses
+func checkOrgType(ctx RoutingContextInterface, orgType string) error {
+	orgs, err := getAllOrganizations(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, org := range orgs {
+		if org.OrgType == orgType {
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid org type: %s", orgType)
+}
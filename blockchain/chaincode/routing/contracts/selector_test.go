@@ -0,0 +1,145 @@
+package contracts
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+)
+
+const (
+	indexDir       = "../META-INF/statedb/couchdb/indexes"
+	backendQueries = "../../../../backend/src/services/couchdb/index.ts"
+)
+
+// mangoSelectors lists the fields of every Mango selector run against the state database
+var mangoSelectors = [][]string{
+	// backend/src/services/couchdb
+	{"docType"},
+	{"docType", "status"},
+	{"docType", "orgType"},
+	// Audit reporting
+	{"docType", "missionId"},
+	{"docType", "vehicleId"},
+	{"docType", "segmentId"},
+	{"docType", "actorId"},
+	{"docType", "timestamp"},
+	// Missions of a vehicle in a given status
+	{"docType", "vehicleId", "status"},
+}
+
+// indexFile is the layout of a CouchDB index definition
+type indexFile struct {
+	Index struct {
+		Fields []string `json:"fields"`
+	} `json:"index"`
+	Ddoc string `json:"ddoc"`
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// readIndexFiles returns the index definitions shipped with the chaincode, by name
+func readIndexFiles(t *testing.T) map[string]indexFile {
+	t.Helper()
+
+	paths, err := filepath.Glob(filepath.Join(indexDir, "*.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]indexFile{}
+	for _, path := range paths {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var index indexFile
+		if err := json.Unmarshal(content, &index); err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+		if index.Name+".json" != filepath.Base(path) || index.Ddoc != index.Name+"Doc" || index.Type != "json" || len(index.Index.Fields) == 0 {
+			t.Fatalf("%s: malformed index definition %+v", path, index)
+		}
+		files[index.Name] = index
+	}
+	return files
+}
+
+// sameFields reports whether two field lists hold the same fields
+func sameFields(a []string, b []string) bool {
+	a = append([]string{}, a...)
+	b = append([]string{}, b...)
+	sort.Strings(a)
+	sort.Strings(b)
+	return strings.Join(a, ",") == strings.Join(b, ",")
+}
+
+func TestCouchIndexesMatchIndexFiles(t *testing.T) {
+	files := readIndexFiles(t)
+	if len(files) != len(couchIndexes) {
+		t.Fatalf("%d index files but %d entries in couchIndexes", len(files), len(couchIndexes))
+	}
+	for _, index := range couchIndexes {
+		file, ok := files[index.name]
+		if !ok {
+			t.Fatalf("couchIndexes entry %s has no index file", index.name)
+		}
+		if strings.Join(file.Index.Fields, ",") != strings.Join(index.fields, ",") {
+			t.Fatalf("%s: couchIndexes fields %v, file fields %v", index.name, index.fields, file.Index.Fields)
+		}
+	}
+}
+
+func TestEverySelectorHasAnIndex(t *testing.T) {
+	files := readIndexFiles(t)
+	for _, selector := range mangoSelectors {
+		found := false
+		for _, index := range couchIndexes {
+			if sameFields(index.fields, selector) {
+				if _, ok := files[index.name]; !ok {
+					t.Fatalf("selector %v: index %s has no index file", selector, index.name)
+				}
+				found = true
+			}
+		}
+		if !found {
+			t.Fatalf("selector %v is not matched by any entry in couchIndexes", selector)
+		}
+	}
+}
+
+func TestBackendSelectorsAreListed(t *testing.T) {
+	source, err := os.ReadFile(backendQueries)
+	if os.IsNotExist(err) {
+		t.Skip("backend sources are not checked out next to the chaincode")
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	calls := regexp.MustCompile(`queryDocuments<\w+>\(\{([^}]*)\}\)`).FindAllStringSubmatch(string(source), -1)
+	if len(calls) == 0 {
+		t.Fatalf("no queryDocuments calls found in %s", backendQueries)
+	}
+	for _, call := range calls {
+		fields := []string{}
+		for _, property := range strings.Split(call[1], ",") {
+			field := strings.TrimSpace(strings.SplitN(property, ":", 2)[0])
+			if field != "" {
+				fields = append(fields, field)
+			}
+		}
+
+		listed := false
+		for _, selector := range mangoSelectors {
+			if sameFields(selector, fields) {
+				listed = true
+			}
+		}
+		if !listed {
+			t.Fatalf("backend selector %v is missing from mangoSelectors", fields)
+		}
+	}
+}
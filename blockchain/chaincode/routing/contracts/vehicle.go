@@ -3,7 +3,6 @@ package contracts
 import (
 	"encoding/json"
 	"fmt"
-	"time"
 
 	"github.com/emergency-routing/chaincode/routing/models"
 	"github.com/hyperledger/fabric-contract-api-go/contractapi"
@@ -16,7 +15,7 @@ type VehicleContract struct {
 
 // RegisterVehicle creates a new emergency vehicle in the system
 func (c *VehicleContract) RegisterVehicle(
-	ctx contractapi.TransactionContextInterface,
+	ctx RoutingContextInterface,
 	vehicleID string,
 	orgType string,
 	vehicleType string,
@@ -26,15 +25,12 @@ func (c *VehicleContract) RegisterVehicle(
 	if vehicleID == "" {
 		return fmt.Errorf("vehicle ID cannot be empty")
 	}
-	if orgType != "medical" && orgType != "police" {
-		return fmt.Errorf("invalid org type: must be 'medical' or 'police'")
-	}
 	if priorityLevel < 1 || priorityLevel > 5 {
 		return fmt.Errorf("priority level must be between 1 and 5")
 	}
 
 	// Check if vehicle already exists
-	existingJSON, err := ctx.GetStub().GetState(vehicleID)
+	existingJSON, err := getEntityState(ctx, vehicleObjectType, vehicleID)
 	if err != nil {
 		return fmt.Errorf("failed to read state: %v", err)
 	}
@@ -42,35 +38,34 @@ func (c *VehicleContract) RegisterVehicle(
 		return fmt.Errorf("vehicle %s already exists", vehicleID)
 	}
 
-	// Get caller identity
-	clientIdentity := ctx.GetClientIdentity()
-	mspID, err := clientIdentity.GetMSPID()
+	// Verify caller belongs to the correct organization
+	callerOrg, err := resolveCallerOrg(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to get MSP ID: %v", err)
+		return err
 	}
-
-	// Verify caller belongs to the correct organization
-	expectedMSP := ""
-	switch orgType {
-	case "medical":
-		expectedMSP = "MedicalMSP"
-	case "police":
-		expectedMSP = "PoliceMSP"
-	}
-	if mspID != expectedMSP {
+	mspID := callerOrg.MSPID
+	if callerOrg.OrgType != orgType {
 		return fmt.Errorf("access denied: %s cannot register vehicles for %s organization", mspID, orgType)
 	}
+	if err := checkVehicleAllowed(callerOrg, vehicleType, priorityLevel); err != nil {
+		return err
+	}
+
+	now, err := txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
 
 	// Create vehicle object
 	vehicle := models.Vehicle{
-		DocType:       "vehicle",
+		DocType:       models.DocTypeVehicle,
 		VehicleID:     vehicleID,
 		OrgType:       orgType,
 		VehicleType:   vehicleType,
 		PriorityLevel: priorityLevel,
 		Status:        models.StatusActive,
 		RegisteredBy:  mspID,
-		RegisteredAt:  time.Now().Unix(),
+		RegisteredAt:  now,
 	}
 
 	// Serialize and store
@@ -79,23 +74,31 @@ func (c *VehicleContract) RegisterVehicle(
 		return fmt.Errorf("failed to marshal vehicle: %v", err)
 	}
 
-	err = ctx.GetStub().PutState(vehicleID, vehicleJSON)
+	err = putEntityState(ctx, vehicleObjectType, vehicleID, vehicleJSON)
 	if err != nil {
 		return fmt.Errorf("failed to write state: %v", err)
 	}
 
-	// Emit event
-	ctx.GetStub().SetEvent(models.EventVehicleRegistered, vehicleJSON)
+	// Raise event
+	ctx.RaiseEvent(models.EventVehicleRegistered, vehicleJSON)
+	ctx.Audit(models.AuditEvent{
+		EventType: models.EventVehicleRegistered,
+		VehicleID: vehicleID,
+		Details: map[string]interface{}{
+			"vehicleType":   vehicleType,
+			"priorityLevel": priorityLevel,
+		},
+	})
 
 	return nil
 }
 
 // GetVehicle retrieves a vehicle by ID
 func (c *VehicleContract) GetVehicle(
-	ctx contractapi.TransactionContextInterface,
+	ctx RoutingContextInterface,
 	vehicleID string,
 ) (*models.Vehicle, error) {
-	vehicleJSON, err := ctx.GetStub().GetState(vehicleID)
+	vehicleJSON, err := getEntityState(ctx, vehicleObjectType, vehicleID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read state: %v", err)
 	}
@@ -108,75 +111,79 @@ func (c *VehicleContract) GetVehicle(
 	if err != nil {
 		return nil, fmt.Errorf("failed to unmarshal vehicle: %v", err)
 	}
+	if err := checkDocType(vehicleID, vehicle.DocType, models.DocTypeVehicle); err != nil {
+		return nil, err
+	}
 
 	return &vehicle, nil
 }
 
 // GetAllVehicles retrieves all vehicles in the system
 func (c *VehicleContract) GetAllVehicles(
-	ctx contractapi.TransactionContextInterface,
+	ctx RoutingContextInterface,
 ) ([]*models.Vehicle, error) {
-	// CouchDB query to find all vehicles
-	queryString := `{"selector":{"docType":"vehicle"}}`
-
-	resultsIterator, err := ctx.GetStub().GetQueryResult(queryString)
+	vehicles, err := getAllEntities[models.Vehicle](ctx, vehicleObjectType)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query vehicles: %v", err)
 	}
-	defer resultsIterator.Close()
 
-	var vehicles []*models.Vehicle
-	for resultsIterator.HasNext() {
-		queryResult, err := resultsIterator.Next()
-		if err != nil {
-			return nil, err
-		}
+	return vehicles, nil
+}
 
-		var vehicle models.Vehicle
-		err = json.Unmarshal(queryResult.Value, &vehicle)
-		if err != nil {
-			return nil, err
-		}
-		vehicles = append(vehicles, &vehicle)
+// GetAllVehiclesWithPagination retrieves one page of vehicles in ID order
+// bookmark is empty for the first page, then the bookmark of the previous page
+func (c *VehicleContract) GetAllVehiclesWithPagination(
+	ctx RoutingContextInterface,
+	pageSize int32,
+	bookmark string,
+) (*models.VehiclePage, error) {
+	page, err := rangePage[models.Vehicle](ctx, vehicleObjectType, pageSize, bookmark)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query vehicles: %v", err)
 	}
 
-	return vehicles, nil
+	return &models.VehiclePage{Records: page.records, Bookmark: page.bookmark, FetchedCount: page.fetchedCount}, nil
 }
 
 // GetVehiclesByOrg retrieves all vehicles for a specific organization
 func (c *VehicleContract) GetVehiclesByOrg(
-	ctx contractapi.TransactionContextInterface,
+	ctx RoutingContextInterface,
 	orgType string,
 ) ([]*models.Vehicle, error) {
-	queryString := fmt.Sprintf(`{"selector":{"docType":"vehicle","orgType":"%s"}}`, orgType)
+	if err := checkOrgType(ctx, orgType); err != nil {
+		return nil, err
+	}
 
-	resultsIterator, err := ctx.GetStub().GetQueryResult(queryString)
+	vehicles, err := queryIndex[models.Vehicle](ctx, vehicleOrgIndex, vehicleObjectType, orgType)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query vehicles: %v", err)
 	}
-	defer resultsIterator.Close()
 
-	var vehicles []*models.Vehicle
-	for resultsIterator.HasNext() {
-		queryResult, err := resultsIterator.Next()
-		if err != nil {
-			return nil, err
-		}
+	return vehicles, nil
+}
 
-		var vehicle models.Vehicle
-		err = json.Unmarshal(queryResult.Value, &vehicle)
-		if err != nil {
-			return nil, err
-		}
-		vehicles = append(vehicles, &vehicle)
+// GetVehiclesByOrgWithPagination retrieves one page of an organization's vehicles
+func (c *VehicleContract) GetVehiclesByOrgWithPagination(
+	ctx RoutingContextInterface,
+	orgType string,
+	pageSize int32,
+	bookmark string,
+) (*models.VehiclePage, error) {
+	if err := checkOrgType(ctx, orgType); err != nil {
+		return nil, err
 	}
 
-	return vehicles, nil
+	page, err := queryIndexPage[models.Vehicle](ctx, vehicleOrgIndex, vehicleObjectType, []string{orgType}, pageSize, bookmark)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query vehicles: %v", err)
+	}
+
+	return &models.VehiclePage{Records: page.records, Bookmark: page.bookmark, FetchedCount: page.fetchedCount}, nil
 }
 
 // UpdateVehicleStatus updates the status of a vehicle
 func (c *VehicleContract) UpdateVehicleStatus(
-	ctx contractapi.TransactionContextInterface,
+	ctx RoutingContextInterface,
 	vehicleID string,
 	status string,
 ) error {
@@ -197,21 +204,31 @@ func (c *VehicleContract) UpdateVehicleStatus(
 	}
 
 	// Check authorization - only same org can update
-	clientIdentity := ctx.GetClientIdentity()
-	mspID, _ := clientIdentity.GetMSPID()
-
-	expectedMSP := ""
-	switch vehicle.OrgType {
-	case "medical":
-		expectedMSP = "MedicalMSP"
-	case "police":
-		expectedMSP = "PoliceMSP"
+	callerOrg, err := resolveCallerOrg(ctx)
+	if err != nil {
+		return err
 	}
-	if mspID != expectedMSP {
+	if callerOrg.OrgType != vehicle.OrgType {
 		return fmt.Errorf("access denied: cannot update vehicle from different organization")
 	}
+	if err := requireVehicleAccess(ctx, vehicleID); err != nil {
+		return err
+	}
+
+	return c.setVehicleStatus(ctx, vehicle, status)
+}
+
+// setVehicleStatus stores a vehicle's new status without checking who asked
+// Used directly when a transaction of one org moves the vehicle of another (convoys)
+func (c *VehicleContract) setVehicleStatus(
+	ctx RoutingContextInterface,
+	vehicle *models.Vehicle,
+	status string,
+) error {
+	vehicleID := vehicle.VehicleID
 
 	// Update status
+	previousStatus := vehicle.Status
 	vehicle.Status = status
 
 	// Serialize and store
@@ -220,20 +237,28 @@ func (c *VehicleContract) UpdateVehicleStatus(
 		return fmt.Errorf("failed to marshal vehicle: %v", err)
 	}
 
-	err = ctx.GetStub().PutState(vehicleID, vehicleJSON)
+	err = putEntityState(ctx, vehicleObjectType, vehicleID, vehicleJSON)
 	if err != nil {
 		return fmt.Errorf("failed to write state: %v", err)
 	}
 
-	// Emit event
-	ctx.GetStub().SetEvent(models.EventVehicleUpdated, vehicleJSON)
+	// Raise event
+	ctx.RaiseEvent(models.EventVehicleUpdated, vehicleJSON)
+	ctx.Audit(models.AuditEvent{
+		EventType: models.EventVehicleUpdated,
+		VehicleID: vehicleID,
+		Details: map[string]interface{}{
+			"previousStatus": previousStatus,
+			"status":         status,
+		},
+	})
 
 	return nil
 }
 
 // UpdateVehiclePriority updates the priority level of a vehicle
 func (c *VehicleContract) UpdateVehiclePriority(
-	ctx contractapi.TransactionContextInterface,
+	ctx RoutingContextInterface,
 	vehicleID string,
 	priorityLevel int,
 ) error {
@@ -249,21 +274,19 @@ func (c *VehicleContract) UpdateVehiclePriority(
 	}
 
 	// Check authorization - only same org can update
-	clientIdentity := ctx.GetClientIdentity()
-	mspID, _ := clientIdentity.GetMSPID()
-
-	expectedMSP := ""
-	switch vehicle.OrgType {
-	case "medical":
-		expectedMSP = "MedicalMSP"
-	case "police":
-		expectedMSP = "PoliceMSP"
+	callerOrg, err := resolveCallerOrg(ctx)
+	if err != nil {
+		return err
 	}
-	if mspID != expectedMSP {
+	if callerOrg.OrgType != vehicle.OrgType {
 		return fmt.Errorf("access denied: cannot update vehicle from different organization")
 	}
+	if err := checkPriorityAllowed(callerOrg, priorityLevel); err != nil {
+		return err
+	}
 
 	// Update priority
+	previousPriority := vehicle.PriorityLevel
 	vehicle.PriorityLevel = priorityLevel
 
 	// Serialize and store
@@ -272,23 +295,65 @@ func (c *VehicleContract) UpdateVehiclePriority(
 		return fmt.Errorf("failed to marshal vehicle: %v", err)
 	}
 
-	err = ctx.GetStub().PutState(vehicleID, vehicleJSON)
+	err = putEntityState(ctx, vehicleObjectType, vehicleID, vehicleJSON)
 	if err != nil {
 		return fmt.Errorf("failed to write state: %v", err)
 	}
 
-	// Emit event
-	ctx.GetStub().SetEvent(models.EventVehicleUpdated, vehicleJSON)
+	// Raise event
+	ctx.RaiseEvent(models.EventVehicleUpdated, vehicleJSON)
+	ctx.Audit(models.AuditEvent{
+		EventType: models.EventVehicleUpdated,
+		VehicleID: vehicleID,
+		Details: map[string]interface{}{
+			"previousPriorityLevel": previousPriority,
+			"priorityLevel":         priorityLevel,
+		},
+	})
 
 	return nil
 }
 
+// GetVehicleHistory retrieves every committed version of a vehicle, oldest first
+// fromTime and toTime bound the transaction timestamp (inclusive); 0 leaves that side open
+func (c *VehicleContract) GetVehicleHistory(
+	ctx RoutingContextInterface,
+	vehicleID string,
+	fromTime int64,
+	toTime int64,
+) ([]*models.VehicleVersion, error) {
+	versions, err := keyHistory(ctx, vehicleObjectType, vehicleID, fromTime, toTime)
+	if err != nil {
+		return nil, err
+	}
+
+	history := []*models.VehicleVersion{}
+	for _, v := range versions {
+		version := &models.VehicleVersion{
+			TxID:      v.txID,
+			Timestamp: v.timestamp,
+			IsDelete:  v.isDelete,
+		}
+		if !v.isDelete {
+			var vehicle models.Vehicle
+			err = json.Unmarshal(v.value, &vehicle)
+			if err != nil {
+				return nil, fmt.Errorf("failed to unmarshal vehicle version %s: %v", v.txID, err)
+			}
+			version.Vehicle = &vehicle
+		}
+		history = append(history, version)
+	}
+
+	return history, nil
+}
+
 // VehicleExists checks if a vehicle exists
 func (c *VehicleContract) VehicleExists(
-	ctx contractapi.TransactionContextInterface,
+	ctx RoutingContextInterface,
 	vehicleID string,
 ) (bool, error) {
-	vehicleJSON, err := ctx.GetStub().GetState(vehicleID)
+	vehicleJSON, err := getEntityState(ctx, vehicleObjectType, vehicleID)
 	if err != nil {
 		return false, fmt.Errorf("failed to read state: %v", err)
 	}
@@ -0,0 +1,389 @@
+package contracts
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/emergency-routing/chaincode/routing/models"
+)
+
+// QueueSegment requests a segment window like ReserveSegment, except that a request
+// denied for lower priority joins the segment's waitlist instead of failing.
+// Queued requests are ordered by priority, then arrival, and are granted in the
+// transaction that frees their window (any release or lease expiry, see
+// releaseReservations), with an event naming the new holder.
+// A queued request gives both endpoints and must close a gap in the mission's route
+// ahead of the vehicle (or re-time a step on it, see routeSlot): once granted, the step
+// joins the mission's path and the mission holds its intersections.
+// A nil conflict means the window was either reserved or queued (see Segment.Waitlist)
+// The request is validated like ReserveSegment's
+func (c *SegmentContract) QueueSegment(
+	ctx RoutingContextInterface,
+	segmentID string,
+	vehicleID string,
+	missionID string,
+	priorityLevel int,
+	enterAt int64,
+	exitAt int64,
+	fromNode string,
+	toNode string,
+) (*models.Conflict, error) {
+	mission, err := checkReservationRequest(ctx, missionID, vehicleID, priorityLevel)
+	if err != nil {
+		return nil, err
+	}
+	if fromNode == "" || toNode == "" {
+		return nil, fmt.Errorf("a queued request needs both fromNode and toNode")
+	}
+	step := models.PathSegment{SegmentID: segmentID, FromNode: fromNode, ToNode: toNode}
+	if slot, _ := routeSlot(mission, step); slot < 0 {
+		return nil, fmt.Errorf("segment %s from %s to %s does not connect to the route of mission %s", segmentID, fromNode, toNode, missionID)
+	}
+
+	return c.reserveSegment(ctx, segmentID, vehicleID, missionID, mission.OrgType, priorityLevel, enterAt, exitAt, fromNode, toNode, true)
+}
+
+// enqueue adds a denied request to a segment's waitlist, behind queued requests
+// of the same or higher priority, and stores the segment. The request's
+// intersections note that it waits for them (see grantQueuedOn)
+func (c *SegmentContract) enqueue(
+	ctx RoutingContextInterface,
+	segment *models.Segment,
+	request models.Reservation,
+) error {
+	request.Status = models.StatusQueued
+	request.LeaseExpiresAt = 0
+
+	segment.Waitlist = append(segment.Waitlist, request)
+	sortWaitlist(segment)
+
+	for _, nodeID := range []string{request.Direction, request.ToNode} {
+		if err := waitOnNode(ctx, nodeID, segment.SegmentID); err != nil {
+			return err
+		}
+	}
+
+	return c.putSegment(ctx, segment, models.EventSegmentQueued, request.MissionID, request.VehicleID)
+}
+
+// releaseReservations drops the reservations on a segment that match, and those whose
+// lease ran out that expire matches (marking their missions stale, see expireMatching),
+// then grants the windows they freed to the waitlist. Every release and expiry goes
+// through here so a freed window never sits idle while requests wait for it; either
+// predicate may be nil. Returns the released and the expired reservations.
+// The caller writes the segment
+func (c *SegmentContract) releaseReservations(
+	ctx RoutingContextInterface,
+	segment *models.Segment,
+	match func(models.Reservation) bool,
+	expire func(models.Reservation) bool,
+	now int64,
+) ([]models.Reservation, []models.Reservation, error) {
+	var expired []models.Reservation
+	if expire != nil {
+		var err error
+		if expired, err = c.expireMatching(ctx, segment, expire); err != nil {
+			return nil, nil, err
+		}
+	}
+	var released []models.Reservation
+	if match != nil {
+		released = removeReservations(segment, match)
+	}
+
+	if len(released) > 0 || len(expired) > 0 {
+		if err := c.grantWaitlist(ctx, segment, now); err != nil {
+			return nil, nil, err
+		}
+	}
+	return released, expired, nil
+}
+
+// grantWaitlist reserves every queued window that now fits on a segment, highest
+// priority first, and raises an event naming each new holder. A request waits until
+// both the segment and the intersections at its ends are free for it; the step then
+// joins the mission's path (see routeSlot) and the mission holds those intersections.
+// Requests whose window has passed, whose mission is no longer underway or whose step
+// no longer connects to the mission's route are dropped. The caller writes the segment
+func (c *SegmentContract) grantWaitlist(
+	ctx RoutingContextInterface,
+	segment *models.Segment,
+	now int64,
+) error {
+	missionContract := &MissionContract{}
+	waiting := []models.Reservation{}
+	for _, request := range segment.Waitlist {
+		if request.ExitAt != 0 && request.ExitAt <= now {
+			continue
+		}
+		mission, err := queuedMission(ctx, request.MissionID)
+		if err != nil {
+			return err
+		}
+		if mission != nil && !isMissionUnderway(mission.Status) {
+			continue
+		}
+
+		// Still waiting while the road is closed or every lane in its direction is taken
+		_, sameWay := splitReservations(overlappingReservations(segment, request.EnterAt, request.ExitAt), sameDirection(request.Direction))
+		overlapping, err := outsideConvoy(ctx, request.MissionID, sameWay)
+		if err != nil {
+			return err
+		}
+		if checkOpen(segment, request.EnterAt, request.ExitAt) != nil || len(contenders(overlapping, segmentCapacity(segment))) > 0 {
+			waiting = append(waiting, request)
+			continue
+		}
+
+		// The step must still connect to the mission's route, and the intersections
+		// it adds be free for it too
+		step := models.PathSegment{
+			SegmentID: segment.SegmentID,
+			EnterAt:   request.EnterAt,
+			ExitAt:    request.ExitAt,
+			FromNode:  request.Direction,
+			ToNode:    request.ToNode,
+		}
+		slot, onRoute := -1, false
+		var windows []nodeWindow
+		if mission != nil {
+			if slot, onRoute = routeSlot(mission, step); slot < 0 {
+				continue
+			}
+			if !onRoute {
+				if windows, err = slotNodes(mission, slot, step); err != nil {
+					return err
+				}
+			}
+			free, err := nodesFree(ctx, request.MissionID, windows, now)
+			if err != nil {
+				return err
+			}
+			if !free {
+				waiting = append(waiting, request)
+				continue
+			}
+		}
+
+		queuedAt := request.ReservedAt
+		request.Status = models.StatusReserved
+		request.ReservedAt = now
+		request.LeaseExpiresAt = now + reservationLeaseSeconds
+		segment.Reservations = append(segment.Reservations, request)
+
+		// The mission now holds the step: it is renewed and released with the rest of its path
+		nodes := []string{}
+		for _, w := range windows {
+			_, err := c.reserveNode(ctx, w.nodeID, request.VehicleID, request.MissionID, request.OrgType,
+				request.PriorityLevel, w.enterAt, w.exitAt, w.via, w.direction)
+			if err != nil {
+				return fmt.Errorf("failed to reserve intersection %s: %v", w.nodeID, err)
+			}
+			nodes = append(nodes, w.nodeID)
+		}
+		if mission != nil {
+			err = missionContract.updateUnderwayMission(ctx, request.MissionID, func(mission *models.Mission) {
+				insertStep(mission, slot, onRoute, step)
+				for _, nodeID := range nodes {
+					removeNode(mission, nodeID)
+				}
+				mission.Nodes = append(mission.Nodes, nodes...)
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		// Raise event
+		grantEvent := map[string]interface{}{
+			"type":          models.EventWaitlistGranted,
+			"segmentId":     segment.SegmentID,
+			"missionId":     request.MissionID,
+			"vehicleId":     request.VehicleID,
+			"priorityLevel": request.PriorityLevel,
+			"enterAt":       request.EnterAt,
+			"exitAt":        request.ExitAt,
+			"queuedAt":      queuedAt,
+		}
+		eventJSON, _ := json.Marshal(grantEvent)
+		ctx.RaiseEvent(models.EventWaitlistGranted, eventJSON)
+		ctx.Audit(models.AuditEvent{
+			EventType: models.EventWaitlistGranted,
+			MissionID: request.MissionID,
+			VehicleID: request.VehicleID,
+			SegmentID: segment.SegmentID,
+			Details: map[string]interface{}{
+				"enterAt":  request.EnterAt,
+				"exitAt":   request.ExitAt,
+				"queuedAt": queuedAt,
+				"nodes":    nodes,
+			},
+		})
+	}
+	segment.Waitlist = waiting
+
+	return nil
+}
+
+// grantQueuedOn retries the waitlists of the segments whose queued requests wait for
+// an intersection, once it has been released, and forgets the segments that no
+// longer have a request waiting for it
+func (c *SegmentContract) grantQueuedOn(ctx RoutingContextInterface, nodeID string) error {
+	node, err := getNode(ctx, nodeID)
+	if err != nil || node == nil || len(node.Queued) == 0 {
+		return err
+	}
+	now, err := txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+
+	stillQueued := []string{}
+	for _, segmentID := range node.Queued {
+		segment, err := c.getSegment(ctx, segmentID)
+		if err != nil {
+			return err
+		}
+		if segment == nil {
+			continue
+		}
+		waiting := len(segment.Waitlist)
+		if err := c.grantWaitlist(ctx, segment, now); err != nil {
+			return err
+		}
+		if len(segment.Waitlist) != waiting {
+			if err := c.putSegment(ctx, segment, models.EventSegmentReserved, "", ""); err != nil {
+				return err
+			}
+		}
+		_, waitingHere := splitReservations(segment.Waitlist, func(r models.Reservation) bool {
+			return r.Direction == nodeID || r.ToNode == nodeID
+		})
+		if len(waitingHere) > 0 {
+			stillQueued = append(stillQueued, segmentID)
+		}
+	}
+
+	// Granting may have reserved the node: read it again before storing
+	if node, err = getNode(ctx, nodeID); err != nil {
+		return err
+	}
+	node.Queued = stillQueued
+	_, err = writeNode(ctx, node)
+	return err
+}
+
+// setQueuedPriority gives a mission's queued requests a new priority and re-sorts
+// their waitlists. Returns the segments whose waitlist changed
+func (c *SegmentContract) setQueuedPriority(
+	ctx RoutingContextInterface,
+	mission *models.Mission,
+	priorityLevel int,
+) ([]string, error) {
+	segmentIDs, err := queuedSegments(ctx, mission)
+	if err != nil {
+		return nil, err
+	}
+
+	updated := []string{}
+	for _, segmentID := range segmentIDs {
+		segment, err := c.getSegment(ctx, segmentID)
+		if err != nil {
+			return nil, err
+		}
+		if segment == nil {
+			continue
+		}
+
+		queued := false
+		for i := range segment.Waitlist {
+			if segment.Waitlist[i].MissionID == mission.MissionID {
+				segment.Waitlist[i].PriorityLevel = priorityLevel
+				queued = true
+			}
+		}
+		if !queued {
+			continue
+		}
+		sortWaitlist(segment)
+		if _, err := c.writeSegment(ctx, segment); err != nil {
+			return nil, err
+		}
+		updated = append(updated, segmentID)
+	}
+	return updated, nil
+}
+
+// sortWaitlist orders a segment's waitlist by priority, keeping arrival order within one
+func sortWaitlist(segment *models.Segment) {
+	sort.SliceStable(segment.Waitlist, func(i, j int) bool {
+		return segment.Waitlist[i].PriorityLevel < segment.Waitlist[j].PriorityLevel
+	})
+}
+
+// queuedSegments lists the segments that may hold a mission's queued requests: those
+// on its path (a step re-timed) and those queued on the intersections its route
+// crosses (a gap closed, see routeSlot)
+func queuedSegments(ctx RoutingContextInterface, mission *models.Mission) ([]string, error) {
+	nodeIDs := []string{mission.OriginNode, mission.DestNode}
+	for _, waypoint := range mission.Waypoints {
+		nodeIDs = append(nodeIDs, waypoint.NodeID)
+	}
+	for _, step := range mission.Steps {
+		nodeIDs = append(nodeIDs, step.FromNode, step.ToNode)
+	}
+
+	segmentIDs := []string{}
+	seen := map[string]bool{}
+	add := func(ids ...string) {
+		for _, id := range ids {
+			if !seen[id] {
+				seen[id] = true
+				segmentIDs = append(segmentIDs, id)
+			}
+		}
+	}
+
+	add(mission.Path...)
+	visited := map[string]bool{}
+	for _, nodeID := range nodeIDs {
+		if nodeID == "" || visited[nodeID] {
+			continue
+		}
+		visited[nodeID] = true
+		node, err := getNode(ctx, nodeID)
+		if err != nil {
+			return nil, err
+		}
+		if node != nil {
+			add(node.Queued...)
+		}
+	}
+	return segmentIDs, nil
+}
+
+// removeQueued drops the waitlist entries that match and returns them
+func removeQueued(segment *models.Segment, match func(models.Reservation) bool) []models.Reservation {
+	var removed []models.Reservation
+	segment.Waitlist, removed = splitReservations(segment.Waitlist, match)
+	return removed
+}
+
+// queuedMission loads the mission of a queued request
+// Unknown IDs return nil, since segments may be reserved under IDs that are not missions
+func queuedMission(ctx RoutingContextInterface, missionID string) (*models.Mission, error) {
+	missionJSON, err := getEntityState(ctx, missionObjectType, missionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read state: %v", err)
+	}
+	if missionJSON == nil {
+		return nil, nil
+	}
+
+	var mission models.Mission
+	if err := json.Unmarshal(missionJSON, &mission); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal mission: %v", err)
+	}
+	return &mission, nil
+}
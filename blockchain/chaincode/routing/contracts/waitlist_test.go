@@ -0,0 +1,137 @@
+package contracts
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/emergency-routing/chaincode/routing/models"
+)
+
+// queuedBehind starts P1 along S7, S1 then S8 and has M1 preempt it on S1 and the
+// intersections at its ends, then queues P1 for S1 again until M1 frees it
+func queuedBehind(t *testing.T) *ledger {
+	l := newLedger(t)
+	l.registerVehicle(medicalDispatcher, "AMB-1", "medical", "ambulance", 2)
+	l.registerVehicle(medicalDispatcher, "AMB-2", "medical", "ambulance", 2)
+	l.registerVehicle(policeDispatcher, "POL-1", "police", "patrol", 3)
+	l.startMission(policeDispatcher, "P1", "POL-1", "E", "F", "low",
+		`[{"segmentId":"S7","fromNode":"E","toNode":"A"},{"segmentId":"S1","fromNode":"A","toNode":"B"},{"segmentId":"S8","fromNode":"B","toNode":"F"}]`)
+	l.startMission(medicalDispatcher, "M1", "AMB-1", "A", "D", "critical",
+		`[{"segmentId":"S1","fromNode":"A","toNode":"B"},{"segmentId":"S2","fromNode":"B","toNode":"C"},{"segmentId":"S3","fromNode":"C","toNode":"D"}]`)
+	if path := l.mission("P1").Path; len(path) != 2 {
+		t.Fatalf("M1 should have preempted P1 on S1, P1 path is %v", path)
+	}
+
+	priority := fmt.Sprint(l.mission("P1").PriorityLevel)
+	l.mustInvoke(policeDispatcher, "SegmentContract:QueueSegment", "S1", "POL-1", "P1", priority, "0", "0", "A", "B")
+	if waiting := l.segment("S1").Waitlist; len(waiting) != 1 || waiting[0].MissionID != "P1" {
+		t.Fatalf("P1 should wait for S1, got %+v", waiting)
+	}
+	return l
+}
+
+func TestEveryReleaseGrantsTheWaitlist(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		release func(l *ledger)
+	}{
+		{"advance", func(l *ledger) {
+			l.mustInvoke(driver("MedicalMSP", "AMB-1"), "MissionContract:AdvanceMission", "M1", "S3")
+		}},
+		{"handoff", func(l *ledger) {
+			l.mustInvoke(medicalDispatcher, "MissionContract:HandoffMission", "M1", "AMB-2", `[{"segmentId":"S3","fromNode":"C","toNode":"D"}]`)
+		}},
+		{"late lease renewal", func(l *ledger) {
+			l.now += reservationLeaseSeconds + 1
+			l.mustInvoke(medicalDispatcher, "MissionContract:RenewLease", "M1")
+		}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			l := queuedBehind(t)
+			tc.release(l)
+
+			segment := l.segment("S1")
+			if len(segment.Waitlist) != 0 || len(segment.Reservations) != 1 || segment.Reservations[0].MissionID != "P1" {
+				t.Fatalf("S1 should be granted to P1, got reservations %+v, waitlist %+v", segment.Reservations, segment.Waitlist)
+			}
+
+			// S1 closes the gap M1 left in P1's path, and P1 holds the intersections at its ends
+			mission := l.mission("P1")
+			if len(mission.Path) != 3 || mission.Path[1] != "S1" {
+				t.Fatalf("S1 should close the gap in P1's path, got %v", mission.Path)
+			}
+			if step := mission.Steps[1]; step.SegmentID != "S1" || step.FromNode != "A" || step.ToNode != "B" || step.EnterAt != segment.Reservations[0].EnterAt {
+				t.Fatalf("S1 should join P1's steps from A to B with its window, got %+v", mission.Steps)
+			}
+			for _, nodeID := range []string{"A", "B"} {
+				if holders := l.holders(nodeID); len(holders) != 1 || holders[0] != "P1" {
+					t.Fatalf("%s should be granted to P1 with S1, got %v", nodeID, holders)
+				}
+			}
+
+			// The granted segment is released with the rest of the path
+			l.mustInvoke(policeDispatcher, "MissionContract:CompleteMission", "P1")
+			if holders := l.segment("S1").Reservations; len(holders) != 0 {
+				t.Fatalf("S1 still held by %+v after P1 completed", holders)
+			}
+			for _, nodeID := range []string{"A", "B"} {
+				if holders := l.holders(nodeID); len(holders) != 0 {
+					t.Fatalf("%s still held by %v after P1 completed", nodeID, holders)
+				}
+			}
+		})
+	}
+}
+
+func TestQueueSegmentNeedsAStepThatConnectsToTheRoute(t *testing.T) {
+	l := queuedBehind(t)
+	priority := fmt.Sprint(l.mission("P1").PriorityLevel)
+
+	l.mustFail(policeDispatcher, "needs both fromNode and toNode",
+		"SegmentContract:QueueSegment", "S2", "POL-1", "P1", priority, "0", "0", "B", "")
+	l.mustFail(policeDispatcher, "does not connect to the route of mission P1",
+		"SegmentContract:QueueSegment", "S2", "POL-1", "P1", priority, "0", "0", "B", "C")
+}
+
+func TestGrantedStepKeepsItsNodesAsTheVehicleAdvances(t *testing.T) {
+	l := queuedBehind(t)
+	l.mustInvoke(medicalDispatcher, "MissionContract:CompleteMission", "M1")
+
+	l.mustInvoke(driver("PoliceMSP", "POL-1"), "MissionContract:AdvanceMission", "P1", "S1")
+
+	nodes := l.mission("P1").Nodes
+	for _, nodeID := range []string{"A", "B"} {
+		if holders := l.holders(nodeID); len(holders) != 1 || holders[0] != "P1" {
+			t.Fatalf("P1 is on S1 and should hold %s, got %v (P1 nodes %v)", nodeID, holders, nodes)
+		}
+	}
+}
+
+func TestUpdateMissionPriorityReordersTheWaitlist(t *testing.T) {
+	l := newLedger(t)
+	l.registerVehicle(policeDispatcher, "POL-1", "police", "patrol_car", 3)
+	l.registerVehicle(policeDispatcher, "POL-2", "police", "patrol_car", 3)
+	l.registerVehicle(medicalDispatcher, "AMB-1", "medical", "ambulance", 1)
+	start := l.now
+	window := func(from int64) string {
+		return fmt.Sprintf(`[{"segmentId":"S1","enterAt":%d,"exitAt":%d,"fromNode":"A","toNode":"B"}]`, start+from, start+from+60)
+	}
+	l.startMission(policeDispatcher, "P1", "POL-1", "A", "B", "low", window(0))
+	l.startMission(policeDispatcher, "P2", "POL-2", "A", "B", "low", window(100))
+	l.startMission(medicalDispatcher, "M1", "AMB-1", "A", "B", "critical", window(0))
+
+	// P1 lost its window to M1, P2 wants to move onto it: both wait, P1 first
+	priority := fmt.Sprint(l.mission("P1").PriorityLevel)
+	l.mustInvoke(policeDispatcher, "SegmentContract:QueueSegment", "S1", "POL-1", "P1", priority, fmt.Sprint(start), fmt.Sprint(start+60), "A", "B")
+	l.mustInvoke(policeDispatcher, "SegmentContract:QueueSegment", "S1", "POL-2", "P2", priority, fmt.Sprint(start), fmt.Sprint(start+60), "A", "B")
+
+	l.mustInvoke(policeDispatcher, "MissionContract:UpdateMissionPriority", "P2", models.SeverityCritical, "officer down")
+
+	waiting := l.segment("S1").Waitlist
+	if len(waiting) != 2 || waiting[0].MissionID != "P2" || waiting[1].MissionID != "P1" {
+		t.Fatalf("P2 should now wait ahead of P1, got %+v", waiting)
+	}
+	if got, want := waiting[0].PriorityLevel, l.mission("P2").PriorityLevel; got != want {
+		t.Fatalf("P2 waits at priority %d, want %d", got, want)
+	}
+}
@@ -0,0 +1,289 @@
+package contracts
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/emergency-routing/chaincode/routing/models"
+)
+
+// CreateMultiStopMission creates a pending mission that visits several stops in order
+// (e.g., scene then hospital). stopsJSON is a JSON array of node IDs or of {nodeId, label};
+// the last stop is the mission's destination
+func (c *MissionContract) CreateMultiStopMission(
+	ctx RoutingContextInterface,
+	missionID string,
+	vehicleID string,
+	originNode string,
+	stopsJSON string,
+	severity string,
+	category string,
+) error {
+	waypoints, err := parseWaypoints(originNode, stopsJSON)
+	if err != nil {
+		return err
+	}
+
+	destNode := waypoints[len(waypoints)-1].NodeID
+	return c.createMission(ctx, missionID, vehicleID, originNode, destNode, severity, category, waypoints)
+}
+
+// ReachWaypoint records that the mission's vehicle reached the stop ending its current leg
+// The leg is closed and its segments and intersections are released, except those a later
+// leg drives again. Reaching the last stop completes the mission
+func (c *MissionContract) ReachWaypoint(
+	ctx RoutingContextInterface,
+	missionID string,
+	nodeID string,
+) error {
+	// Get mission
+	mission, err := c.GetMission(ctx, missionID)
+	if err != nil {
+		return err
+	}
+
+	// Verify mission is underway
+	if !isMissionUnderway(mission.Status) {
+		return fmt.Errorf("mission %s is not active (current: %s)", missionID, mission.Status)
+	}
+
+	// Verify caller org matches mission org
+	callerOrg, err := resolveCallerOrg(ctx)
+	if err != nil {
+		return err
+	}
+	if callerOrg.OrgType != mission.OrgType {
+		return fmt.Errorf("cannot update mission from different organization")
+	}
+	if err := requireVehicleAccess(ctx, mission.VehicleID); err != nil {
+		return err
+	}
+
+	if len(mission.Waypoints) == 0 {
+		return fmt.Errorf("mission %s has no waypoints", missionID)
+	}
+	leg := mission.CurrentLeg
+	waypoint := &mission.Waypoints[leg]
+	if waypoint.NodeID != nodeID {
+		return fmt.Errorf("mission %s is heading to waypoint %s, not %s", missionID, waypoint.NodeID, nodeID)
+	}
+
+	now, err := txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+
+	// Release the leg - segments a later leg drives again stay reserved
+	later := make(map[string]bool)
+	for _, wp := range mission.Waypoints[leg+1:] {
+		for _, seg := range wp.Path {
+			later[seg] = true
+		}
+	}
+	var ahead map[string]bool
+	if len(mission.Steps) == len(mission.Path) {
+		ahead = make(map[string]bool)
+		for _, step := range mission.Steps {
+			if later[step.SegmentID] {
+				ahead[step.FromNode] = true
+				ahead[step.ToNode] = true
+			}
+		}
+	}
+	segmentContract := &SegmentContract{}
+	released := []string{}
+	for _, seg := range waypoint.Path {
+		if later[seg] {
+			continue
+		}
+		segment, err := segmentContract.getSegment(ctx, seg)
+		if err != nil {
+			return err
+		}
+		if segment != nil {
+			freed, _, err := segmentContract.releaseReservations(ctx, segment, byMission(missionID), nil, now)
+			if err != nil {
+				return err
+			}
+			if len(freed) > 0 {
+				if err := segmentContract.putSegment(ctx, segment, models.EventSegmentReleased, missionID, mission.VehicleID); err != nil {
+					return err
+				}
+				released = append(released, seg)
+			}
+		}
+		removeFromPath(mission, seg)
+	}
+
+	// Close the leg and start the next one at its first segment
+	waypoint.Status = models.LegReached
+	waypoint.ReachedAt = now
+	mission.CurrentIndex = -1
+	final := leg == len(mission.Waypoints)-1
+	nextNode := ""
+	if !final {
+		mission.CurrentLeg = leg + 1
+		mission.Waypoints[leg+1].Status = models.LegActive
+		nextNode = mission.Waypoints[leg+1].NodeID
+	}
+	releasedNodes := []string{}
+	if !final && ahead != nil {
+		if releasedNodes, err = releaseNodesExcept(ctx, mission, ahead); err != nil {
+			return err
+		}
+	}
+
+	missionJSON, err := json.Marshal(mission)
+	if err != nil {
+		return fmt.Errorf("failed to marshal mission: %v", err)
+	}
+
+	err = putEntityState(ctx, missionObjectType, missionID, missionJSON)
+	if err != nil {
+		return fmt.Errorf("failed to write state: %v", err)
+	}
+
+	// Raise event
+	waypointEvent := map[string]interface{}{
+		"type":          models.EventWaypointReached,
+		"missionId":     missionID,
+		"vehicleId":     mission.VehicleID,
+		"nodeId":        nodeID,
+		"label":         waypoint.Label,
+		"leg":           leg,
+		"legs":          len(mission.Waypoints),
+		"released":      released,
+		"releasedNodes": releasedNodes,
+		"nextNodeId":    nextNode,
+	}
+	eventJSON, _ := json.Marshal(waypointEvent)
+	ctx.RaiseEvent(models.EventWaypointReached, eventJSON)
+	auditMission(ctx, models.EventWaypointReached, mission, map[string]interface{}{
+		"nodeId":   nodeID,
+		"leg":      leg,
+		"released": released,
+	})
+
+	if final {
+		return c.CompleteMission(ctx, missionID)
+	}
+	return nil
+}
+
+// parseWaypoints accepts either a plain JSON array of node IDs or an array of
+// {nodeId, label} objects and returns the stops with every leg pending
+func parseWaypoints(originNode string, stopsJSON string) ([]models.Waypoint, error) {
+	var waypoints []models.Waypoint
+	var nodeIDs []string
+	if err := json.Unmarshal([]byte(stopsJSON), &nodeIDs); err == nil {
+		for _, nodeID := range nodeIDs {
+			waypoints = append(waypoints, models.Waypoint{NodeID: nodeID})
+		}
+	} else if err := json.Unmarshal([]byte(stopsJSON), &waypoints); err != nil {
+		return nil, fmt.Errorf("failed to parse waypoints JSON: %v", err)
+	}
+
+	if len(waypoints) == 0 {
+		return nil, fmt.Errorf("a multi-stop mission needs at least one stop")
+	}
+	previous := originNode
+	for i := range waypoints {
+		if waypoints[i].NodeID == "" {
+			return nil, fmt.Errorf("waypoint %d has no node ID", i)
+		}
+		if waypoints[i].NodeID == previous {
+			return nil, fmt.Errorf("waypoint %d repeats the previous stop %s", i, previous)
+		}
+		previous = waypoints[i].NodeID
+
+		waypoints[i].Path = []string{}
+		waypoints[i].Status = models.LegPending
+		waypoints[i].ReachedAt = 0
+	}
+
+	return waypoints, nil
+}
+
+// parseMissionPath parses the path given to ActivateMission, UpdateMissionPath or HandoffMission
+// A multi-stop mission takes a JSON array with one path per remaining leg, each in the
+// format parsePath accepts; the legs are stored on their waypoints and returned flattened.
+// Each leg must drive without gaps to its stop (DestNode for a single-leg mission), the
+// first one from one of starts (any node if starts is nil) and the others from the previous stop
+func parseMissionPath(mission *models.Mission, pathJSON string, starts []string) ([]models.PathSegment, error) {
+	if len(mission.Waypoints) == 0 {
+		steps, err := parsePath(pathJSON)
+		if err != nil {
+			return nil, err
+		}
+		if err := checkRoute(steps, starts, mission.DestNode); err != nil {
+			return nil, err
+		}
+		return steps, nil
+	}
+
+	var legs []json.RawMessage
+	if err := json.Unmarshal([]byte(pathJSON), &legs); err != nil {
+		return nil, fmt.Errorf("failed to parse leg paths JSON: %v", err)
+	}
+	remaining := mission.Waypoints[mission.CurrentLeg:]
+	if len(legs) != len(remaining) {
+		return nil, fmt.Errorf("mission %s has %d remaining legs, got %d leg paths", mission.MissionID, len(remaining), len(legs))
+	}
+
+	steps := []models.PathSegment{}
+	for i, leg := range legs {
+		legSteps, err := parsePath(string(leg))
+		if err != nil {
+			return nil, fmt.Errorf("leg %d: %v", mission.CurrentLeg+i, err)
+		}
+		if len(legSteps) == 0 {
+			return nil, fmt.Errorf("leg %d path cannot be empty", mission.CurrentLeg+i)
+		}
+		legStarts := starts
+		if i > 0 {
+			legStarts = []string{remaining[i-1].NodeID}
+		}
+		if err := checkRoute(legSteps, legStarts, remaining[i].NodeID); err != nil {
+			return nil, fmt.Errorf("leg %d: %v", mission.CurrentLeg+i, err)
+		}
+
+		remaining[i].Path = []string{}
+		for _, step := range legSteps {
+			remaining[i].Path = append(remaining[i].Path, step.SegmentID)
+		}
+		steps = append(steps, legSteps...)
+	}
+
+	return steps, nil
+}
+
+// legStart returns the node the leg a mission is driving starts from
+func legStart(mission *models.Mission) string {
+	if len(mission.Waypoints) == 0 || mission.CurrentLeg == 0 {
+		return mission.OriginNode
+	}
+	return mission.Waypoints[mission.CurrentLeg-1].NodeID
+}
+
+// onCurrentLeg reports whether a segment belongs to the leg a mission is driving
+// Single-leg missions have one leg made of their whole path
+func onCurrentLeg(mission *models.Mission, segmentID string) bool {
+	if len(mission.Waypoints) == 0 {
+		return true
+	}
+	for _, seg := range mission.Waypoints[mission.CurrentLeg].Path {
+		if seg == segmentID {
+			return true
+		}
+	}
+	return false
+}
+
+// waypointNodes lists the stop nodes of a mission in order
+func waypointNodes(waypoints []models.Waypoint) []string {
+	nodes := []string{}
+	for _, wp := range waypoints {
+		nodes = append(nodes, wp.NodeID)
+	}
+	return nodes
+}
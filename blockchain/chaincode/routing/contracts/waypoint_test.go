@@ -0,0 +1,47 @@
+package contracts
+
+import (
+	"testing"
+)
+
+func TestMultiStopPathsAreCheckedLegByLeg(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		path string
+		want string
+	}{
+		{"not JSON", `[[{"segmentId":"S1"`, "failed to parse leg paths JSON"},
+		{"single path", `[{"segmentId":"S1","fromNode":"A","toNode":"B"}]`, "has 2 remaining legs, got 1 leg paths"},
+		{"extra leg", `[[{"segmentId":"S1","fromNode":"A","toNode":"B"}],[{"segmentId":"S2","fromNode":"B","toNode":"C"}],[]]`, "has 2 remaining legs, got 3 leg paths"},
+		{"empty leg", `[[{"segmentId":"S1","fromNode":"A","toNode":"B"}],[]]`, "leg 1 path cannot be empty"},
+		{"unreadable leg", `[[{"segmentId":"S1","fromNode":"A","toNode":"B"}],"S2"]`, "leg 1:"},
+		{"no endpoints", `[["S1"],["S2"]]`, "leg 0: path step 0 (segment S1) needs both fromNode and toNode"},
+		{"wrong origin", `[[{"segmentId":"S1","fromNode":"X","toNode":"B"}],[{"segmentId":"S2","fromNode":"B","toNode":"C"}]]`, "leg 0: path starts at X, not A"},
+		{"short of the stop", `[[{"segmentId":"S1","fromNode":"A","toNode":"X"}],[{"segmentId":"S2","fromNode":"X","toNode":"C"}]]`, "leg 0: path ends at X, not B"},
+		{"not from the previous stop", `[[{"segmentId":"S1","fromNode":"A","toNode":"B"}],[{"segmentId":"S2","fromNode":"X","toNode":"C"}]]`, "leg 1: path starts at X, not B"},
+		{"gap", `[[{"segmentId":"S1","fromNode":"A","toNode":"B"}],[{"segmentId":"S2","fromNode":"B","toNode":"X"},{"segmentId":"S3","fromNode":"Y","toNode":"C"}]]`, "leg 1: path is not continuous"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			l := newLedger(t)
+			l.registerVehicle(medicalDispatcher, "AMB-1", "medical", "ambulance", 2)
+			l.mustInvoke(medicalDispatcher, "MissionContract:CreateMultiStopMission", "M1", "AMB-1", "A", `["B","C"]`, "high", "")
+			l.mustFail(medicalDispatcher, tc.want, "MissionContract:ActivateMission", "M1", tc.path)
+		})
+	}
+}
+
+func TestRerouteTakesOnlyTheRemainingLegs(t *testing.T) {
+	l := newLedger(t)
+	l.registerVehicle(medicalDispatcher, "AMB-1", "medical", "ambulance", 2)
+	l.mustInvoke(medicalDispatcher, "MissionContract:CreateMultiStopMission", "M1", "AMB-1", "A", `["B","C"]`, "high", "")
+	l.mustInvoke(medicalDispatcher, "MissionContract:ActivateMission", "M1",
+		`[[{"segmentId":"S1","fromNode":"A","toNode":"B"}],[{"segmentId":"S2","fromNode":"B","toNode":"C"}]]`)
+	l.mustInvoke(driver("MedicalMSP", "AMB-1"), "MissionContract:ReachWaypoint", "M1", "B")
+
+	// Legs are numbered from the start of the mission
+	l.mustFail(medicalDispatcher, "has 1 remaining legs, got 2 leg paths", "MissionContract:UpdateMissionPath", "M1",
+		`[[{"segmentId":"S1","fromNode":"A","toNode":"B"}],[{"segmentId":"S2","fromNode":"B","toNode":"C"}]]`)
+	l.mustFail(medicalDispatcher, "leg 1: path starts at A, not B", "MissionContract:UpdateMissionPath", "M1",
+		`[[{"segmentId":"S9","fromNode":"A","toNode":"C"}]]`)
+	l.mustInvoke(medicalDispatcher, "MissionContract:UpdateMissionPath", "M1", `[[{"segmentId":"S9","fromNode":"B","toNode":"C"}]]`)
+}
@@ -10,9 +10,12 @@ import (
 func main() {
 	// Create chaincode with all contracts
 	routingChaincode, err := contractapi.NewChaincode(
-		&contracts.VehicleContract{},
-		&contracts.SegmentContract{},
-		&contracts.MissionContract{},
+		contracts.NewVehicleContract(),
+		contracts.NewSegmentContract(),
+		contracts.NewMissionContract(),
+		contracts.NewOrgContract(),
+		contracts.NewAuditContract(),
+		contracts.NewMigrationContract(),
 	)
 	if err != nil {
 		log.Panicf("Error creating routing chaincode: %v", err)
@@ -23,4 +26,3 @@ func main() {
 		log.Panicf("Error starting routing chaincode: %v", err)
 	}
 }
-
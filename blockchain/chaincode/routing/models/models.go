@@ -1,5 +1,7 @@
 package models
 
+import "encoding/json"
+
 // Vehicle represents an emergency vehicle registered in the system
 type Vehicle struct {
 	DocType       string `json:"docType"`       // "vehicle" - for CouchDB queries
@@ -12,20 +14,95 @@ type Vehicle struct {
 	RegisteredAt  int64  `json:"registeredAt"`  // Unix timestamp
 }
 
+// Organization is an entry in the on-ledger organization registry
+// Callers are mapped to an org by their MSP ID; nothing else is hard-coded
+type Organization struct {
+	DocType             string   `json:"docType"`             // "org" - for CouchDB queries
+	MSPID               string   `json:"mspId"`               // Fabric MSP ID (e.g., "MedicalMSP")
+	OrgType             string   `json:"orgType"`             // Org type stamped on vehicles and missions (e.g., "medical")
+	AllowedVehicleTypes []string `json:"allowedVehicleTypes"` // Vehicle types the org may register (empty array = any)
+	MaxPriorityLevel    int      `json:"maxPriorityLevel"`    // Highest priority the org may use (1 = highest)
+	Enabled             bool     `json:"enabled"`             // Disabled orgs cannot transact
+	Admin               bool     `json:"admin"`               // Admin orgs may update the registry
+	UpdatedBy           string   `json:"updatedBy"`           // MSP ID of the last writer
+	UpdatedAt           int64    `json:"updatedAt"`           // Unix timestamp
+}
+
 // Segment represents a road segment reservation state
 // NOTE: Map topology (fromNode, toNode, geometry) is stored in PostgreSQL, NOT in blockchain
 // The blockchain only stores reservation state for conflict resolution and audit trail
+// Reservations holds the time windows; the flat fields mirror the current (earliest
+// or occupied) reservation so existing status queries keep working
+// Up to Capacity reservations per direction of travel may overlap (one lane each)
+// Waitlist holds queued requests (see QueueSegment), granted as windows free up
 type Segment struct {
 	DocType       string `json:"docType"`       // "segment" - for CouchDB queries
 	SegmentID     string `json:"segmentId"`     // Unique identifier (e.g., "SEG_H01_I01")
 	FromNode      string `json:"fromNode"`      // DEPRECATED: Not used, kept for backward compatibility
 	ToNode        string `json:"toNode"`        // DEPRECATED: Not used, kept for backward compatibility
-	Status        string `json:"status"`        // "free", "reserved", "occupied"
+	Status        string `json:"status"`        // "free", "reserved", "occupied", "blocked"
 	ReservedBy    string `json:"reservedBy"`    // VehicleID if reserved (empty string if free)
 	MissionID     string `json:"missionId"`     // MissionID if reserved (empty string if free)
 	OrgType       string `json:"orgType"`       // Org that reserved (empty string if free)
 	PriorityLevel int    `json:"priorityLevel"` // Priority of reservation (0 if free)
 	ReservedAt    int64  `json:"reservedAt"`    // When reserved (0 if free)
+
+	Reservations []Reservation `json:"reservations,omitempty" metadata:",optional"` // Windows ordered by enterAt
+	Blockage     *Blockage     `json:"blockage,omitempty" metadata:",optional"`     // Road closure (nil if the segment is open)
+	Capacity     int           `json:"capacity,omitempty" metadata:",optional"`     // Concurrent reservations per direction (0 = 1)
+	Holders      []string      `json:"holders,omitempty" metadata:",optional"`      // Vehicles whose windows overlap the current reservation
+	Waitlist     []Reservation `json:"waitlist,omitempty" metadata:",optional"`     // Queued requests, highest priority first
+}
+
+// Blockage closes a segment to traffic for a time window (accident, flooding, parade)
+// The segment reads "blocked" from StartAt until the closure ends
+type Blockage struct {
+	Reason    string `json:"reason"`    // Why the road is closed
+	StartAt   int64  `json:"startAt"`   // Closure start (Unix seconds)
+	EndAt     int64  `json:"endAt"`     // Closure end (0 = until UnblockSegment)
+	BlockedBy string `json:"blockedBy"` // MSP ID of the issuing org
+	OrgType   string `json:"orgType"`   // Org type of the issuing org
+	BlockedAt int64  `json:"blockedAt"` // When the closure was issued
+}
+
+// Reservation is a mission's claim on a segment for an [enterAt, exitAt] time window
+type Reservation struct {
+	MissionID     string `json:"missionId"`     // Mission holding the window
+	VehicleID     string `json:"vehicleId"`     // Vehicle that will drive the segment
+	OrgType       string `json:"orgType"`       // Org that reserved
+	PriorityLevel int    `json:"priorityLevel"` // Priority of the reservation
+	Status        string `json:"status"`        // "reserved", "occupied" or "queued" (on the waitlist)
+	EnterAt       int64  `json:"enterAt"`       // Expected entry time (Unix seconds)
+	ExitAt        int64  `json:"exitAt"`        // Expected exit time (0 = open-ended)
+	ReservedAt    int64  `json:"reservedAt"`    // When reserved (when queued, for waitlist entries)
+
+	LeaseExpiresAt int64  `json:"leaseExpiresAt"`                           // Reservation counts as free after this (0 = no lease)
+	Direction      string `json:"direction,omitempty" metadata:",optional"` // Node the vehicle enters from ("" = either direction)
+	ToNode         string `json:"toNode,omitempty" metadata:",optional"`    // Node the vehicle leaves by, when the path gave it
+	Via            string `json:"via,omitempty" metadata:",optional"`       // On a node, the segment the vehicle arrives by (leaves by at the start of its path)
+}
+
+// Node represents the reservation state of an intersection
+// Like segments, nodes are created lazily the first time a path crosses them
+type Node struct {
+	DocType      string        `json:"docType"`      // "node" - for CouchDB queries
+	NodeID       string        `json:"nodeId"`       // Unique identifier (e.g., "I01")
+	Status       string        `json:"status"`       // "free", "reserved"
+	Reservations []Reservation `json:"reservations"` // Non-overlapping windows ordered by enterAt
+
+	Queued []string `json:"queued,omitempty" metadata:",optional"` // Segments whose queued requests wait for this intersection (see QueueSegment)
+}
+
+// PathSegment is one step of a requested path with the caller's ETA window
+// A zero EnterAt means "now", a zero ExitAt means the window is open-ended
+// FromNode and ToNode give the direction of travel and the intersections the path
+// crosses; a mission path must give both for every step
+type PathSegment struct {
+	SegmentID string `json:"segmentId"`
+	EnterAt   int64  `json:"enterAt"`
+	ExitAt    int64  `json:"exitAt"`
+	FromNode  string `json:"fromNode,omitempty" metadata:",optional"`
+	ToNode    string `json:"toNode,omitempty" metadata:",optional"`
 }
 
 // Mission represents an emergency mission
@@ -38,44 +115,203 @@ type Mission struct {
 	OriginNode    string   `json:"originNode"`    // Starting node
 	DestNode      string   `json:"destNode"`      // Destination node
 	Path          []string `json:"path"`          // Reserved segment IDs (empty array if none)
-	Status        string   `json:"status"`        // "pending", "active", "completed", "aborted"
+	CurrentIndex  int      `json:"currentIndex"`  // Index in Path of the segment the vehicle is on (-1 before entering the path)
+	Status        string   `json:"status"`        // "pending", "active", "needs_reroute", "stale", "completed", "aborted"
 	CreatedAt     int64    `json:"createdAt"`     // Creation timestamp
 	ActivatedAt   int64    `json:"activatedAt"`   // When activated (0 if not yet)
 	CompletedAt   int64    `json:"completedAt"`   // When completed (0 if not yet)
 	CreatedBy     string   `json:"createdBy"`     // Who created
+
+	PreemptedSegments []PreemptedSegment `json:"preemptedSegments,omitempty" metadata:",optional"` // Segments taken by higher priority missions
+	LeaseExpiresAt    int64              `json:"leaseExpiresAt,omitempty" metadata:",optional"`    // When the last renewed lease runs out
+	StaleReason       string             `json:"staleReason,omitempty" metadata:",optional"`       // Why the mission went stale
+	Severity          string             `json:"severity,omitempty" metadata:",optional"`          // Incident severity that set PriorityLevel
+	Category          string             `json:"category,omitempty" metadata:",optional"`          // Incident category (e.g., "cardiac_arrest", "routine_transfer")
+	Waypoints         []Waypoint         `json:"waypoints,omitempty" metadata:",optional"`         // Ordered stops of a multi-stop mission (the last one is DestNode)
+	CurrentLeg        int                `json:"currentLeg,omitempty" metadata:",optional"`        // Index in Waypoints of the leg being driven
+	Handoffs          []Handoff          `json:"handoffs,omitempty" metadata:",optional"`          // Vehicles the mission was handed over from, oldest first
+	Convoy            *ConvoyLink        `json:"convoy,omitempty" metadata:",optional"`            // Link to the lead mission this mission escorts
+	ConvoyMembers     []string           `json:"convoyMembers,omitempty" metadata:",optional"`     // Missions escorting this one (accepted links only)
+	Nodes             []string           `json:"nodes,omitempty" metadata:",optional"`             // Intersections along the path, in travel order
+	Steps             []PathSegment      `json:"steps,omitempty" metadata:",optional"`             // Path with each segment's endpoints and ETA window, in step with Path
+}
+
+// ConvoyLink ties an escort mission to the lead mission it travels with
+// Both missions' orgs must agree before the link takes effect
+type ConvoyLink struct {
+	LeadMissionID  string `json:"leadMissionId"`  // Mission being escorted
+	Status         string `json:"status"`         // "proposed", "accepted"
+	LeadAccepted   bool   `json:"leadAccepted"`   // The lead mission's org agreed
+	MemberAccepted bool   `json:"memberAccepted"` // This mission's org agreed
+	ProposedBy     string `json:"proposedBy"`     // MSP ID that proposed the link
+	ProposedAt     int64  `json:"proposedAt"`     // When proposed
+	AcceptedAt     int64  `json:"acceptedAt"`     // When both orgs had agreed (0 if not yet)
+}
+
+// Handoff records a mission moved from one vehicle to another of the same org
+type Handoff struct {
+	FromVehicleID string   `json:"fromVehicleId"` // Vehicle that gave up the mission
+	ToVehicleID   string   `json:"toVehicleId"`   // Vehicle that took it over
+	KeptSegments  []string `json:"keptSegments"`  // Reservations carried over without being released
+	HandedOffAt   int64    `json:"handedOffAt"`   // Transaction timestamp of the handoff
+	HandedOffBy   string   `json:"handedOffBy"`   // MSP ID of the caller
+}
+
+// Waypoint is a stop of a multi-stop mission and the leg that leads to it
+// Leg i runs from the previous stop (OriginNode for the first) to waypoint i
+type Waypoint struct {
+	NodeID    string   `json:"nodeId"`                               // Stop node
+	Label     string   `json:"label,omitempty" metadata:",optional"` // What the stop is (e.g., "scene", "hospital")
+	Path      []string `json:"path"`                                 // Segment IDs of the leg ending at this stop
+	Status    string   `json:"status"`                               // "pending", "active", "reached"
+	ReachedAt int64    `json:"reachedAt"`                            // When the vehicle reached the stop (0 if not yet)
+}
+
+// PreemptedSegment records a segment taken from a mission by a higher priority reservation
+// For a lost intersection SegmentID is empty and NodeID names the node
+type PreemptedSegment struct {
+	SegmentID     string `json:"segmentId"`     // Segment that was taken
+	ByMissionID   string `json:"byMissionId"`   // Mission that took it
+	ByVehicleID   string `json:"byVehicleId"`   // Vehicle that took it
+	PriorityLevel int    `json:"priorityLevel"` // Priority of the preempting reservation
+	PreemptedAt   int64  `json:"preemptedAt"`   // Transaction timestamp of the preemption
+
+	Reason string `json:"reason,omitempty" metadata:",optional"` // Why the segment was lost when no mission took it (e.g., a road closure)
+	NodeID string `json:"nodeId,omitempty" metadata:",optional"` // Intersection that was taken
 }
 
 // Conflict represents a reservation conflict between missions
 type Conflict struct {
 	DocType    string `json:"docType"`    // "conflict"
 	ConflictID string `json:"conflictId"` // Unique identifier
-	SegmentID  string `json:"segmentId"`  // Contested segment
+	SegmentID  string `json:"segmentId"`  // Contested segment (empty for an intersection)
 	Mission1ID string `json:"mission1Id"` // First mission
 	Mission2ID string `json:"mission2Id"` // Second mission
 	Priority1  int    `json:"priority1"`  // Priority of mission 1
 	Priority2  int    `json:"priority2"`  // Priority of mission 2
 	Status     string `json:"status"`     // "pending", "resolved"
 	Resolution string `json:"resolution"` // "mission1_wins", "mission2_wins", "both_reroute"
-	ResolvedBy string `json:"resolvedBy,omitempty"`
-	ResolvedAt int64  `json:"resolvedAt,omitempty"`
+	ResolvedBy string `json:"resolvedBy,omitempty" metadata:",optional"`
+	ResolvedAt int64  `json:"resolvedAt,omitempty" metadata:",optional"`
 	CreatedAt  int64  `json:"createdAt"`
+
+	EnterAt   int64  `json:"enterAt,omitempty" metadata:",optional"`   // Window requested by mission 2
+	ExitAt    int64  `json:"exitAt,omitempty" metadata:",optional"`    // 0 = open-ended
+	NodeID    string `json:"nodeId,omitempty" metadata:",optional"`    // Contested intersection
+	Direction string `json:"direction,omitempty" metadata:",optional"` // Direction requested by mission 2
+	Via       string `json:"via,omitempty" metadata:",optional"`       // Segment mission 2 crosses the intersection by
+
+	Vehicle1ID string `json:"vehicle1Id,omitempty" metadata:",optional"` // Vehicle holding mission 1's reservation
+	Vehicle2ID string `json:"vehicle2Id,omitempty" metadata:",optional"` // Vehicle of mission 2
+	OrgType1   string `json:"orgType1,omitempty" metadata:",optional"`   // Organization of mission 1
+	OrgType2   string `json:"orgType2,omitempty" metadata:",optional"`   // Organization of mission 2
 }
 
 // AuditEvent represents an audit log entry
+// One is written for every state change and chained to the previous entry of its entity
 type AuditEvent struct {
-	DocType   string                 `json:"docType"`             // "audit"
-	EventID   string                 `json:"eventId"`             // Unique identifier
-	EventType string                 `json:"eventType"`           // Type of event
-	Timestamp int64                  `json:"timestamp"`           // When it occurred
-	OrgType   string                 `json:"orgType"`             // Organization
-	ActorID   string                 `json:"actorId"`             // Who performed action
-	MissionID string                 `json:"missionId,omitempty"` // Related mission
-	VehicleID string                 `json:"vehicleId,omitempty"` // Related vehicle
-	SegmentID string                 `json:"segmentId,omitempty"` // Related segment
-	Details   map[string]interface{} `json:"details,omitempty"`   // Additional details
-	TxID      string                 `json:"txId"`                // Transaction ID
+	DocType   string                 `json:"docType"`                                  // "audit"
+	EventID   string                 `json:"eventId"`                                  // Unique identifier
+	EventType string                 `json:"eventType"`                                // Type of event
+	Timestamp int64                  `json:"timestamp"`                                // When it occurred
+	OrgType   string                 `json:"orgType"`                                  // Organization
+	ActorID   string                 `json:"actorId"`                                  // Who performed action
+	MissionID string                 `json:"missionId,omitempty" metadata:",optional"` // Related mission
+	VehicleID string                 `json:"vehicleId,omitempty" metadata:",optional"` // Related vehicle
+	SegmentID string                 `json:"segmentId,omitempty" metadata:",optional"` // Related segment
+	Details   map[string]interface{} `json:"details,omitempty" metadata:",optional"`   // Additional details
+	TxID      string                 `json:"txId"`                                     // Transaction ID
+
+	EntityType string `json:"entityType"`                              // docType of the entity whose chain this copy belongs to
+	EntityID   string `json:"entityId"`                                // Chain this copy belongs to (one copy per mission, vehicle and segment involved)
+	Sequence   int64  `json:"sequence"`                                // Position in the entity's chain, starting at 1
+	PrevHash   string `json:"prevHash,omitempty" metadata:",optional"` // Hash of the previous entry in the chain
+	Hash       string `json:"hash"`                                    // SHA-256 of this entry with Hash empty
+}
+
+// AuditChainHead is the last entry of an entity's audit chain
+type AuditChainHead struct {
+	EntityType string `json:"entityType"`
+	EntityID   string `json:"entityId"`
+	Sequence   int64  `json:"sequence"`
+	Hash       string `json:"hash"`
+}
+
+// AuditChainReport is the result of verifying an entity's audit chain
+type AuditChainReport struct {
+	EntityType    string `json:"entityType"`
+	EntityID      string `json:"entityId"`
+	Valid         bool   `json:"valid"`
+	Entries       int64  `json:"entries"`                                // Entries checked
+	FirstBadEntry int64  `json:"firstBadEntry"`                          // Sequence of the first gap or mismatch (0 if valid)
+	Problem       string `json:"problem,omitempty" metadata:",optional"` // What was wrong with it
 }
 
+// MissionVersion is one committed version of a mission from the key history
+type MissionVersion struct {
+	TxID      string   `json:"txId"`                                   // Transaction that wrote the version
+	Timestamp int64    `json:"timestamp"`                              // Transaction timestamp (Unix seconds)
+	IsDelete  bool     `json:"isDelete"`                               // The key was deleted in this transaction
+	Mission   *Mission `json:"mission,omitempty" metadata:",optional"` // Document as written (absent on delete)
+}
+
+// VehicleVersion is one committed version of a vehicle from the key history
+type VehicleVersion struct {
+	TxID      string   `json:"txId"`
+	Timestamp int64    `json:"timestamp"`
+	IsDelete  bool     `json:"isDelete"`
+	Vehicle   *Vehicle `json:"vehicle,omitempty" metadata:",optional"`
+}
+
+// SegmentVersion is one committed version of a segment from the key history
+type SegmentVersion struct {
+	TxID      string   `json:"txId"`
+	Timestamp int64    `json:"timestamp"`
+	IsDelete  bool     `json:"isDelete"`
+	Segment   *Segment `json:"segment,omitempty" metadata:",optional"`
+}
+
+// VehiclePage is one page of a paginated vehicle query
+type VehiclePage struct {
+	Records      []*Vehicle `json:"records"`      // Vehicles in this page
+	Bookmark     string     `json:"bookmark"`     // Pass back to fetch the next page
+	FetchedCount int32      `json:"fetchedCount"` // Number of records read from the ledger for this page
+}
+
+// SegmentPage is one page of a paginated segment query
+type SegmentPage struct {
+	Records      []*Segment `json:"records"`
+	Bookmark     string     `json:"bookmark"`
+	FetchedCount int32      `json:"fetchedCount"`
+}
+
+// MissionPage is one page of a paginated mission query
+type MissionPage struct {
+	Records      []*Mission `json:"records"`
+	Bookmark     string     `json:"bookmark"`
+	FetchedCount int32      `json:"fetchedCount"`
+}
+
+// DomainEvent is a single event raised by a contract during a transaction
+type DomainEvent struct {
+	Type    string          `json:"type"`    // One of the Event* constants
+	Payload json.RawMessage `json:"payload"` // Event-specific JSON document
+}
+
+// EventEnvelope is the single chaincode event emitted per transaction
+// Fabric only keeps the last SetEvent call, so all domain events are batched here
+type EventEnvelope struct {
+	SchemaVersion int           `json:"schemaVersion"` // Envelope format version
+	TxID          string        `json:"txId"`          // Transaction that raised the events
+	Events        []DomainEvent `json:"events"`        // Events in the order they were raised
+}
+
+// Event envelope constants
+const (
+	EventEnvelopeName  = "ROUTING_EVENTS" // Chaincode event name listeners subscribe to
+	EventSchemaVersion = 1
+)
+
 // Event types constants
 const (
 	EventVehicleRegistered   = "VEHICLE_REGISTERED"
@@ -91,6 +327,35 @@ const (
 	EventConflictResolved    = "CONFLICT_RESOLVED"
 	EventPreemptionTriggered = "PREEMPTION_TRIGGERED"
 	EventMissionRerouted     = "MISSION_REROUTED"
+	EventMissionAdvanced     = "MISSION_ADVANCED"
+	EventLeaseRenewed        = "LEASE_RENEWED"
+	EventReservationExpired  = "RESERVATION_EXPIRED"
+	EventOrgRegistered       = "ORG_REGISTERED"
+	EventOrgUpdated          = "ORG_UPDATED"
+	EventPriorityChanged     = "MISSION_PRIORITY_CHANGED"
+	EventWaypointReached     = "WAYPOINT_REACHED"
+	EventMissionHandedOff    = "MISSION_HANDED_OFF"
+	EventConvoyProposed      = "CONVOY_PROPOSED"
+	EventConvoyLinked        = "CONVOY_LINKED"
+	EventConvoyUnlinked      = "CONVOY_UNLINKED"
+	EventSegmentBlocked      = "SEGMENT_BLOCKED"
+	EventSegmentUnblocked    = "SEGMENT_UNBLOCKED"
+	EventNodeReserved        = "NODE_RESERVED"
+	EventNodeReleased        = "NODE_RELEASED"
+	EventCapacityChanged     = "SEGMENT_CAPACITY_CHANGED"
+	EventSegmentQueued       = "SEGMENT_QUEUED"
+	EventWaitlistGranted     = "WAITLIST_GRANTED"
+)
+
+// Document type constants
+const (
+	DocTypeVehicle  = "vehicle"
+	DocTypeSegment  = "segment"
+	DocTypeNode     = "node"
+	DocTypeMission  = "mission"
+	DocTypeConflict = "conflict"
+	DocTypeAudit    = "audit"
+	DocTypeOrg      = "org"
 )
 
 // Status constants
@@ -98,17 +363,50 @@ const (
 	StatusFree     = "free"
 	StatusReserved = "reserved"
 	StatusOccupied = "occupied"
+	StatusBlocked  = "blocked" // Closed to traffic by an authority
+	StatusQueued   = "queued"  // Reservation waiting on a segment's waitlist
 
-	StatusActive   = "active"
-	StatusInactive = "inactive"
+	StatusActive    = "active"
+	StatusInactive  = "inactive"
 	StatusOnMission = "on_mission"
 
-	MissionPending   = "pending"
-	MissionActive    = "active"
-	MissionCompleted = "completed"
-	MissionAborted   = "aborted"
+	MissionPending      = "pending"
+	MissionActive       = "active"
+	MissionNeedsReroute = "needs_reroute" // Lost segments to preemption, path must be updated
+	MissionStale        = "stale"         // Reservation lease expired without renewal
+	MissionCompleted    = "completed"
+	MissionAborted      = "aborted"
 
 	ConflictPending  = "pending"
 	ConflictResolved = "resolved"
+
+	LegPending = "pending" // Stop not reached, leg not started
+	LegActive  = "active"  // Vehicle is driving the leg to this stop
+	LegReached = "reached" // Stop reached, leg closed and its segments released
+
+	ConvoyProposed = "proposed" // Waiting for the other org to accept
+	ConvoyAccepted = "accepted" // Both orgs agreed, the missions share reservations
 )
 
+// Incident severity constants - with the vehicle type they set a mission's priority
+const (
+	SeverityCritical = "critical" // Life-threatening and in progress (e.g., cardiac arrest, active shooter)
+	SeverityHigh     = "high"     // Urgent (e.g., serious injury, crime in progress)
+	SeverityMedium   = "medium"   // Needs a prompt response but no lights and sirens
+	SeverityLow      = "low"      // Routine (e.g., scheduled patient transfer)
+)
+
+// Role constants - carried in the "role" attribute of the caller's X.509 certificate
+const (
+	RoleAdmin      = "admin"      // Org administrator, may do anything its org can
+	RoleDispatcher = "dispatcher" // Dispatch console: manages vehicles, missions and conflicts
+	RoleDriver     = "driver"     // In-vehicle device, bound to one vehicle by the "vehicleId" attribute
+	RoleAuthority  = "authority"  // Traffic authority: closes and reopens road segments
+)
+
+// Conflict resolution constants
+const (
+	ResolutionMission1Wins = "mission1_wins" // Current holder keeps the segment
+	ResolutionMission2Wins = "mission2_wins" // Segment is handed to the challenger
+	ResolutionBothReroute  = "both_reroute"  // Segment is released and both missions reroute
+)
@@ -23,6 +23,7 @@ CC_ADDRESS="routing-chaincode:9999"
 # Script directory
 SCRIPT_DIR="$(cd "$(dirname "${BASH_SOURCE[0]}")" && pwd)"
 NETWORK_DIR="$(dirname "$SCRIPT_DIR")"
+CHAINCODE_DIR="$(dirname "$NETWORK_DIR")/chaincode/routing"
 
 # Print functions
 print_info() { echo -e "${BLUE}[INFO]${NC} $1"; }
@@ -68,9 +69,12 @@ EOF
 }
 EOF
     
-    # Create code.tar.gz with connection.json
+    # Ship the CouchDB indexes; the peer creates them when the chaincode is installed
+    cp -r "$CHAINCODE_DIR/META-INF" "$TEMP_DIR/"
+    
+    # Create code.tar.gz with connection.json and the indexes
     cd "$TEMP_DIR"
-    tar cfz code.tar.gz connection.json
+    tar cfz code.tar.gz connection.json META-INF
     
     # Create final package
     tar cfz "${CHAINCODE_NAME}.tar.gz" code.tar.gz metadata.json
@@ -236,6 +240,27 @@ init_chaincode() {
     # NOTE: The default endorsement policy requires BOTH Medical AND Police peers to endorse
     # All invoke commands must include --peerAddresses for BOTH peers
     
+    # Bootstrap the organization registry (MedicalMSP and PoliceMSP)
+    docker exec \
+        -e CORE_PEER_ADDRESS=$MEDICAL_PEER \
+        -e CORE_PEER_LOCALMSPID=$MEDICAL_MSP \
+        -e CORE_PEER_TLS_ROOTCERT_FILE=$MEDICAL_TLS_ROOTCERT \
+        -e CORE_PEER_MSPCONFIGPATH=$MEDICAL_MSPCONFIGPATH \
+        cli peer chaincode invoke \
+        -o orderer.emergency.net:7050 \
+        --ordererTLSHostnameOverride orderer.emergency.net \
+        --tls \
+        --cafile $ORDERER_CA \
+        -C $CHANNEL_NAME \
+        -n $CHAINCODE_NAME \
+        --peerAddresses $MEDICAL_PEER \
+        --tlsRootCertFiles $MEDICAL_TLS_ROOTCERT \
+        --peerAddresses $POLICE_PEER \
+        --tlsRootCertFiles $POLICE_TLS_ROOTCERT \
+        -c '{"function":"OrgContract:InitOrgRegistry","Args":[""]}'
+    
+    sleep 2
+    
     docker exec \
         -e CORE_PEER_ADDRESS=$MEDICAL_PEER \
         -e CORE_PEER_LOCALMSPID=$MEDICAL_MSP \
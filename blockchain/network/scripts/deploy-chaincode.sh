@@ -219,6 +219,27 @@ query_committed() {
 init_chaincode() {
     print_info "Initializing chaincode (creating 5x5 grid segments)..."
     
+    # Bootstrap the organization registry (MedicalMSP and PoliceMSP)
+    docker exec \
+        -e CORE_PEER_ADDRESS=$MEDICAL_PEER \
+        -e CORE_PEER_LOCALMSPID=$MEDICAL_MSP \
+        -e CORE_PEER_TLS_ROOTCERT_FILE=$MEDICAL_TLS_ROOTCERT \
+        -e CORE_PEER_MSPCONFIGPATH=$MEDICAL_MSPCONFIGPATH \
+        cli peer chaincode invoke \
+        -o orderer.emergency.net:7050 \
+        --ordererTLSHostnameOverride orderer.emergency.net \
+        --tls \
+        --cafile $ORDERER_CA \
+        -C $CHANNEL_NAME \
+        -n $CHAINCODE_NAME \
+        --peerAddresses $MEDICAL_PEER \
+        --tlsRootCertFiles $MEDICAL_TLS_ROOTCERT \
+        --peerAddresses $POLICE_PEER \
+        --tlsRootCertFiles $POLICE_TLS_ROOTCERT \
+        -c '{"function":"OrgContract:InitOrgRegistry","Args":[""]}'
+    
+    sleep 2
+    
     docker exec \
         -e CORE_PEER_ADDRESS=$MEDICAL_PEER \
         -e CORE_PEER_LOCALMSPID=$MEDICAL_MSP \
@@ -0,0 +1,79 @@
+#!/bin/bash
+#
+# Emergency Routing System - Traffic Authority Identity
+# Issues Authority@<org domain>, a client certificate carrying the "role=authority"
+# attribute the chaincode requires to close and reopen roads (BlockSegment,
+# UnblockSegment, SetSegmentCapacity). cryptogen cannot add certificate attributes,
+# so the certificate is signed here with the org CA that cryptogen generated.
+#
+# Usage: ./enroll-authority.sh [org domain...]   (default: both peer orgs)
+#
+
+set -e
+
+# Print formatting
+print_info() { echo -e "\033[0;34m[INFO]\033[0m $1"; }
+print_success() { echo -e "\033[0;32m[SUCCESS]\033[0m $1"; }
+print_error() { echo -e "\033[0;31m[ERROR]\033[0m $1"; }
+
+ORGANIZATIONS=${ORGANIZATIONS:-${PWD}/../organizations}
+AUTHORITY_USER=${AUTHORITY_USER:-Authority}
+
+# Fabric CA encoding of certificate attributes: the JSON document is the raw extension value
+ATTRS_OID="1.2.3.4.5.6.7.8.1"
+ATTRS='{"attrs":{"role":"authority"}}'
+
+DOMAINS=("$@")
+if [ ${#DOMAINS[@]} -eq 0 ]; then
+  DOMAINS=(medical.emergency.net police.emergency.net)
+fi
+
+for DOMAIN in "${DOMAINS[@]}"; do
+  ORG_DIR="${ORGANIZATIONS}/peerOrganizations/${DOMAIN}"
+  CA_CERT="${ORG_DIR}/ca/ca.${DOMAIN}-cert.pem"
+  CA_KEY="${ORG_DIR}/ca/priv_sk"
+  if [ ! -f "$CA_CERT" ] || [ ! -f "$CA_KEY" ]; then
+    print_error "CA material for ${DOMAIN} not found - run cryptogen first"
+    exit 1
+  fi
+
+  USER_MSP="${ORG_DIR}/users/${AUTHORITY_USER}@${DOMAIN}/msp"
+  print_info "Issuing ${AUTHORITY_USER}@${DOMAIN}..."
+
+  rm -rf "$USER_MSP"
+  mkdir -p "${USER_MSP}/signcerts" "${USER_MSP}/keystore" "${USER_MSP}/cacerts" "${USER_MSP}/tlscacerts"
+
+  WORK=$(mktemp -d)
+  trap 'rm -rf "$WORK"' EXIT
+
+  openssl ecparam -name prime256v1 -genkey -noout |
+    openssl pkcs8 -topk8 -nocrypt -out "${USER_MSP}/keystore/priv_sk"
+
+  openssl req -new -key "${USER_MSP}/keystore/priv_sk" \
+    -subj "/C=US/ST=California/L=San Francisco/OU=client/CN=${AUTHORITY_USER}@${DOMAIN}" \
+    -out "${WORK}/csr.pem"
+
+  cat > "${WORK}/ext.cnf" <<EOF
+basicConstraints = critical,CA:FALSE
+keyUsage = critical,digitalSignature
+subjectKeyIdentifier = hash
+authorityKeyIdentifier = keyid
+${ATTRS_OID} = DER:$(printf '%s' "$ATTRS" | od -An -tx1 | tr -d ' \n')
+EOF
+
+  openssl x509 -req -sha256 -days 3650 \
+    -in "${WORK}/csr.pem" \
+    -CA "$CA_CERT" -CAkey "$CA_KEY" -set_serial "0x$(openssl rand -hex 16)" \
+    -extfile "${WORK}/ext.cnf" \
+    -out "${USER_MSP}/signcerts/${AUTHORITY_USER}@${DOMAIN}-cert.pem"
+
+  # Same MSP layout as the users cryptogen generates
+  ADMIN_MSP="${ORG_DIR}/users/Admin@${DOMAIN}/msp"
+  cp "$CA_CERT" "${USER_MSP}/cacerts/"
+  cp "${ADMIN_MSP}/tlscacerts/"* "${USER_MSP}/tlscacerts/"
+  cp "${ADMIN_MSP}/config.yaml" "${USER_MSP}/config.yaml"
+
+  rm -rf "$WORK"
+  trap - EXIT
+  print_success "Issued ${USER_MSP}"
+done
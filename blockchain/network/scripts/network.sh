@@ -74,6 +74,9 @@ else
    exit 1
 fi
 
+# Traffic authority users (role=authority certificate attribute, which cryptogen cannot issue)
+./enroll-authority.sh || exit 1
+
 # ====================================================
 # 3. GENERATE ARTIFACTS (The Fix)
 # ====================================================
@@ -6,7 +6,7 @@
 
 import { useState, useEffect, useCallback, useMemo } from 'react';
 import api from '../../services/api';
-import type { Node, Vehicle, Mission, RouteResult, OrgType, VehiclePosition } from '../../types';
+import type { Node, Vehicle, Mission, RouteResult, OrgType, Severity, VehiclePosition } from '../../types';
 import './MissionPanel.css';
 
 interface MissionPanelProps {
@@ -39,6 +39,7 @@ export function MissionPanel({
   // Form state
   const [selectedVehicle, setSelectedVehicle] = useState<string>('');
   const [destNode, setDestNode] = useState<string>('');
+  const [severity, setSeverity] = useState<Severity | ''>('');
 
   // Route preview state
   const [routePreview, setRoutePreview] = useState<RouteResult | null>(null);
@@ -145,6 +146,10 @@ export function MissionPanel({
       setError('Please calculate route first');
       return;
     }
+    if (!severity) {
+      setError('Please select the incident severity');
+      return;
+    }
 
     setIsLoading(true);
     setError(null);
@@ -155,6 +160,7 @@ export function MissionPanel({
         vehicleId: selectedVehicle,
         originNode,
         destNode,
+        severity,
       });
 
       if (!createResponse.success || !createResponse.data) {
@@ -172,6 +178,7 @@ export function MissionPanel({
         // Reset form
         setSelectedVehicle('');
         setDestNode('');
+        setSeverity('');
         setRoutePreview(null);
         onClearRoute();
       } else {
@@ -182,7 +189,7 @@ export function MissionPanel({
     } finally {
       setIsLoading(false);
     }
-  }, [routePreview, selectedVehicle, originNode, destNode, setIsLoading, onMissionCreated, onClearRoute]);
+  }, [routePreview, selectedVehicle, originNode, destNode, severity, setIsLoading, onMissionCreated, onClearRoute]);
 
   // Quick create: Calculate route and create mission in one step
   const handleQuickCreate = useCallback(async () => {
@@ -196,6 +203,11 @@ export function MissionPanel({
       return;
     }
 
+    if (!severity) {
+      setError('Please select the incident severity');
+      return;
+    }
+
     setIsLoading(true);
     setError(null);
 
@@ -204,6 +216,7 @@ export function MissionPanel({
         vehicleId: selectedVehicle,
         originNode,
         destNode,
+        severity,
       });
 
       if (response.success && response.data) {
@@ -215,6 +228,7 @@ export function MissionPanel({
         setTimeout(() => {
           setSelectedVehicle('');
           setDestNode('');
+          setSeverity('');
         }, 2000);
       } else {
         setError(response.error || 'Failed to create mission');
@@ -224,7 +238,7 @@ export function MissionPanel({
     } finally {
       setIsLoading(false);
     }
-  }, [selectedVehicle, originNode, destNode, setIsLoading, onMissionCreated, onRouteCalculated]);
+  }, [selectedVehicle, originNode, destNode, severity, setIsLoading, onMissionCreated, onRouteCalculated]);
 
   // Complete a mission
   const handleCompleteMission = useCallback(async (missionId: string) => {
@@ -357,11 +371,26 @@ export function MissionPanel({
           </select>
         </div>
 
+        <div className="form-group">
+          <label>Incident Severity</label>
+          <select
+            value={severity}
+            onChange={(e) => setSeverity(e.target.value as Severity | '')}
+            disabled={isLoading || !selectedVehicle}
+          >
+            <option value="">Select severity...</option>
+            <option value="critical">Critical</option>
+            <option value="high">High</option>
+            <option value="medium">Medium</option>
+            <option value="low">Low</option>
+          </select>
+        </div>
+
         <div className="button-row">
           <button
             className="btn btn-primary btn-full"
             onClick={handleQuickCreate}
-            disabled={isLoading || !selectedVehicle || !originNode || !destNode}
+            disabled={isLoading || !selectedVehicle || !originNode || !destNode || !severity}
           >
             🚀 Launch Mission
           </button>
@@ -75,6 +75,8 @@ export interface ApiResponse<T> {
 
 export type OrgType = 'medical' | 'police';
 
+export type Severity = 'critical' | 'high' | 'medium' | 'low';
+
 export interface WebSocketMessage {
   type: string;
   payload: any;
@@ -101,6 +103,7 @@ export interface CreateMissionRequest {
   vehicleId: string;
   originNode: string;
   destNode: string;
+  severity: Severity;
 }
 
 export interface RouteResult {